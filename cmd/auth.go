@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"golang.org/x/term"
+	"os"
+	r "redis-cluster-manager/redis"
+	"redis-cluster-manager/vars"
+	"strings"
+)
+
+func initAuth() {
+	rootCmd.PersistentFlags().StringVar(&vars.Cluster.Username, "user", "", "ACL username, default user 'default' if not set")
+	rootCmd.PersistentFlags().StringVar(&vars.Cluster.PasswordEnv, "password-env", "", "read the password from this environment variable, e.g. REDISCLI_AUTH")
+	rootCmd.PersistentFlags().StringVar(&vars.Cluster.PasswordFile, "password-file", "", "read the password from the first line of this file")
+	rootCmd.PersistentFlags().BoolVar(&vars.Cluster.AskPassword, "ask-password", false, "prompt for the password")
+	rootCmd.PersistentFlags().StringVar(&vars.Cluster.CredentialsFile, "credentials-file", "", "file of \"<addr|ip> <username> <password>\" lines for nodes with different credentials, username - for no ACL")
+}
+
+// loadAuth resolves vars.Cluster.Password from the chosen source and loads vars.Cluster.Credentials
+func loadAuth() error {
+	sources := 0
+	for _, set := range []bool{vars.Cluster.Password != "", vars.Cluster.PasswordEnv != "", vars.Cluster.PasswordFile != "", vars.Cluster.AskPassword} {
+		if set {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return fmt.Errorf("only one of -a, --password-env, --password-file and --ask-password can be used")
+	}
+	switch {
+	case vars.Cluster.PasswordEnv != "":
+		password, ok := os.LookupEnv(vars.Cluster.PasswordEnv)
+		if !ok {
+			return fmt.Errorf("environment variable %s is not set", vars.Cluster.PasswordEnv)
+		}
+		vars.Cluster.Password = password
+	case vars.Cluster.PasswordFile != "":
+		content, err := os.ReadFile(vars.Cluster.PasswordFile)
+		if err != nil {
+			return fmt.Errorf("failed to read password file: %v", err)
+		}
+		vars.Cluster.Password = strings.TrimRight(strings.SplitN(string(content), "\n", 2)[0], "\r")
+	case vars.Cluster.AskPassword:
+		password, err := readPassword()
+		if err != nil {
+			return fmt.Errorf("failed to read password: %v", err)
+		}
+		vars.Cluster.Password = password
+	}
+	if vars.Cluster.CredentialsFile != "" {
+		credentials, err := r.LoadCredentials(vars.Cluster.CredentialsFile)
+		if err != nil {
+			return err
+		}
+		vars.Cluster.Credentials = credentials
+	}
+	return nil
+}
+
+// readPassword prompts on stderr and reads the password without echo, or reads a line if stdin is not a terminal
+func readPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	fmt.Fprint(os.Stderr, "Password: ")
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	return string(password), err
+}
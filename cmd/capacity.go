@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"redis-cluster-manager/cmd/subcmd/history"
+	"redis-cluster-manager/vars"
+)
+
+var capacityCmd = &cobra.Command{
+	Use:   "capacity",
+	Short: "Capacity planning root cmd",
+	Long:  `Capacity planning from the history of the clusters`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Printf("Run `%s capacity --help` for details.\n", vars.AppName)
+	},
+}
+
+func initCapacity() {
+	rootCmd.AddCommand(capacityCmd)
+	// add forecast subcmd
+	history.InitForecast()
+	capacityCmd.AddCommand(history.ForecastCmd)
+}
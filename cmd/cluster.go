@@ -24,4 +24,35 @@ func initCluster() {
 	// add exec subcmd
 	cluster.InitExecParams()
 	clusterCmd.AddCommand(cluster.ExecCmd)
+	// add drain-host/undrain-host subcmd
+	cluster.InitDrainHost()
+	clusterCmd.AddCommand(cluster.DrainHostCmd)
+	clusterCmd.AddCommand(cluster.UndrainHostCmd)
+	// add rolling-restart subcmd
+	cluster.InitRollingRestart()
+	clusterCmd.AddCommand(cluster.RollingRestartCmd)
+	// add whatif subcmd
+	cluster.InitWhatif()
+	clusterCmd.AddCommand(cluster.WhatifCmd)
+	// add placement subcmd
+	cluster.InitPlacement()
+	clusterCmd.AddCommand(cluster.PlacementCmd)
+	// add balance-replicas subcmd
+	cluster.InitBalanceReplicas()
+	clusterCmd.AddCommand(cluster.BalanceReplicasCmd)
+	// add check subcmd
+	cluster.InitCheck()
+	clusterCmd.AddCommand(cluster.CheckCmd)
+	// add forget-stale subcmd
+	cluster.InitForgetStale()
+	clusterCmd.AddCommand(cluster.ForgetStaleCmd)
+	// add watch subcmd
+	cluster.InitWatch()
+	clusterCmd.AddCommand(cluster.WatchCmd)
+	// add slowlog subcmd
+	cluster.InitSlowlog()
+	clusterCmd.AddCommand(cluster.SlowlogCmd)
+	// add health subcmd
+	cluster.InitHealth()
+	clusterCmd.AddCommand(cluster.HealthCmd)
 }
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+	"redis-cluster-manager/config"
+	"redis-cluster-manager/vars"
+)
+
+var configFile string // config file of cluster profiles
+
+func initConfig() {
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "config file of cluster profiles, default ~/.config/rcm/config.yaml")
+}
+
+// applyProfile activates the profile named by the first argument and fills the settings not given by flags
+func applyProfile(cmd *cobra.Command, args []string) error {
+	path := configFile
+	if path == "" {
+		path = config.DefaultPath()
+		if _, err := os.Stat(path); err != nil {
+			// the default config file is optional
+			if len(args) > 0 && !config.IsSeedList(args[0]) {
+				return fmt.Errorf("%s is neither a host:port seed list nor a profile, there is no config file %s", args[0], path)
+			}
+			return nil
+		}
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	p, exists := cfg.Profiles[args[0]]
+	if !exists {
+		if !config.IsSeedList(args[0]) {
+			return fmt.Errorf("%s is neither a host:port seed list nor a profile in %s", args[0], path)
+		}
+		return nil
+	}
+	config.ActiveName, config.Active = args[0], p
+	flags := cmd.Flags()
+	if !flags.Changed("timeout") && p.Timeout > 0 {
+		vars.Cluster.Timeout = p.Timeout
+	}
+	if !flags.Changed("user") {
+		vars.Cluster.Username = p.User
+	}
+	// a password source given by flags replaces all sources of the profile
+	if !flags.Changed("password") && !flags.Changed("password-env") && !flags.Changed("password-file") &&
+		!flags.Changed("ask-password") {
+		vars.Cluster.PasswordEnv, vars.Cluster.PasswordFile, vars.Cluster.AskPassword = p.PasswordEnv, p.PasswordFile, p.AskPassword
+	}
+	if !flags.Changed("credentials-file") {
+		vars.Cluster.CredentialsFile = p.CredentialsFile
+	}
+	if flags.Lookup("master-name") != nil && !flags.Changed("master-name") {
+		vars.Cluster.MasterName = p.MasterName
+	}
+	if flags.Lookup("sentinel-user") != nil && !flags.Changed("sentinel-user") {
+		vars.Cluster.SentinelUsername = p.SentinelUser
+	}
+	if !flags.Changed("tls") {
+		vars.Cluster.TLS = p.TLS.Enabled
+	}
+	if !flags.Changed("cacert") {
+		vars.Cluster.TLSCACert = p.TLS.CACert
+	}
+	if !flags.Changed("cert") {
+		vars.Cluster.TLSCert = p.TLS.Cert
+	}
+	if !flags.Changed("key") {
+		vars.Cluster.TLSKey = p.TLS.Key
+	}
+	if !flags.Changed("sni") {
+		vars.Cluster.TLSServerName = p.TLS.SNI
+	}
+	if !flags.Changed("insecure") {
+		vars.Cluster.TLSInsecure = p.TLS.Insecure
+	}
+	if !flags.Changed("addr-map") {
+		vars.Cluster.AddrMap = config.Pairs(p.NAT.AddrMap)
+	}
+	if !flags.Changed("cidr-map") {
+		vars.Cluster.CIDRMap = config.Pairs(p.NAT.CIDRMap)
+	}
+	if !flags.Changed("use-hostname") {
+		vars.Cluster.UseHostname = p.NAT.UseHostname
+	}
+	return nil
+}
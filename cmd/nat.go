@@ -0,0 +1,9 @@
+package cmd
+
+import "redis-cluster-manager/vars"
+
+func initNAT() {
+	rootCmd.PersistentFlags().StringArrayVar(&vars.Cluster.AddrMap, "addr-map", nil, "translate an announced addr to a reachable one: <ip:port>=<ip:port> or <ip>=<ip>, can be repeated")
+	rootCmd.PersistentFlags().StringArrayVar(&vars.Cluster.CIDRMap, "cidr-map", nil, "translate announced ips in a cidr keeping the host bits: 10.244.0.0/16=192.168.0.0/16, can be repeated")
+	rootCmd.PersistentFlags().BoolVar(&vars.Cluster.UseHostname, "use-hostname", false, "dial the hostname announced by cluster-announce-hostname instead of the ip")
+}
@@ -0,0 +1,13 @@
+package cmd
+
+import (
+	"redis-cluster-manager/cmd/subcmd/history"
+)
+
+func initRecord() {
+	// add record and report cmd
+	history.InitRecord()
+	rootCmd.AddCommand(history.RecordCmd)
+	history.InitReport()
+	rootCmd.AddCommand(history.ReportCmd)
+}
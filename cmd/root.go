@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/spf13/cobra"
 	"os"
+	r "redis-cluster-manager/redis"
 	"redis-cluster-manager/vars"
 	"time"
 )
@@ -15,13 +16,34 @@ var rootCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		fmt.Printf("Use %s -h or --help for details.\n", vars.AppName)
 	},
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := applyProfile(cmd, args); err != nil {
+			return err
+		}
+		if err := loadAuth(); err != nil {
+			return err
+		}
+		if err := r.InitTLS(); err != nil {
+			return err
+		}
+		return r.InitNAT()
+	},
 }
 
 func initAll() {
 	initVersion()
 	initCluster()
-	rootCmd.PersistentFlags().DurationVarP(&vars.Timeout, "timeout", "t", time.Second*3, "timeout setting, default 3s, can be any of time.Duration format(10ms,1s,1m,... )")
-	rootCmd.PersistentFlags().StringVarP(&vars.Password, "password", "a", "", "Redis cluster password")
+	initSentinel()
+	initUI()
+	initServe()
+	initRecord()
+	initCapacity()
+	initAuth()
+	initTLS()
+	initConfig()
+	initNAT()
+	rootCmd.PersistentFlags().DurationVarP(&vars.Cluster.Timeout, "timeout", "t", time.Second*3, "timeout setting, default 3s, can be any of time.Duration format(10ms,1s,1m,... )")
+	rootCmd.PersistentFlags().StringVarP(&vars.Cluster.Password, "password", "a", "", "Redis cluster password, prefer --password-env, --password-file or --ask-password")
 	rootCmd.PersistentFlags().BoolVar(&vars.CPUProfiler, "cpupprof", false, "write cpu performance profile to cpu.pprof")
 	rootCmd.PersistentFlags().BoolVar(&vars.MEMProfiler, "mempprof", false, "write memory performance profile to mem.pprof")
 }
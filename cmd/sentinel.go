@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"redis-cluster-manager/cmd/subcmd/sentinel"
+	"redis-cluster-manager/vars"
+)
+
+var sentinelCmd = &cobra.Command{
+	Use:   "sentinel",
+	Short: "Sentinel operations root cmd",
+	Long:  `Sentinel operations root cmd`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Printf("Run `%s sentinel --help` for details.\n", vars.AppName)
+	},
+}
+
+func initSentinel() {
+	rootCmd.AddCommand(sentinelCmd)
+	sentinelCmd.PersistentFlags().StringVarP(&vars.Cluster.MasterName, "master-name", "m", "", "master name monitored by sentinels, can be omitted if only one master monitored")
+	sentinelCmd.PersistentFlags().IntVar(&vars.SentinelPort, "sentinel-port", 26379, "port of sentinels found by the client list of a data node")
+	sentinelCmd.PersistentFlags().StringVar(&vars.Cluster.SentinelUsername, "sentinel-user", "", "ACL username of sentinels, default user 'default' if not set")
+	sentinelCmd.PersistentFlags().StringVar(&vars.Cluster.SentinelPassword, "sentinel-password", "", "password of sentinels")
+	// add status subcmd
+	sentinelCmd.AddCommand(sentinel.StatusCmd)
+	// add check subcmd
+	sentinelCmd.AddCommand(sentinel.CheckCmd)
+	// add failover subcmd
+	sentinel.InitFailover()
+	sentinelCmd.AddCommand(sentinel.FailoverCmd)
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"redis-cluster-manager/cmd/subcmd/serve"
+	"redis-cluster-manager/config"
+	r "redis-cluster-manager/redis"
+	"redis-cluster-manager/vars"
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve operations root cmd",
+	Long:  `Long-running servers of several clusters, given by profile names or seed nodes`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Printf("Run `%s serve --help` for details.\n", vars.AppName)
+	},
+	// replaces the root PersistentPreRunE, the clusters are activated one at a time by the servers
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		serve.Activate = newActivator(cmd)
+		return nil
+	},
+}
+
+func initServe() {
+	rootCmd.AddCommand(serveCmd)
+	// add metrics subcmd
+	serve.InitMetrics()
+	serveCmd.AddCommand(serve.MetricsCmd)
+	// add api subcmd
+	serve.InitAPI()
+	serveCmd.AddCommand(serve.APICmd)
+}
+
+// settings are the settings switched between the clusters of a server
+type settings struct {
+	cluster    vars.ClusterSettings
+	activeName string
+	active     *config.Profile
+}
+
+func saveSettings() settings {
+	return settings{cluster: vars.Cluster, activeName: config.ActiveName, active: config.Active}
+}
+
+func (s settings) restore() {
+	vars.Cluster, config.ActiveName, config.Active = s.cluster, s.activeName, s.active
+}
+
+// newActivator returns a function applying the profile named by arg as the root cmd does for other commands.
+// the settings given by flags are restored before a profile is applied for the first time, then the resolved
+// settings are kept, so that passwords are read or prompted for only once
+func newActivator(cmd *cobra.Command) func(string) error {
+	base := saveSettings()
+	resolved := make(map[string]settings)
+	return func(arg string) error {
+		s, exists := resolved[arg]
+		if !exists {
+			base.restore()
+			if err := applyProfile(cmd, []string{arg}); err != nil {
+				return err
+			}
+			if err := loadAuth(); err != nil {
+				return err
+			}
+			s = saveSettings()
+			resolved[arg] = s
+		}
+		s.restore()
+		if err := r.InitTLS(); err != nil {
+			return err
+		}
+		return r.InitNAT()
+	}
+}
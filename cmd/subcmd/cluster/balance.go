@@ -0,0 +1,90 @@
+package cluster
+
+import (
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"redis-cluster-manager/config"
+	"redis-cluster-manager/perf"
+	r "redis-cluster-manager/redis"
+	"redis-cluster-manager/vars"
+	"time"
+)
+
+var BalanceReplicasCmd = &cobra.Command{
+	Use:   "balance-replicas",
+	Short: "Move surplus slaves to masters with fewer slaves",
+	Long: `Compute a target slave count per master(slaves/masters, rounded up or down), then plan moves of surplus slaves
+to orphaned masters and masters below the target. No move puts two copies of a shard on the same host, and with a
+location file the least conflicting rack/zone is preferred.
+The plan is only shown by default. With --apply the moves are run one by one by CLUSTER REPLICATE, and each moved
+slave must finish it's full sync before the next move starts.`,
+	Args:    cobra.ExactArgs(1),
+	Example: fmt.Sprintf("%s cluster balance-replicas <seed-node> -a \"password\" [-l locations.txt] [--apply]", vars.AppName),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vars.HostPort = config.ResolveSeed(args[0])
+		f := perf.StartCpuProfile()
+		defer perf.StopCpuProfile(f)
+		if err := balanceReplicas(vars.HostPort); err != nil {
+			return err
+		}
+		perf.MemProfile()
+		return nil
+	},
+}
+
+func InitBalanceReplicas() {
+	BalanceReplicasCmd.Flags().StringVarP(&locationFile, "location-file", "l", "", "file of \"<ip> <rack> <zone>\" lines")
+	BalanceReplicasCmd.Flags().BoolVar(&applyPlan, "apply", false, "apply the planned moves")
+	BalanceReplicasCmd.Flags().DurationVar(&syncTimeout, "sync-timeout", time.Minute*30, "max time to wait for each moved slave to finish full sync")
+}
+
+func balanceReplicas(hostPort string) error {
+	locations, err := loadLocations(locationFile)
+	if err != nil {
+		return err
+	}
+	seedNode, err := NewSeedNode(hostPort)
+	if err != nil {
+		return err
+	}
+	defer seedNode.Close()
+	if !seedNode.ClusterEnabled {
+		return fmt.Errorf("seed node %s is not a cluster node", seedNode.Addr)
+	}
+	clusterNodes, err := r.GetClusterNodes(seedNode.Client)
+	if err != nil {
+		return err
+	}
+	p := newPlacement(clusterNodes, locations)
+	if len(p.masters) == 0 {
+		return fmt.Errorf("no master serving slots found")
+	}
+	current := make(map[string]int)
+	for _, m := range p.masters {
+		current[m.NodeID] = len(p.slavesOf(m.NodeID))
+	}
+	target := len(p.slaves) / len(p.masters)
+	if len(p.slaves)%len(p.masters) == 0 {
+		color.Cyan("Target slaves per master: %d\n", target)
+	} else {
+		color.Cyan("Target slaves per master: %d or %d\n", target, target+1)
+	}
+	moves := p.planBalance()
+	color.Cyan("%-45s%-24s%-12s%s\n", "NodeID", "Master", "Current", "Planned")
+	for _, m := range p.masters {
+		planned := len(p.slavesOf(m.NodeID))
+		line := fmt.Sprintf("%-45s%-24s%-12d%d", m.NodeID, m.Addr, current[m.NodeID], planned)
+		if planned < target {
+			// no slave can be moved here without breaking host anti-affinity
+			color.Red("%s", line)
+		} else {
+			fmt.Println(line)
+		}
+	}
+	if len(moves) == 0 {
+		color.Green("Slaves are balanced already.")
+		return nil
+	}
+	return printAndApplyMoves(moves)
+}
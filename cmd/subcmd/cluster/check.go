@@ -0,0 +1,582 @@
+package cluster
+
+import (
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"net"
+	"redis-cluster-manager/config"
+	"redis-cluster-manager/perf"
+	r "redis-cluster-manager/redis"
+	"redis-cluster-manager/vars"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var CheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Compare the cluster views of all nodes",
+	Long: `Run CLUSTER NODES on every reachable node, including the nodes known only by other nodes, and diff the views:
+known node sets, slot ownership, roles, failure flags and config epochs. Nodes are grouped by the topology they see,
+so that partitions, split-brains, stale seeds and ghost nodes can be found. Nothing is changed on the cluster.`,
+	Args:    cobra.ExactArgs(1),
+	Example: fmt.Sprintf("%s cluster check <seed-node> -a \"password\" [--json]", vars.AppName),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vars.HostPort = config.ResolveSeed(args[0])
+		f := perf.StartCpuProfile()
+		defer perf.StopCpuProfile(f)
+		if err := printClusterCheck(vars.HostPort); err != nil {
+			return err
+		}
+		perf.MemProfile()
+		return nil
+	},
+}
+
+func InitCheck() {
+	CheckCmd.Flags().BoolVar(&jsonOutput, "json", false, "print the report in JSON")
+}
+
+// nodeView is the `cluster nodes` output of a node
+type nodeView struct {
+	Addr   string
+	NodeID string                    // ID of the viewer itself, flagged myself
+	Nodes  map[string]*r.ClusterNode // by node ID
+	Err    error
+}
+
+// viewGroup is the viewers that see the same value
+type viewGroup struct {
+	Value   string
+	Viewers []string
+}
+
+// collectNodeViews gets `cluster nodes` of addrs simultaneously, then of the addrs only known by other views,
+// until no new addr is found. views are sorted by addr
+func collectNodeViews(addrs []string) []*nodeView {
+	var (
+		views   []*nodeView
+		visited = make(map[string]bool)
+		mu      sync.Mutex
+	)
+	for len(addrs) > 0 {
+		var wg sync.WaitGroup
+		for _, addr := range addrs {
+			visited[addr] = true
+			wg.Add(1)
+			go func(addr string) {
+				defer wg.Done()
+				view := collectNodeView(addr)
+				mu.Lock()
+				views = append(views, view)
+				mu.Unlock()
+			}(addr)
+		}
+		wg.Wait()
+		addrs = nil
+		for _, v := range views {
+			for _, n := range v.Nodes {
+				if !visited[n.Addr] && dialable(n) {
+					visited[n.Addr] = true
+					addrs = append(addrs, n.Addr)
+				}
+			}
+		}
+	}
+	sort.Slice(views, func(i, j int) bool { return r.CompareAddr(views[i].Addr, views[j].Addr) < 0 })
+	return views
+}
+
+// dialable reports whether n has an addr to connect to
+func dialable(n *r.ClusterNode) bool {
+	_, port, err := net.SplitHostPort(n.Addr)
+	return err == nil && port != "0" && !n.HasFlag("noaddr")
+}
+
+// viewAddrs returns the addrs of the nodes to collect views from, the seed first. the seed is given by the addr it
+// announces, as the other nodes know it, and by seedAddr only if it announces no dialable addr
+func viewAddrs(seedAddr string, seedNodes []*r.ClusterNode) []string {
+	addrs := []string{seedAddr}
+	for _, n := range seedNodes {
+		if !dialable(n) {
+			continue
+		}
+		if n.HasFlag("myself") {
+			// a node alone in it's cluster may not know it's own ip yet: ":6379"
+			if n.Host() != "" {
+				addrs[0] = n.Addr
+			}
+			continue
+		}
+		addrs = append(addrs, n.Addr)
+	}
+	return addrs
+}
+
+func collectNodeView(addr string) *nodeView {
+	view := &nodeView{Addr: addr, Nodes: make(map[string]*r.ClusterNode)}
+	i, err := r.NewInstance(addr)
+	if err != nil {
+		view.Err = err
+		return view
+	}
+	defer i.Close()
+	nodes, err := r.GetClusterNodes(i.Client)
+	if err != nil {
+		view.Err = err
+		return view
+	}
+	for _, n := range nodes {
+		view.Nodes[n.NodeID] = n
+		if n.HasFlag("myself") {
+			view.NodeID = n.NodeID
+		}
+	}
+	return view
+}
+
+// groupViews groups the addrs of valid views by value, the largest group first, ties are ordered by value
+func groupViews(views []*nodeView, value func(*nodeView) string) []viewGroup {
+	byValue := make(map[string][]string)
+	for _, v := range views {
+		if v.Err == nil {
+			val := value(v)
+			byValue[val] = append(byValue[val], v.Addr)
+		}
+	}
+	var groups []viewGroup
+	for val, viewers := range byValue {
+		groups = append(groups, viewGroup{Value: val, Viewers: viewers})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if len(groups[i].Viewers) != len(groups[j].Viewers) {
+			return len(groups[i].Viewers) > len(groups[j].Viewers)
+		}
+		return groups[i].Value < groups[j].Value
+	})
+	return groups
+}
+
+// knownNodes returns the sorted IDs of nodes known by v
+func (v *nodeView) knownNodes() []string {
+	var ids []string
+	for id := range v.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// slotOwners returns the owner node ID of every slot, "" if the slot is not served
+func (v *nodeView) slotOwners() []string {
+	owners := make([]string, r.ClusterSlots)
+	for id, n := range v.Nodes {
+		if n.Role != "master" {
+			continue
+		}
+		for _, slots := range n.Slots {
+			for slot := slots.Start; slot <= slots.End && slot < r.ClusterSlots; slot++ {
+				owners[slot] = id
+			}
+		}
+	}
+	return owners
+}
+
+// slotRanges compresses slot owners to "start-end:owner" ranges
+func slotRanges(owners []string) string {
+	var ranges []string
+	for start := 0; start < len(owners); {
+		end := start
+		for end+1 < len(owners) && owners[end+1] == owners[start] {
+			end++
+		}
+		ranges = append(ranges, fmt.Sprintf("%d-%d:%s", start, end, owners[start]))
+		start = end + 1
+	}
+	return strings.Join(ranges, " ")
+}
+
+// nodeRole returns the role of node id seen by v: "master", "slave of <addr>" or "unknown"
+func (v *nodeView) nodeRole(id string, names map[string]string) string {
+	n, exists := v.Nodes[id]
+	if !exists {
+		return "unknown"
+	}
+	if n.Role == "slave" {
+		return "slave of " + nameOf(n.MasterID, names)
+	}
+	if n.Role == "" {
+		return "no role"
+	}
+	return n.Role
+}
+
+// nodeNames maps node IDs to addrs seen by the views, the addr seen by most views wins
+func nodeNames(views []*nodeView) map[string]string {
+	names := make(map[string]string)
+	for _, v := range views {
+		for id := range v.Nodes {
+			if _, named := names[id]; named {
+				continue
+			}
+			groups := groupViews(views, func(v *nodeView) string {
+				if n, exists := v.Nodes[id]; exists {
+					return n.Addr
+				}
+				return ""
+			})
+			for _, g := range groups {
+				if g.Value != "" {
+					names[id] = g.Value
+					break
+				}
+			}
+		}
+	}
+	return names
+}
+
+func nameOf(id string, names map[string]string) string {
+	if addr, exists := names[id]; exists && addr != "" && !strings.HasPrefix(addr, ":") {
+		return fmt.Sprintf("%s(%s)", addr, shortID(id))
+	}
+	return shortID(id)
+}
+
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
+
+// diffViews returns the disagreements between valid views, and failures seen by any view
+func diffViews(views []*nodeView) []string {
+	var issues []string
+	var valid []*nodeView
+	for _, v := range views {
+		if v.Err == nil {
+			valid = append(valid, v)
+		}
+	}
+	if len(valid) == 0 {
+		return nil
+	}
+	names := nodeNames(valid)
+	allIDs := make(map[string]bool)
+	for _, v := range valid {
+		for id := range v.Nodes {
+			allIDs[id] = true
+		}
+	}
+	var ids []string
+	for id := range allIDs {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if c := r.CompareAddr(names[ids[i]], names[ids[j]]); c != 0 {
+			return c < 0
+		}
+		return ids[i] < ids[j]
+	})
+
+	// known node sets, nodes known by a part of the cluster are ghosts or are being added/forgotten
+	sizeGroups := groupViews(valid, func(v *nodeView) string { return strings.Join(v.knownNodes(), ",") })
+	if len(sizeGroups) > 1 {
+		majority := len(strings.Split(sizeGroups[0].Value, ","))
+		for _, g := range sizeGroups[1:] {
+			issues = append(issues, fmt.Sprintf("%s see %d nodes, %d other nodes see %d", strings.Join(g.Viewers, ","),
+				len(strings.Split(g.Value, ",")), len(sizeGroups[0].Viewers), majority))
+		}
+		for _, id := range ids {
+			var knownBy, unknownBy []string
+			for _, v := range valid {
+				if _, exists := v.Nodes[id]; exists {
+					knownBy = append(knownBy, v.Addr)
+				} else {
+					unknownBy = append(unknownBy, v.Addr)
+				}
+			}
+			if len(unknownBy) == 0 {
+				continue
+			}
+			if len(knownBy) <= len(unknownBy) {
+				issues = append(issues, fmt.Sprintf("node %s is known only by %s", nameOf(id, names), strings.Join(knownBy, ",")))
+			} else {
+				issues = append(issues, fmt.Sprintf("node %s is unknown to %s", nameOf(id, names), strings.Join(unknownBy, ",")))
+			}
+		}
+	}
+
+	// slot ownership, compared with the view of the majority
+	slotGroups := groupViews(valid, func(v *nodeView) string { return slotRanges(v.slotOwners()) })
+	if len(slotGroups) > 1 {
+		var majorityOwners []string
+		for _, v := range valid {
+			if v.Addr == slotGroups[0].Viewers[0] {
+				majorityOwners = v.slotOwners()
+			}
+		}
+		for _, g := range slotGroups[1:] {
+			var owners []string
+			for _, v := range valid {
+				if v.Addr == g.Viewers[0] {
+					owners = v.slotOwners()
+				}
+			}
+			for _, d := range diffSlotOwners(majorityOwners, owners) {
+				issues = append(issues, fmt.Sprintf("%s see slots %s served by %s, %d other nodes see %s",
+					strings.Join(g.Viewers, ","), d.Range, ownerName(d.Owner, names), len(slotGroups[0].Viewers),
+					ownerName(d.MajorityOwner, names)))
+			}
+		}
+	}
+
+	for _, id := range ids {
+		// roles
+		roleGroups := groupViews(valid, func(v *nodeView) string { return v.nodeRole(id, names) })
+		if len(roleGroups) > 1 {
+			var parts []string
+			for _, g := range roleGroups {
+				if g.Value != "unknown" {
+					parts = append(parts, fmt.Sprintf("%s by %s", g.Value, strings.Join(g.Viewers, ",")))
+				}
+			}
+			if len(parts) > 1 {
+				issues = append(issues, fmt.Sprintf("node %s is %s", nameOf(id, names), strings.Join(parts, "; ")))
+			}
+		}
+		// failure flags
+		var failBy, pfailBy []string
+		for _, v := range valid {
+			if n, exists := v.Nodes[id]; exists {
+				if n.HasFlag("fail") {
+					failBy = append(failBy, v.Addr)
+				} else if n.HasFlag("fail?") {
+					pfailBy = append(pfailBy, v.Addr)
+				}
+			}
+		}
+		if len(failBy) > 0 || len(pfailBy) > 0 {
+			var parts []string
+			if len(failBy) > 0 {
+				parts = append(parts, "fail by "+strings.Join(failBy, ","))
+			}
+			if len(pfailBy) > 0 {
+				parts = append(parts, "fail? by "+strings.Join(pfailBy, ","))
+			}
+			issues = append(issues, fmt.Sprintf("node %s is flagged %s", nameOf(id, names), strings.Join(parts, "; ")))
+		}
+		// config epochs
+		epochGroups := groupViews(valid, func(v *nodeView) string {
+			if n, exists := v.Nodes[id]; exists {
+				return strconv.FormatInt(n.ConfigEpoch, 10)
+			}
+			return ""
+		})
+		var epochs []string
+		for _, g := range epochGroups {
+			if g.Value != "" {
+				epochs = append(epochs, fmt.Sprintf("%s by %s", g.Value, strings.Join(g.Viewers, ",")))
+			}
+		}
+		if len(epochs) > 1 {
+			issues = append(issues, fmt.Sprintf("node %s has config epoch %s", nameOf(id, names), strings.Join(epochs, "; ")))
+		}
+	}
+
+	// masters sharing a config epoch in the majority view, which redis resolves by bumping one of them
+	var majorityView *nodeView
+	for _, v := range valid {
+		if v.Addr == sizeGroups[0].Viewers[0] {
+			majorityView = v
+		}
+	}
+	byEpoch := make(map[int64][]string)
+	for _, id := range ids {
+		if n, exists := majorityView.Nodes[id]; exists && n.Role == "master" && n.GetSlotCount() > 0 && n.ConfigEpoch > 0 {
+			byEpoch[n.ConfigEpoch] = append(byEpoch[n.ConfigEpoch], nameOf(id, names))
+		}
+	}
+	var collisions []int64
+	for epoch, masters := range byEpoch {
+		if len(masters) > 1 {
+			collisions = append(collisions, epoch)
+		}
+	}
+	sort.Slice(collisions, func(i, j int) bool { return collisions[i] < collisions[j] })
+	for _, epoch := range collisions {
+		issues = append(issues, fmt.Sprintf("masters %s share config epoch %d", strings.Join(byEpoch[epoch], ","), epoch))
+	}
+	return issues
+}
+
+// slotOwnerDiff is a slot range served by Owner in a view but by MajorityOwner in the majority view
+type slotOwnerDiff struct {
+	Range         string
+	Owner         string
+	MajorityOwner string
+}
+
+func diffSlotOwners(majority, owners []string) []slotOwnerDiff {
+	var diffs []slotOwnerDiff
+	for start := 0; start < len(owners); start++ {
+		if owners[start] == majority[start] {
+			continue
+		}
+		end := start
+		for end+1 < len(owners) && owners[end+1] == owners[start] && majority[end+1] == majority[start] {
+			end++
+		}
+		slotRange := strconv.Itoa(start)
+		if end > start {
+			slotRange = fmt.Sprintf("%d-%d", start, end)
+		}
+		diffs = append(diffs, slotOwnerDiff{Range: slotRange, Owner: owners[start], MajorityOwner: majority[start]})
+		start = end
+	}
+	return diffs
+}
+
+func ownerName(id string, names map[string]string) string {
+	if id == "" {
+		return "nobody"
+	}
+	return nameOf(id, names)
+}
+
+// CheckReport is the result of `cluster check`, printed by --json and served by `serve api`
+type CheckReport struct {
+	Seed         string      `json:"seed"`
+	SkippedSeeds []string    `json:"skipped_seeds,omitempty"`
+	Version      string      `json:"version"`
+	Nodes        []CheckNode `json:"nodes"`
+	Unreachable  int         `json:"unreachable"`
+	Issues       []string    `json:"issues"`
+}
+
+// CheckNode is the summary of a node's view, View is the letter of it's topology, A for the most common one
+type CheckNode struct {
+	Addr    string `json:"addr"`
+	NodeID  string `json:"node_id,omitempty"`
+	Known   int    `json:"known"`
+	Masters int    `json:"masters"`
+	Slots   int    `json:"slots"`
+	Failed  int    `json:"failed"`
+	View    string `json:"view,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// CheckReportOf runs `cluster check` on the cluster of comma separated seeds without printing
+func CheckReportOf(hostPort string) (*CheckReport, error) {
+	seedNode, skipped, err := seedFor(hostPort)
+	if err != nil {
+		return nil, err
+	}
+	defer seedNode.Close()
+	report, err := checkReport(seedNode)
+	if err != nil {
+		return nil, err
+	}
+	report.SkippedSeeds = skipped
+	return report, nil
+}
+
+func checkReport(seedNode *r.Instance) (*CheckReport, error) {
+	if !seedNode.ClusterEnabled {
+		return nil, fmt.Errorf("seed node %s is not a cluster node", seedNode.Addr)
+	}
+	seedNodes, err := r.GetClusterNodes(seedNode.Client)
+	if err != nil {
+		return nil, err
+	}
+	views := collectNodeViews(viewAddrs(seedNode.Addr, seedNodes))
+	// views seeing the same topology share a letter, A for the most common one
+	topology := func(v *nodeView) string {
+		var roles []string
+		for _, id := range v.knownNodes() {
+			roles = append(roles, id+":"+v.Nodes[id].Role+":"+v.Nodes[id].MasterID)
+		}
+		return strings.Join(roles, ",") + "|" + slotRanges(v.slotOwners())
+	}
+	letters := make(map[string]string)
+	for n, g := range groupViews(views, topology) {
+		for _, viewer := range g.Viewers {
+			letters[viewer] = string(rune('A' + n%26))
+		}
+	}
+	report := &CheckReport{Seed: seedNode.Addr, Version: seedNode.Version, Issues: diffViews(views)}
+	if report.Issues == nil {
+		report.Issues = []string{}
+	}
+	for _, v := range views {
+		if v.Err != nil {
+			report.Nodes = append(report.Nodes, CheckNode{Addr: v.Addr, Error: v.Err.Error()})
+			report.Unreachable++
+			continue
+		}
+		node := CheckNode{Addr: v.Addr, NodeID: v.NodeID, Known: len(v.Nodes), View: letters[v.Addr]}
+		for _, n := range v.Nodes {
+			if n.Role == "master" && n.GetSlotCount() > 0 {
+				node.Masters++
+				node.Slots += n.GetSlotCount()
+			}
+			if n.HasFlag("fail") || n.HasFlag("fail?") {
+				node.Failed++
+			}
+		}
+		report.Nodes = append(report.Nodes, node)
+	}
+	return report, nil
+}
+
+func printClusterCheck(hostPort string) error {
+	if jsonOutput {
+		report, err := CheckReportOf(hostPort)
+		if err != nil {
+			return err
+		}
+		return printJSON(report)
+	}
+	seedNode, err := NewSeedNode(hostPort)
+	if err != nil {
+		return err
+	}
+	defer seedNode.Close()
+	report, err := checkReport(seedNode)
+	if err != nil {
+		return err
+	}
+	fmt.Println(strings.Repeat("=", 130))
+	fmt.Printf("%-16s:\t%s\n", "Cluster Version", report.Version)
+	fmt.Println(strings.Repeat("=", 130))
+	color.Cyan("%-24s%-45s%-8s%-10s%-10s%-8s%s\n", "Node", "NodeID", "Known", "Masters", "Slots", "Failed", "View")
+	fmt.Printf("%-24s%-45s%-8s%-10s%-10s%-8s%s\n", "----", "------", "-----", "-------", "-----", "------", "----")
+	for _, n := range report.Nodes {
+		if n.Error != "" {
+			fmt.Printf("%-24s%s\n", n.Addr, color.RedString("%s", n.Error))
+			continue
+		}
+		line := fmt.Sprintf("%-24s%-45s%-8d%-10d%-10d%-8d%s", n.Addr, n.NodeID, n.Known, n.Masters, n.Slots, n.Failed, n.View)
+		if n.View != "A" {
+			color.Red("%s", line)
+		} else {
+			fmt.Println(line)
+		}
+	}
+	if report.Unreachable > 0 {
+		color.Red("Nodes can not be reached: %d\n", report.Unreachable)
+	}
+	if len(report.Issues) == 0 {
+		color.Green("All %d reachable nodes see the same topology.\n", len(report.Nodes)-report.Unreachable)
+		return nil
+	}
+	color.Cyan("Issues: %d\n", len(report.Issues))
+	for _, issue := range report.Issues {
+		color.Red("  %s\n", issue)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package cluster
+
+import (
+	"errors"
+	r "redis-cluster-manager/redis"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffViewsConsistent(t *testing.T) {
+	nodes := map[string]*r.ClusterNode{
+		"m1": {NodeID: "m1", Addr: "10.0.0.1:6379", Role: "master", Flags: []string{"master"}, ConfigEpoch: 1,
+			Slots: []*r.SlotRange{{Start: 0, End: 5460, SlotCount: 5461}}},
+		"m2": {NodeID: "m2", Addr: "10.0.0.2:6379", Role: "master", Flags: []string{"master"}, ConfigEpoch: 2,
+			Slots: []*r.SlotRange{{Start: 5461, End: 10922, SlotCount: 5462}}},
+		"m3": {NodeID: "m3", Addr: "10.0.0.3:6379", Role: "master", Flags: []string{"master"}, ConfigEpoch: 3,
+			Slots: []*r.SlotRange{{Start: 10923, End: 16383, SlotCount: 5461}}},
+	}
+	views := []*nodeView{
+		{Addr: "10.0.0.1:6379", NodeID: "m1", Nodes: nodes},
+		{Addr: "10.0.0.2:6379", NodeID: "m2", Nodes: nodes},
+		{Addr: "10.0.0.3:6379", Err: errors.New("connection refused")},
+	}
+	if issues := diffViews(views); len(issues) != 0 {
+		t.Fatalf("diffViews() = %v, want no issue", issues)
+	}
+}
+
+func TestDiffViewsPartition(t *testing.T) {
+	nodes := map[string]*r.ClusterNode{
+		"m1": {NodeID: "m1", Addr: "10.0.0.1:6379", Role: "master", Flags: []string{"master"}, ConfigEpoch: 1,
+			Slots: []*r.SlotRange{{Start: 0, End: 5460, SlotCount: 5461}}},
+		"m2": {NodeID: "m2", Addr: "10.0.0.2:6379", Role: "master", Flags: []string{"master"}, ConfigEpoch: 2,
+			Slots: []*r.SlotRange{{Start: 5461, End: 10922, SlotCount: 5462}}},
+		"m3": {NodeID: "m3", Addr: "10.0.0.3:6379", Role: "master", Flags: []string{"master"}, ConfigEpoch: 3,
+			Slots: []*r.SlotRange{{Start: 10923, End: 16383, SlotCount: 5461}}},
+	}
+	views := []*nodeView{
+		{Addr: "10.0.0.1:6379", NodeID: "m1", Nodes: nodes},
+		{Addr: "10.0.0.2:6379", NodeID: "m2", Nodes: nodes},
+		// m3 sees a ghost node, has taken slots 0-99 and believes m1 has failed and m2 is it's slave
+		{Addr: "10.0.0.3:6379", NodeID: "m3", Nodes: map[string]*r.ClusterNode{
+			"m1": {NodeID: "m1", Addr: "10.0.0.1:6379", Role: "master", Flags: []string{"master", "fail"}, ConfigEpoch: 1,
+				Slots: []*r.SlotRange{{Start: 100, End: 5460, SlotCount: 5361}}},
+			"m2": {NodeID: "m2", Addr: "10.0.0.2:6379", Role: "slave", MasterID: "m3", Flags: []string{"slave"}, ConfigEpoch: 2},
+			"m3": {NodeID: "m3", Addr: "10.0.0.3:6379", Role: "master", Flags: []string{"master"}, ConfigEpoch: 7,
+				Slots: []*r.SlotRange{{Start: 10923, End: 16383, SlotCount: 5461}, {Start: 0, End: 99, SlotCount: 100}}},
+			"g1": {NodeID: "g1", Addr: "10.0.0.9:6379", Role: "master", Flags: []string{"master"}},
+		}},
+	}
+	issues := diffViews(views)
+	expected := []string{
+		"10.0.0.3:6379 see 4 nodes, 2 other nodes see 3",
+		"node 10.0.0.9:6379(g1) is known only by 10.0.0.3:6379",
+		"10.0.0.3:6379 see slots 0-99 served by 10.0.0.3:6379(m3), 2 other nodes see 10.0.0.1:6379(m1)",
+		"10.0.0.3:6379 see slots 5461-10922 served by nobody, 2 other nodes see 10.0.0.2:6379(m2)",
+		"node 10.0.0.1:6379(m1) is flagged fail by 10.0.0.3:6379",
+		"node 10.0.0.2:6379(m2) is master by 10.0.0.1:6379,10.0.0.2:6379; slave of 10.0.0.3:6379(m3) by 10.0.0.3:6379",
+		"node 10.0.0.3:6379(m3) has config epoch 3 by 10.0.0.1:6379,10.0.0.2:6379; 7 by 10.0.0.3:6379",
+	}
+	joined := strings.Join(issues, "\n")
+	for _, e := range expected {
+		if !strings.Contains(joined, e) {
+			t.Errorf("issue %q not found in:\n%s", e, joined)
+		}
+	}
+	if len(issues) != len(expected) {
+		t.Errorf("len(issues) = %d, want %d:\n%s", len(issues), len(expected), joined)
+	}
+}
+
+func TestDiffViewsEpochCollision(t *testing.T) {
+	views := []*nodeView{{Addr: "10.0.0.1:6379", NodeID: "m1", Nodes: map[string]*r.ClusterNode{
+		"m1": {NodeID: "m1", Addr: "10.0.0.1:6379", Role: "master", Flags: []string{"master"}, ConfigEpoch: 1,
+			Slots: []*r.SlotRange{{Start: 0, End: 5460, SlotCount: 5461}}},
+		"m2": {NodeID: "m2", Addr: "10.0.0.2:6379", Role: "master", Flags: []string{"master"}, ConfigEpoch: 1,
+			Slots: []*r.SlotRange{{Start: 5461, End: 10922, SlotCount: 5462}}},
+		"m3": {NodeID: "m3", Addr: "10.0.0.3:6379", Role: "master", Flags: []string{"master"}, ConfigEpoch: 3,
+			Slots: []*r.SlotRange{{Start: 10923, End: 16383, SlotCount: 5461}}},
+	}}}
+	issues := diffViews(views)
+	if len(issues) != 1 || issues[0] != "masters 10.0.0.1:6379(m1),10.0.0.2:6379(m2) share config epoch 1" {
+		t.Fatalf("diffViews() = %v", issues)
+	}
+}
+
+func TestViewAddrs(t *testing.T) {
+	tests := []struct {
+		name     string
+		seedAddr string
+		nodes    []*r.ClusterNode
+		want     []string
+	}{
+		{
+			name:     "seed given by a hostname is queried by it's announced addr once",
+			seedAddr: "redis-1.example.com:6379",
+			nodes: []*r.ClusterNode{
+				{NodeID: "m2", Addr: "10.0.0.2:6379", Flags: []string{"master"}},
+				{NodeID: "m1", Addr: "10.0.0.1:6379", Flags: []string{"myself", "master"}},
+				{NodeID: "m3", Addr: ":0", Flags: []string{"master", "fail", "noaddr"}},
+			},
+			want: []string{"10.0.0.1:6379", "10.0.0.2:6379"},
+		},
+		{
+			name:     "seed announcing no addr is queried by the given addr",
+			seedAddr: "127.0.0.1:6379",
+			nodes: []*r.ClusterNode{
+				{NodeID: "m1", Addr: ":6379", Flags: []string{"myself", "master"}},
+			},
+			want: []string{"127.0.0.1:6379"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := viewAddrs(tt.seedAddr, tt.nodes); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("viewAddrs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,394 @@
+package cluster
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"net"
+	"os"
+	"redis-cluster-manager/config"
+	"redis-cluster-manager/perf"
+	r "redis-cluster-manager/redis"
+	"redis-cluster-manager/vars"
+	"sort"
+	"time"
+)
+
+var (
+	drainStateFile  string        // file to save the original master placement of a drained host
+	failoverTimeout time.Duration // max time to wait for a failover to finish
+	applyPlan       bool          // apply the planned changes, only the plan is shown without it
+)
+
+var DrainHostCmd = &cobra.Command{
+	Use:   "drain-host",
+	Short: "Move all masters off a host by failing them over to slaves on other hosts",
+	Long: `Find all masters on the given host, pick for each the best slave on a different host and fail over to it
+one by one. Each failover is verified before the next one starts. The original master placement is saved to
+a state file so that undrain-host can restore it after maintenance.
+The plan is only shown by default, the failovers are done with --apply.`,
+	Args:    cobra.ExactArgs(2),
+	Example: fmt.Sprintf("%s cluster drain-host <seed-node> <ip> -a \"password\" [--apply]", vars.AppName),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vars.HostPort = config.ResolveSeed(args[0])
+		f := perf.StartCpuProfile()
+		defer perf.StopCpuProfile(f)
+		if err := drainHost(vars.HostPort, args[1]); err != nil {
+			return err
+		}
+		perf.MemProfile()
+		return nil
+	},
+}
+
+var UndrainHostCmd = &cobra.Command{
+	Use:   "undrain-host",
+	Short: "Restore the master placement of a host drained by drain-host",
+	Long: `Fail over back to the masters recorded in the state file written by drain-host.
+The plan is only shown by default, the failovers are done with --apply.`,
+	Args:    cobra.ExactArgs(2),
+	Example: fmt.Sprintf("%s cluster undrain-host <seed-node> <ip> -a \"password\" [--apply]", vars.AppName),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vars.HostPort = config.ResolveSeed(args[0])
+		f := perf.StartCpuProfile()
+		defer perf.StopCpuProfile(f)
+		if err := undrainHost(vars.HostPort, args[1]); err != nil {
+			return err
+		}
+		perf.MemProfile()
+		return nil
+	},
+}
+
+func InitDrainHost() {
+	for _, c := range []*cobra.Command{DrainHostCmd, UndrainHostCmd} {
+		c.Flags().StringVar(&drainStateFile, "state-file", "", "drain state file, default rcm-drain-<ip>.json")
+		c.Flags().DurationVar(&failoverTimeout, "failover-timeout", time.Second*30, "max time to wait for each failover")
+		c.Flags().BoolVar(&applyPlan, "apply", false, "do the planned failovers")
+	}
+}
+
+// drainState records which masters were moved off a host and which slaves were promoted for them
+type drainState struct {
+	Host    string          `json:"host"`
+	Masters []drainedMaster `json:"masters"`
+}
+
+type drainedMaster struct {
+	NodeID         string `json:"node_id"`
+	Addr           string `json:"addr"`
+	PromotedNodeID string `json:"promoted_node_id"`
+	PromotedAddr   string `json:"promoted_addr"`
+}
+
+func stateFilePath(host string) string {
+	if drainStateFile != "" {
+		return drainStateFile
+	}
+	return fmt.Sprintf("rcm-drain-%s.json", host)
+}
+
+func loadDrainState(host string) (*drainState, error) {
+	data, err := os.ReadFile(stateFilePath(host))
+	if errors.Is(err, os.ErrNotExist) {
+		return &drainState{Host: host}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read drain state file: %v", err)
+	}
+	var state drainState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse drain state file: %v", err)
+	}
+	return &state, nil
+}
+
+// add records a drained master, replacing the record of the same master left by an earlier drain
+func (s *drainState) add(dm drainedMaster) {
+	for n := range s.Masters {
+		if s.Masters[n].NodeID == dm.NodeID {
+			s.Masters[n] = dm
+			return
+		}
+	}
+	s.Masters = append(s.Masters, dm)
+}
+
+func saveDrainState(state *drainState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(stateFilePath(state.Host), data, 0644); err != nil {
+		return fmt.Errorf("failed to write drain state file: %v", err)
+	}
+	return nil
+}
+
+// connectCluster connects to the seed node and all nodes it knows, only sharding cluster is supported.
+// nodes can not be connected are printed as warnings and counted in the returned int
+func connectCluster(hostPort string) (*r.Instance, []*r.Instance, int, error) {
+	seedNode, err := NewSeedNode(hostPort)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if !seedNode.ClusterEnabled {
+		seedNode.Close()
+		return nil, nil, 0, fmt.Errorf("seed node %s is not a cluster node", seedNode.Addr)
+	}
+	clusterNodesInfo, err := r.ParseClusterNodes(seedNode.Client)
+	if err != nil {
+		seedNode.Close()
+		return nil, nil, 0, err
+	}
+	clusterInstances, errs := r.NewClusterInstances(clusterNodesInfo)
+	for nodeInfo, err := range errs {
+		color.Red("failed to create instance for node [%s], error: %v\n", nodeInfo, err)
+	}
+	return seedNode, clusterInstances, len(errs), nil
+}
+
+func drainHost(hostPort, host string) error {
+	seedNode, clusterInstances, _, err := connectCluster(hostPort)
+	if err != nil {
+		return err
+	}
+	defer seedNode.Close()
+	defer r.CloseInstances(clusterInstances)
+
+	// make the plan before any failover, so that a master without candidate is reported in advance
+	hostMasters, plan := drainPlan(clusterInstances, host)
+	color.Cyan("%-24s%-24s%s\n", "Master", "Promote", "PromoteNodeID")
+	for _, m := range hostMasters {
+		candidate, exists := plan[m]
+		if !exists {
+			fmt.Printf("%-24s%s\n", m.Addr, color.RedString("no healthy slave on other hosts"))
+			continue
+		}
+		fmt.Printf("%-24s%-24s%s\n", m.Addr, candidate.Addr, candidate.NodeID)
+	}
+	if len(plan) == 0 {
+		return printDrainReport(seedNode, host)
+	}
+	if !applyPlan {
+		color.Cyan("Run with --apply to do the failovers.")
+		return printDrainReport(seedNode, host)
+	}
+	if err := config.CheckWritable("drain-host"); err != nil {
+		return err
+	}
+
+	state, err := loadDrainState(host)
+	if err != nil {
+		return err
+	}
+	for _, m := range hostMasters {
+		candidate, exists := plan[m]
+		if !exists {
+			continue
+		}
+		color.Yellow("Failing over %s to %s ...\n", m.Addr, candidate.Addr)
+		if err := verifiedFailover(m, candidate); err != nil {
+			return err
+		}
+		state.add(drainedMaster{
+			NodeID:         m.NodeID,
+			Addr:           m.Addr,
+			PromotedNodeID: candidate.NodeID,
+			PromotedAddr:   candidate.Addr,
+		})
+		if err := saveDrainState(state); err != nil {
+			return err
+		}
+	}
+	color.Cyan("Drain state saved to %s\n", stateFilePath(host))
+	return printDrainReport(seedNode, host)
+}
+
+func undrainHost(hostPort, host string) error {
+	state, err := loadDrainState(host)
+	if err != nil {
+		return err
+	}
+	if len(state.Masters) == 0 {
+		return fmt.Errorf("no drained masters found in %s", stateFilePath(host))
+	}
+	seedNode, clusterInstances, _, err := connectCluster(hostPort)
+	if err != nil {
+		return err
+	}
+	defer seedNode.Close()
+	defer r.CloseInstances(clusterInstances)
+
+	byNodeID := make(map[string]*r.Instance)
+	for _, i := range clusterInstances {
+		byNodeID[i.NodeID] = i
+	}
+	// origins and currents are the original masters to fail over back to and the current masters of their shards
+	var origins, currents []*r.Instance
+	color.Cyan("%-24s%s\n", "Master", "Restore")
+	for _, dm := range state.Masters {
+		origin, exists := byNodeID[dm.NodeID]
+		if !exists {
+			return fmt.Errorf("original master %s(%s) can not be connected", dm.Addr, dm.NodeID)
+		}
+		if origin.Role == "master" {
+			fmt.Printf("%-24s%s\n", origin.Addr, "master already, skipped")
+			continue
+		}
+		// the shard may have been failed over by someone else, follow the current master
+		current := byNodeID[origin.MasterID]
+		if current == nil {
+			return fmt.Errorf("master %s of %s can not be connected", origin.Master, origin.Addr)
+		}
+		fmt.Printf("%-24s%s\n", current.Addr, origin.Addr)
+		origins, currents = append(origins, origin), append(currents, current)
+	}
+	if !applyPlan {
+		color.Cyan("Run with --apply to do the failovers.")
+		return nil
+	}
+	if err := config.CheckWritable("undrain-host"); err != nil {
+		return err
+	}
+	for n, origin := range origins {
+		color.Yellow("Failing over %s back to %s ...\n", currents[n].Addr, origin.Addr)
+		if err := verifiedFailover(currents[n], origin); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(stateFilePath(host)); err != nil {
+		return fmt.Errorf("failed to remove drain state file: %v", err)
+	}
+	return printDrainReport(seedNode, host)
+}
+
+// verifiedFailover promotes slave and waits until master has become its slave, node IDs are compared since the
+// master addr of `info replication` may differ from the addr announced in `cluster nodes`
+func verifiedFailover(master, slave *r.Instance) error {
+	if err := slave.Failover(failoverTimeout); err != nil {
+		return err
+	}
+	if err := master.WaitForRole("slave", failoverTimeout); err != nil {
+		return err
+	}
+	if master.MasterID != slave.NodeID {
+		return fmt.Errorf("%s became a slave of %s(%s), expected %s(%s)", master.Addr, master.Master, master.MasterID,
+			slave.Addr, slave.NodeID)
+	}
+	return nil
+}
+
+// drainPlan returns the masters on host sorted by addr, and the slave to promote for each master having a candidate
+func drainPlan(clusterInstances []*r.Instance, host string) ([]*r.Instance, map[*r.Instance]*r.Instance) {
+	var hostMasters []*r.Instance
+	for _, i := range clusterInstances {
+		if i.Role == "master" && i.Host() == host {
+			hostMasters = append(hostMasters, i)
+		}
+	}
+	sort.Sort(r.InstancesAscByAddr(hostMasters))
+	plan := make(map[*r.Instance]*r.Instance)
+	for _, m := range hostMasters {
+		if candidate := bestDrainCandidate(m, clusterInstances, host); candidate != nil {
+			plan[m] = candidate
+		}
+	}
+	return hostMasters, plan
+}
+
+// bestDrainCandidate returns the slave of m that is not on host, in sync and has the largest replication offset.
+// the replication info fetched by Instance.init is used, so the instances must be fresh
+func bestDrainCandidate(m *r.Instance, clusterInstances []*r.Instance, host string) *r.Instance {
+	var best *r.Instance
+	for _, i := range clusterInstances {
+		if i.MasterID != m.NodeID || i.Host() == host || i.SlaveInit || i.LoadingError || i.MasterLinkStatus != "up" {
+			continue
+		}
+		if best == nil || i.SlaveReplOffset > best.SlaveReplOffset ||
+			(i.SlaveReplOffset == best.SlaveReplOffset && r.CompareAddr(i.Addr, best.Addr) < 0) {
+			best = i
+		}
+	}
+	return best
+}
+
+// drainReport is what is left on a drained host
+type drainReport struct {
+	Masters     []string // masters still on host
+	Slaves      []string // slaves on host: "addr(slave of master)"
+	Unprotected []string // masters not on host having all their slaves on host
+}
+
+// drainReportOf computes the drain report of host from ParseClusterNodes output
+func drainReportOf(clusterNodesInfo [][]string, host string) drainReport {
+	nodeHost := func(addr string) string {
+		h, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return addr
+		}
+		return h
+	}
+	masterAddrs := make(map[string]string)
+	for _, nodeInfo := range clusterNodesInfo {
+		if nodeInfo[3] == "master" {
+			masterAddrs[nodeInfo[0]] = nodeInfo[1]
+		}
+	}
+	var (
+		report       drainReport
+		slavesOnHost = make(map[string]int) // master nodeID -> slaves count on host
+		slavesAway   = make(map[string]int) // master nodeID -> slaves count not on host
+	)
+	for _, nodeInfo := range clusterNodesInfo {
+		onHost := nodeHost(nodeInfo[1]) == host
+		switch nodeInfo[3] {
+		case "master":
+			if onHost {
+				report.Masters = append(report.Masters, nodeInfo[1])
+			}
+		case "slave":
+			if onHost {
+				slavesOnHost[nodeInfo[4]]++
+				report.Slaves = append(report.Slaves, fmt.Sprintf("%s(slave of %s)", nodeInfo[1], masterAddrs[nodeInfo[4]]))
+			} else {
+				slavesAway[nodeInfo[4]]++
+			}
+		}
+	}
+	for nodeID, addr := range masterAddrs {
+		if nodeHost(addr) != host && slavesOnHost[nodeID] > 0 && slavesAway[nodeID] == 0 {
+			report.Unprotected = append(report.Unprotected, addr)
+		}
+	}
+	sort.Strings(report.Masters)
+	sort.Strings(report.Slaves)
+	sort.Strings(report.Unprotected)
+	return report
+}
+
+// printDrainReport shows what is left on host, and which shards will lose all slaves while host is down
+func printDrainReport(seedNode *r.Instance, host string) error {
+	clusterNodesInfo, err := r.ParseClusterNodes(seedNode.Client)
+	if err != nil {
+		return err
+	}
+	report := drainReportOf(clusterNodesInfo, host)
+	color.Cyan("Masters remaining on host %s: %d\n", host, len(report.Masters))
+	for _, addr := range report.Masters {
+		color.Red("  %s\n", addr)
+	}
+	color.Cyan("Slaves remaining on host %s: %d\n", host, len(report.Slaves))
+	for _, s := range report.Slaves {
+		fmt.Printf("  %s\n", s)
+	}
+	if len(report.Unprotected) > 0 {
+		color.Red("Shards that will have no slave while host %s is down:\n", host)
+		for _, addr := range report.Unprotected {
+			color.Red("  master %s\n", addr)
+		}
+	}
+	return nil
+}
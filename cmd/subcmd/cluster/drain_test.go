@@ -0,0 +1,134 @@
+package cluster
+
+import (
+	"path/filepath"
+	r "redis-cluster-manager/redis"
+	"reflect"
+	"testing"
+)
+
+func TestBestDrainCandidate(t *testing.T) {
+	master := &r.Instance{Addr: "10.0.0.1:6379", NodeID: "m1", Role: "master"}
+	tests := []struct {
+		name   string
+		slaves []*r.Instance
+		want   string
+	}{
+		{
+			name: "largest offset wins",
+			slaves: []*r.Instance{
+				{Addr: "10.0.0.2:6379", MasterID: "m1", MasterLinkStatus: "up", SlaveReplOffset: 100},
+				{Addr: "10.0.0.3:6379", MasterID: "m1", MasterLinkStatus: "up", SlaveReplOffset: 200},
+			},
+			want: "10.0.0.3:6379",
+		},
+		{
+			name: "same offset, lowest addr wins",
+			slaves: []*r.Instance{
+				{Addr: "10.0.0.10:6379", MasterID: "m1", MasterLinkStatus: "up", SlaveReplOffset: 100},
+				{Addr: "10.0.0.9:6379", MasterID: "m1", MasterLinkStatus: "up", SlaveReplOffset: 100},
+			},
+			want: "10.0.0.9:6379",
+		},
+		{
+			name: "slaves on the drained host, in sync, loading or with link down are skipped",
+			slaves: []*r.Instance{
+				{Addr: "10.0.0.1:6380", MasterID: "m1", MasterLinkStatus: "up", SlaveReplOffset: 900},
+				{Addr: "10.0.0.2:6379", MasterID: "m1", MasterLinkStatus: "up", SlaveReplOffset: 800, SlaveInit: true},
+				{Addr: "10.0.0.3:6379", MasterID: "m1", MasterLinkStatus: "up", SlaveReplOffset: 700, LoadingError: true},
+				{Addr: "10.0.0.4:6379", MasterID: "m1", MasterLinkStatus: "down", SlaveReplOffset: 600},
+				{Addr: "10.0.0.5:6379", MasterID: "m1", MasterLinkStatus: "up", SlaveReplOffset: 10},
+			},
+			want: "10.0.0.5:6379",
+		},
+		{
+			name: "master addr of info replication differing from the announced addr",
+			slaves: []*r.Instance{
+				{Addr: "10.0.0.2:6379", Master: "redis-1.example.com:6379", MasterID: "m1", MasterLinkStatus: "up"},
+			},
+			want: "10.0.0.2:6379",
+		},
+		{
+			name: "slaves of other masters are skipped",
+			slaves: []*r.Instance{
+				{Addr: "10.0.0.2:6379", MasterID: "m9", MasterLinkStatus: "up", SlaveReplOffset: 100},
+			},
+			want: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if best := bestDrainCandidate(master, append([]*r.Instance{master}, tt.slaves...), "10.0.0.1"); best != nil {
+				got = best.Addr
+			}
+			if got != tt.want {
+				t.Fatalf("bestDrainCandidate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDrainPlan(t *testing.T) {
+	instances := []*r.Instance{
+		{Addr: "10.0.0.1:6380", NodeID: "m2", Role: "master"},
+		{Addr: "10.0.0.1:6379", NodeID: "m1", Role: "master"},
+		{Addr: "10.0.0.2:6379", NodeID: "m3", Role: "master"},
+		{Addr: "10.0.0.2:6380", Role: "slave", MasterID: "m1", MasterLinkStatus: "up"},
+		{Addr: "10.0.0.1:6381", Role: "slave", MasterID: "m2", MasterLinkStatus: "up"},
+	}
+	masters, plan := drainPlan(instances, "10.0.0.1")
+	if len(masters) != 2 || masters[0].Addr != "10.0.0.1:6379" || masters[1].Addr != "10.0.0.1:6380" {
+		t.Fatalf("drainPlan() masters = %v, want 10.0.0.1:6379 and 10.0.0.1:6380", masters)
+	}
+	if len(plan) != 1 || plan[masters[0]].Addr != "10.0.0.2:6380" {
+		t.Fatalf("drainPlan() plan = %v, want 10.0.0.1:6379 -> 10.0.0.2:6380 only", plan)
+	}
+}
+
+func TestDrainReportOf(t *testing.T) {
+	clusterNodesInfo := [][]string{
+		{"m1", "10.0.0.1:6379", "0-8191", "master", "-"},
+		{"m2", "10.0.0.2:6379", "8192-16383", "master", "-"},
+		{"s1", "10.0.0.2:6380", "", "slave", "m1"},
+		{"s2", "10.0.0.1:6380", "", "slave", "m2"},
+	}
+	want := drainReport{
+		Masters:     []string{"10.0.0.1:6379"},
+		Slaves:      []string{"10.0.0.1:6380(slave of 10.0.0.2:6379)"},
+		Unprotected: []string{"10.0.0.2:6379"},
+	}
+	if got := drainReportOf(clusterNodesInfo, "10.0.0.1"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("drainReportOf() = %+v, want %+v", got, want)
+	}
+}
+
+func TestDrainStateFile(t *testing.T) {
+	drainStateFile = filepath.Join(t.TempDir(), "drain.json")
+	defer func() { drainStateFile = "" }()
+
+	state, err := loadDrainState("10.0.0.1")
+	if err != nil || state.Host != "10.0.0.1" || len(state.Masters) != 0 {
+		t.Fatalf("loadDrainState() of a missing file = %+v, %v, want an empty state", state, err)
+	}
+	// a master drained again, e.g. by a second run after it was failed back by hand, replaces it's record
+	state.add(drainedMaster{NodeID: "m1", Addr: "10.0.0.1:6379", PromotedNodeID: "s1", PromotedAddr: "10.0.0.2:6380"})
+	state.add(drainedMaster{NodeID: "m2", Addr: "10.0.0.1:6380", PromotedNodeID: "s2", PromotedAddr: "10.0.0.3:6380"})
+	state.add(drainedMaster{NodeID: "m1", Addr: "10.0.0.1:6379", PromotedNodeID: "s3", PromotedAddr: "10.0.0.4:6380"})
+	if err := saveDrainState(state); err != nil {
+		t.Fatalf("saveDrainState() error = %v", err)
+	}
+
+	loaded, err := loadDrainState("10.0.0.1")
+	if err != nil {
+		t.Fatalf("loadDrainState() error = %v", err)
+	}
+	want := []drainedMaster{
+		{NodeID: "m1", Addr: "10.0.0.1:6379", PromotedNodeID: "s3", PromotedAddr: "10.0.0.4:6380"},
+		{NodeID: "m2", Addr: "10.0.0.1:6380", PromotedNodeID: "s2", PromotedAddr: "10.0.0.3:6380"},
+	}
+	if !reflect.DeepEqual(loaded.Masters, want) {
+		t.Fatalf("loaded masters = %+v, want %+v", loaded.Masters, want)
+	}
+}
@@ -6,7 +6,8 @@ import (
 	"github.com/fatih/color"
 	"github.com/redis/go-redis/v9"
 	"github.com/spf13/cobra"
-	"net/netip"
+	"net"
+	"redis-cluster-manager/config"
 	"redis-cluster-manager/perf"
 	r "redis-cluster-manager/redis"
 	"redis-cluster-manager/vars"
@@ -34,7 +35,7 @@ The -n and -r options are mutually exclusive.`,
 			"%s cluster exec <seed-node> -a \"password\" [-n=<nodeID/ip:port,...> | -r=<master/slave/all>] -- <cmd>",
 		vars.AppName, vars.AppName),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		vars.HostPort = args[0]
+		vars.HostPort = config.ResolveSeed(args[0])
 		if len(role) > 0 {
 			if role != "master" && role != "slave" && role != "all" {
 				return fmt.Errorf("role must be `master` or `slave` or `all` when specified")
@@ -57,20 +58,68 @@ func InitExecParams() {
 	ExecCmd.MarkFlagsMutuallyExclusive("nodes", "role")
 }
 
+// checkExecWritable refuses commands flagged write or admin if the active profile is read-only
+func checkExecWritable(seedNode *r.Instance, args []string) error {
+	if !config.ReadOnly() {
+		return nil
+	}
+	flags, err := r.CommandFlags(seedNode.Client, args)
+	if err != nil {
+		return err
+	}
+	for _, flag := range flags {
+		if flag == "write" || flag == "admin" {
+			return config.CheckWritable(fmt.Sprintf("command `%s` flagged %s", strings.Join(args, " "), flag))
+		}
+	}
+	return nil
+}
+
+// execOn runs the command args on instances simultaneously, and returns the formatted results by addr
+func execOn(instances []*r.Instance, args []string) map[string]interface{} {
+	var (
+		results = make(map[string]interface{})
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+	)
+	for _, instance := range instances {
+		wg.Add(1)
+		go func(i *r.Instance) {
+			defer wg.Done()
+			var result interface{} = ""
+			if len(args) > 0 {
+				cmdArgs := make([]interface{}, 0, len(args))
+				for _, f := range args {
+					cmdArgs = append(cmdArgs, f)
+				}
+				stdout, err := i.Client.Do(context.Background(), cmdArgs...).Result()
+				result = formatExecResult(stdout, err)
+			}
+			mu.Lock()
+			results[i.Addr] = result
+			mu.Unlock()
+		}(instance)
+	}
+	wg.Wait()
+	return results
+}
+
 // PrintClusterExecuteResult
 // same as printClusterStatus, if cluster is a master-slave/sentinel cluster, it calls PrintMasterSlaveExecuteResult
 func printClusterExecuteResult(hostPort string) error {
 	// validate redisCmd
-	_, exists := vars.ForbiddenCmds[strings.ToUpper(redisCmd[0])]
-	if exists {
+	if config.IsForbidden(redisCmd[0]) {
 		return fmt.Errorf("command `%s` is forbidden to execute", redisCmd[0])
 	}
 	// we call the provided node as `the seed node`
-	seedNode, err := r.NewInstance(hostPort)
+	seedNode, err := NewSeedNode(hostPort)
 	if err != nil {
 		return err
 	}
 	defer seedNode.Close()
+	if err := checkExecWritable(seedNode, redisCmd); err != nil {
+		return err
+	}
 	if !seedNode.ClusterEnabled {
 		return printMasterSlaveExecuteResult(seedNode)
 	}
@@ -114,33 +163,15 @@ func printClusterExecuteResult(hostPort string) error {
 	}
 
 	// execute the command on the filtered instances
-	var results sync.Map
-	var wgExec sync.WaitGroup
-	for _, instance := range execInstances {
-		wgExec.Add(1)
-		go func(i *r.Instance) {
-			defer wgExec.Done()
-			if len(redisCmd) == 0 {
-				results.Store(i.Addr, "")
-				return
-			}
-			args := make([]interface{}, 0, len(redisCmd))
-			for _, f := range redisCmd {
-				args = append(args, f)
-			}
-			stdout, err := i.Client.Do(context.Background(), args...).Result()
-			results.Store(i.Addr, formatExecResult(stdout, err))
-		}(instance)
-	}
-	wgExec.Wait()
+	results := execOn(execInstances, redisCmd)
 	// print results
 	sort.Sort(r.InstancesAscByAddr(execInstances))
 	for _, instance := range execInstances {
-		addrDisplayed := instance.Addr
+		addrDisplayed := instance.DisplayAddr()
 		if filterType == vars.FILTER_NODEID {
-			addrDisplayed = fmt.Sprintf("%s(%s)", instance.Addr, instance.NodeID)
+			addrDisplayed = fmt.Sprintf("%s(%s)", instance.DisplayAddr(), instance.NodeID)
 		}
-		stdout, _ := results.Load(instance.Addr)
+		stdout := results[instance.Addr]
 		color.Yellow("Output of `%s` on %s:\n", redisCmd, addrDisplayed)
 		fmt.Println(stdout)
 	}
@@ -157,75 +188,38 @@ func printClusterExecuteResult(hostPort string) error {
 }
 
 func printMasterSlaveExecuteResult(seedNode *r.Instance) error {
-	members, err := seedNode.GetMasterSlaveMembers()
+	// the instances connected to discover the replication tree are reused to execute the command
+	tree, err := seedNode.GetReplicationTree()
 	if err != nil {
 		return err
 	}
-	// get cluster instances, then filter it by nodes or role
-	var (
-		clusterInstances  []*r.Instance
-		execInstances     []*r.Instance
-		mu                sync.Mutex
-		wg                sync.WaitGroup
-		warnings          sync.Map     // instances can not be created err messages
-		errInstancesCount atomic.Int32 // instances can not be created counter
-	)
-	// get cluster instances simultaneously
-	for _, member := range members {
-		wg.Add(1)
-		go func(addr string) {
-			defer wg.Done()
-			if i, err := r.NewInstance(addr); err != nil {
-				warnings.Store(addr, err)
-				errInstancesCount.Add(1)
-				return
-			} else {
-				mu.Lock()
-				clusterInstances = append(clusterInstances, i)
-				mu.Unlock()
-			}
-		}(member)
-	}
-	wg.Wait()
+	defer tree.Close()
+	clusterInstances, errs := tree.Instances()
 
-	_, execInstances, err = filterInstances(clusterInstances)
+	_, execInstances, err := filterInstances(clusterInstances)
 	if err != nil {
 		return fmt.Errorf("failed to parse nodes/role: %v", err)
 	}
 
 	// execute the command on the filtered instances
-	var results sync.Map
-	var wgExec sync.WaitGroup
-	for _, instance := range execInstances {
-		wgExec.Add(1)
-		go func(i *r.Instance) {
-			defer wgExec.Done()
-			if len(redisCmd) == 0 {
-				results.Store(i.Addr, "")
-				return
-			}
-			args := make([]interface{}, 0, len(redisCmd))
-			for _, f := range redisCmd {
-				args = append(args, f)
-			}
-			stdout, err := i.Client.Do(context.Background(), args...).Result()
-			results.Store(i.Addr, formatExecResult(stdout, err))
-		}(instance)
-	}
-	wgExec.Wait()
+	results := execOn(execInstances, redisCmd)
 	// print results
 	sort.Sort(r.InstancesAscByAddr(execInstances))
 	for _, instance := range execInstances {
-		stdout, _ := results.Load(instance.Addr)
-		color.Yellow("Output of `%s` on %s:\n", redisCmd, instance.Addr)
+		stdout := results[instance.Addr]
+		color.Yellow("Output of `%s` on %s:\n", redisCmd, instance.DisplayAddr())
 		fmt.Println(stdout)
 	}
-	if errInstancesCount.Load() != 0 {
+	if len(errs) != 0 {
 		color.Cyan("Warnings:")
-		warnings.Range(func(addr, stdout interface{}) bool {
-			color.Red("failed to create instance for node [addr=%v], error: %v\n", addr, err)
-			return true
-		})
+		var addrs []string
+		for addr := range errs {
+			addrs = append(addrs, addr)
+		}
+		sort.Slice(addrs, func(i, j int) bool { return r.CompareAddr(addrs[i], addrs[j]) < 0 })
+		for _, addr := range addrs {
+			color.Red("failed to create instance for node [addr=%v], error: %v\n", addr, errs[addr])
+		}
 	}
 	color.Cyan("Done!")
 	return nil
@@ -241,42 +235,58 @@ func formatExecResult(stdout interface{}, err error) interface{} {
 	return stdout
 }
 
+// isAddr reports whether node is a host:port rather than a node ID
+func isAddr(node string) bool {
+	_, _, err := net.SplitHostPort(node)
+	return err == nil
+}
+
+// matchNode reports whether node, a host:port or a node ID, refers to instance i.
+// a host:port matches the announced or the dialed addr of i
+func matchNode(i *r.Instance, node string) bool {
+	if !isAddr(node) {
+		return i.NodeID == node
+	}
+	node = r.NormalizeAddr(node)
+	return r.NormalizeAddr(i.Addr) == node || r.NormalizeAddr(i.DialAddr) == node
+}
+
 // filterInstances filters the cluster instances based on the provided nodes or role flags.
 func filterInstances(clusterInstances []*r.Instance) (int, []*r.Instance, error) {
+	return filterInstancesBy(clusterInstances, nodes, role, vars.HostPort)
+}
+
+// filterInstancesBy filters the cluster instances by comma separated nodes, or by role,
+// or returns the seed node if both are empty
+func filterInstancesBy(clusterInstances []*r.Instance, nodes, role, seed string) (int, []*r.Instance, error) {
 	var filterType int
 	var execInstances []*r.Instance
 	// nodes/role have been marked to MarkFlagsMutuallyExclusive and checked in RunE,
 	// so we can safely check them with `else if`
 	if len(nodes) > 0 {
-		nodeList := strings.Split(nodes, ",")
-		_, err := netip.ParseAddrPort(nodeList[0])
-		if err == nil {
-			filterType = vars.FILTER_ADDR
-			// if the first node is an ip:port, we treat all nodes as ip:port
-			for _, addrPort := range nodeList {
-				for _, i := range clusterInstances {
-					if i.Addr == addrPort {
-						execInstances = append(execInstances, i)
-					}
-				}
+		// each entry is matched on it's own: host:port (ipv4, [ipv6] or hostname) or a node ID
+		filterType = vars.FILTER_ADDR
+		var notFound []string
+		for _, node := range strings.Split(nodes, ",") {
+			node = strings.TrimSpace(node)
+			if !isAddr(node) {
+				filterType = vars.FILTER_NODEID
 			}
-			if len(execInstances) != len(nodeList) {
-				return filterType, nil, fmt.Errorf("some nodes not found in cluster")
-			}
-		} else {
-			filterType = vars.FILTER_NODEID
-			// otherwise we treat all nodes as nodeID
-			for _, nodeID := range nodeList {
-				for _, instance := range clusterInstances {
-					if instance.NodeID == nodeID {
-						execInstances = append(execInstances, instance)
-					}
+			found := false
+			for _, i := range clusterInstances {
+				if matchNode(i, node) {
+					execInstances = append(execInstances, i)
+					found = true
+					break
 				}
 			}
-			if len(execInstances) != len(nodeList) {
-				return filterType, nil, fmt.Errorf("some nodes not found in cluster")
+			if !found {
+				notFound = append(notFound, node)
 			}
 		}
+		if len(notFound) > 0 {
+			return filterType, nil, fmt.Errorf("nodes not found in cluster: %s", strings.Join(notFound, ","))
+		}
 	} else if role == vars.ROLE_MASTER {
 		filterType = vars.FILTER_ROLE
 		for _, i := range clusterInstances {
@@ -298,7 +308,7 @@ func filterInstances(clusterInstances []*r.Instance) (int, []*r.Instance, error)
 		// if no nodes or role specified, we run the command on the seed node only
 		filterType = vars.FILTER_NONE
 		for _, i := range clusterInstances {
-			if i.Addr == vars.HostPort {
+			if matchNode(i, seed) {
 				execInstances = append(execInstances, i)
 				break
 			}
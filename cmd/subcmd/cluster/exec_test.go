@@ -2,6 +2,8 @@ package cluster
 
 import (
 	"errors"
+	r "redis-cluster-manager/redis"
+	"redis-cluster-manager/vars"
 	"testing"
 
 	goRedis "github.com/redis/go-redis/v9"
@@ -39,3 +41,37 @@ func TestFormatExecResult(t *testing.T) {
 		})
 	}
 }
+
+func TestFilterInstancesByNodes(t *testing.T) {
+	instances := []*r.Instance{
+		{Addr: "10.0.0.1:6379", DialAddr: "10.0.0.1:6379", NodeID: "aaaa"},
+		{Addr: "[2001:db8::1]:6379", DialAddr: "[2001:db8::1]:6379", NodeID: "bbbb"},
+		{Addr: "10.244.0.3:6379", DialAddr: "redis-2.svc:6379", NodeID: "cccc"},
+	}
+	defer func() { nodes = "" }()
+	tests := []struct {
+		nodes      string
+		filterType int
+		addrs      []string
+	}{
+		{"10.0.0.1:6379,[2001:DB8::1]:6379", vars.FILTER_ADDR, []string{"10.0.0.1:6379", "[2001:db8::1]:6379"}},
+		// mixed entries, the dialed hostname matches too
+		{"bbbb, Redis-2.svc:6379", vars.FILTER_NODEID, []string{"[2001:db8::1]:6379", "10.244.0.3:6379"}},
+	}
+	for _, tt := range tests {
+		nodes = tt.nodes
+		filterType, filtered, err := filterInstances(instances)
+		if err != nil || filterType != tt.filterType || len(filtered) != len(tt.addrs) {
+			t.Fatalf("filterInstances(%s) = %d, %v, %v", tt.nodes, filterType, filtered, err)
+		}
+		for n, i := range filtered {
+			if i.Addr != tt.addrs[n] {
+				t.Fatalf("filterInstances(%s)[%d] = %s, want %s", tt.nodes, n, i.Addr, tt.addrs[n])
+			}
+		}
+	}
+	nodes = "10.0.0.1:6379,dddd"
+	if _, _, err := filterInstances(instances); err == nil {
+		t.Fatal("filterInstances() should fail if a node is not found")
+	}
+}
@@ -0,0 +1,330 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"redis-cluster-manager/config"
+	"redis-cluster-manager/perf"
+	r "redis-cluster-manager/redis"
+	"redis-cluster-manager/vars"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	staleOlderThan time.Duration // min time since the last pong of a node to be forgotten
+)
+
+const (
+	// forgetWindow is how long redis blacklists a forgotten node, every live node must forget it within the window,
+	// otherwise it's learned again from the gossip of nodes still knowing it
+	forgetWindow        = time.Second * 60
+	forgetRetryInterval = time.Millisecond * 500
+)
+
+// staleFlags are the flags of nodes that may be ghosts
+var staleFlags = []string{"fail", "noaddr", "handshake"}
+
+var ForgetStaleCmd = &cobra.Command{
+	Use:   "forget-stale",
+	Short: "Forget failed, noaddr and handshake nodes on every live node",
+	Long: `List the nodes flagged fail, noaddr or handshake by every node knowing them, whose last pong is older than
+--older-than. Nodes still owning slots, still having live slaves or seen healthy by any node are refused, so are
+nodes that never answered a ping unless they are flagged fail and noaddr, e.g. nodes in handshake.
+With --apply CLUSTER FORGET is sent to every live node within the 60 seconds blacklist window, failed sends
+are retried, and finally all nodes are checked to no longer know the forgotten nodes.`,
+	Args:    cobra.ExactArgs(1),
+	Example: fmt.Sprintf("%s cluster forget-stale <seed-node> -a \"password\" [--older-than 1h] [--apply]", vars.AppName),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vars.HostPort = config.ResolveSeed(args[0])
+		f := perf.StartCpuProfile()
+		defer perf.StopCpuProfile(f)
+		if err := forgetStale(vars.HostPort); err != nil {
+			return err
+		}
+		perf.MemProfile()
+		return nil
+	},
+}
+
+func InitForgetStale() {
+	ForgetStaleCmd.Flags().DurationVar(&staleOlderThan, "older-than", time.Hour, "min time since the last pong of a node to be forgotten")
+	ForgetStaleCmd.Flags().BoolVar(&applyPlan, "apply", false, "forget the listed nodes")
+}
+
+// staleNode is a node flagged stale by the views knowing it
+type staleNode struct {
+	NodeID  string
+	Addr    string
+	Flags   []string      // stale flags seen by any view
+	Age     time.Duration // time since the last pong seen by any view, -1 if never
+	NoAddr  bool          // flagged fail and noaddr by every view knowing it
+	KnownBy []string
+	Refused string // why the node can not be forgotten, "" if it can
+}
+
+// findStaleNodes returns the nodes flagged stale by every valid view knowing them, sorted by addr.
+// the viewers themselves are alive and never stale
+func findStaleNodes(views []*nodeView, olderThan time.Duration, now time.Time) []*staleNode {
+	alive := make(map[string]bool)
+	for _, v := range views {
+		if v.Err == nil {
+			alive[v.NodeID] = true
+		}
+	}
+	names := nodeNames(views)
+	byID := make(map[string]*staleNode)
+	healthyBy := make(map[string][]string)
+	lastPong := make(map[string]int64)
+	for _, v := range views {
+		if v.Err != nil {
+			continue
+		}
+		for id, n := range v.Nodes {
+			if alive[id] {
+				continue
+			}
+			lastPong[id] = max(lastPong[id], n.PongRecv)
+			var flags []string
+			for _, flag := range staleFlags {
+				if n.HasFlag(flag) {
+					flags = append(flags, flag)
+				}
+			}
+			if len(flags) == 0 {
+				healthyBy[id] = append(healthyBy[id], v.Addr)
+				continue
+			}
+			s, exists := byID[id]
+			if !exists {
+				s = &staleNode{NodeID: id, Addr: names[id], NoAddr: true}
+				byID[id] = s
+			}
+			s.NoAddr = s.NoAddr && n.HasFlag("fail") && n.HasFlag("noaddr")
+			s.KnownBy = append(s.KnownBy, v.Addr)
+			for _, flag := range flags {
+				if !contains(s.Flags, flag) {
+					s.Flags = append(s.Flags, flag)
+				}
+			}
+			if n.GetSlotCount() > 0 && s.Refused == "" {
+				s.Refused = fmt.Sprintf("owns %d slots in the view of %s", n.GetSlotCount(), v.Addr)
+			}
+		}
+	}
+
+	var stales []*staleNode
+	for id, s := range byID {
+		sort.Slice(s.Flags, func(i, j int) bool { return indexOf(staleFlags, s.Flags[i]) < indexOf(staleFlags, s.Flags[j]) })
+		sort.Slice(s.KnownBy, func(i, j int) bool { return r.CompareAddr(s.KnownBy[i], s.KnownBy[j]) < 0 })
+		s.Age = -1
+		if lastPong[id] > 0 {
+			s.Age = now.Sub(time.UnixMilli(lastPong[id])).Truncate(time.Second)
+		}
+		if len(healthyBy[id]) > 0 {
+			s.Refused = "seen healthy by " + strings.Join(healthyBy[id], ",")
+		}
+		// a slave refuses to forget it's master
+		for _, v := range views {
+			if me, exists := v.Nodes[v.NodeID]; v.Err == nil && exists && me.MasterID == id && s.Refused == "" {
+				s.Refused = "is the master of " + v.Addr
+			}
+		}
+		if s.Refused == "" && s.Age >= 0 && s.Age < olderThan {
+			s.Refused = fmt.Sprintf("last pong %v ago, not older than %v", s.Age, olderThan)
+		}
+		// a node in handshake never answered yet, only a node without addr can't answer at all
+		if s.Refused == "" && s.Age < 0 && !s.NoAddr {
+			s.Refused = "never answered a ping, it may be joining"
+		}
+		stales = append(stales, s)
+	}
+	sort.Slice(stales, func(i, j int) bool {
+		if c := r.CompareAddr(stales[i].Addr, stales[j].Addr); c != 0 {
+			return c < 0
+		}
+		return stales[i].NodeID < stales[j].NodeID
+	})
+	return stales
+}
+
+func contains(values []string, value string) bool {
+	return indexOf(values, value) >= 0
+}
+
+func indexOf(values []string, value string) int {
+	for n, v := range values {
+		if v == value {
+			return n
+		}
+	}
+	return -1
+}
+
+func formatAge(age time.Duration) string {
+	if age < 0 {
+		return "never"
+	}
+	return age.String()
+}
+
+func forgetStale(hostPort string) error {
+	seedNode, err := NewSeedNode(hostPort)
+	if err != nil {
+		return err
+	}
+	defer seedNode.Close()
+	if !seedNode.ClusterEnabled {
+		return fmt.Errorf("seed node %s is not a cluster node", seedNode.Addr)
+	}
+	seedNodes, err := r.GetClusterNodes(seedNode.Client)
+	if err != nil {
+		return err
+	}
+	views := collectNodeViews(viewAddrs(seedNode.Addr, seedNodes))
+	stales := findStaleNodes(views, staleOlderThan, time.Now())
+	if len(stales) == 0 {
+		color.Green("No stale node found.\n")
+		return nil
+	}
+	color.Cyan("%-24s%-45s%-24s%-16s%s\n", "Node", "NodeID", "Flags", "LastPong", "Status")
+	fmt.Printf("%-24s%-45s%-24s%-16s%s\n", "----", "------", "-----", "--------", "------")
+	var ghosts []*staleNode
+	ghostAddrs := make(map[string]bool)
+	for _, s := range stales {
+		line := fmt.Sprintf("%-24s%-45s%-24s%-16s", s.Addr, s.NodeID, strings.Join(s.Flags, ","), formatAge(s.Age))
+		if s.Refused != "" {
+			fmt.Printf("%s%s\n", line, color.RedString("refused: %s", s.Refused))
+			continue
+		}
+		fmt.Printf("%s%s\n", line, color.GreenString("forget, known by %d nodes", len(s.KnownBy)))
+		ghosts = append(ghosts, s)
+		ghostAddrs[s.Addr] = true
+	}
+	if len(ghosts) == 0 {
+		color.Cyan("No node can be forgotten.")
+		return nil
+	}
+
+	// a live node that is not reached keeps the ghosts and gossips them back
+	var live, unreachable []string
+	for _, v := range views {
+		if v.Err == nil {
+			live = append(live, v.Addr)
+		} else if !ghostAddrs[v.Addr] {
+			unreachable = append(unreachable, v.Addr)
+		}
+	}
+	if len(unreachable) > 0 {
+		return fmt.Errorf("nodes %s can not be reached, they would learn the forgotten nodes again",
+			strings.Join(unreachable, ","))
+	}
+	if !applyPlan {
+		color.Cyan("Run with --apply to forget %d nodes on %d live nodes.\n", len(ghosts), len(live))
+		return nil
+	}
+	if err := config.CheckWritable("forgetting nodes"); err != nil {
+		return err
+	}
+	var ids []string
+	for _, g := range ghosts {
+		ids = append(ids, g.NodeID)
+	}
+	if err := forgetOnAll(live, ids); err != nil {
+		return err
+	}
+
+	// final check, no node should still know the ghosts
+	var issues []string
+	for _, v := range collectNodeViews(live) {
+		if v.Err != nil {
+			issues = append(issues, fmt.Sprintf("%s can not be checked: %v", v.Addr, v.Err))
+			continue
+		}
+		for _, g := range ghosts {
+			if _, exists := v.Nodes[g.NodeID]; exists {
+				issues = append(issues, fmt.Sprintf("%s still knows %s", v.Addr, nameOf(g.NodeID, map[string]string{g.NodeID: g.Addr})))
+			}
+		}
+	}
+	if len(issues) > 0 {
+		for _, issue := range issues {
+			color.Red("  %s\n", issue)
+		}
+		return fmt.Errorf("%d nodes were not forgotten everywhere", len(ghosts))
+	}
+	color.Green("%d nodes forgotten by all %d live nodes.\n", len(ghosts), len(live))
+	return nil
+}
+
+// forgetOnAll connects to all addrs first, then sends `cluster forget` of every id to them simultaneously,
+// retrying the failed ones until the forget window is over
+func forgetOnAll(addrs, ids []string) error {
+	var instances []*r.Instance
+	defer func() { r.CloseInstances(instances) }()
+	for _, addr := range addrs {
+		i, err := r.NewInstance(addr)
+		if err != nil {
+			return err
+		}
+		instances = append(instances, i)
+	}
+	deadline := time.Now().Add(forgetWindow)
+	var (
+		mu      sync.Mutex
+		pending = make(map[*r.Instance][]string)
+		lastErr = make(map[*r.Instance]error)
+	)
+	for _, i := range instances {
+		pending[i] = ids
+	}
+	for {
+		round := make(map[*r.Instance][]string, len(pending))
+		for i, ids := range pending {
+			round[i] = ids
+		}
+		var wg sync.WaitGroup
+		for i, ids := range round {
+			wg.Add(1)
+			go func(i *r.Instance, ids []string) {
+				defer wg.Done()
+				var failed []string
+				for _, id := range ids {
+					err := i.Client.ClusterForget(context.Background(), id).Err()
+					// unknown node: forgotten by a previous try
+					if err != nil && !strings.Contains(err.Error(), "Unknown node") {
+						failed = append(failed, id)
+						mu.Lock()
+						lastErr[i] = err
+						mu.Unlock()
+					}
+				}
+				mu.Lock()
+				if len(failed) == 0 {
+					delete(pending, i)
+				} else {
+					pending[i] = failed
+				}
+				mu.Unlock()
+			}(i, ids)
+		}
+		wg.Wait()
+		if len(pending) == 0 {
+			return nil
+		}
+		if time.Now().Add(forgetRetryInterval).After(deadline) {
+			break
+		}
+		time.Sleep(forgetRetryInterval)
+	}
+	var failures []string
+	for i, ids := range pending {
+		failures = append(failures, fmt.Sprintf("%s: %d nodes, %v", i.Addr, len(ids), lastErr[i]))
+	}
+	sort.Strings(failures)
+	return fmt.Errorf("failed to forget nodes within %v on %s", forgetWindow, strings.Join(failures, "; "))
+}
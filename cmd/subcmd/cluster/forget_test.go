@@ -0,0 +1,90 @@
+package cluster
+
+import (
+	"errors"
+	r "redis-cluster-manager/redis"
+	"testing"
+	"time"
+)
+
+func TestFindStaleNodes(t *testing.T) {
+	now := time.UnixMilli(10_000_000)
+	m1 := &r.ClusterNode{NodeID: "m1", Addr: "10.0.0.1:6379", Role: "master", Flags: []string{"master"},
+		Slots: []*r.SlotRange{{Start: 0, End: 5460, SlotCount: 5461}}}
+	m2 := &r.ClusterNode{NodeID: "m2", Addr: "10.0.0.2:6379", Role: "master", Flags: []string{"master"},
+		Slots: []*r.SlotRange{{Start: 5461, End: 10922, SlotCount: 5462}}}
+	m3 := &r.ClusterNode{NodeID: "m3", Addr: "10.0.0.3:6379", Role: "master", Flags: []string{"master"},
+		Slots: []*r.SlotRange{{Start: 10923, End: 16383, SlotCount: 5461}}}
+	// g1 failed 2h ago, g2 has no addr and never answered, g3 failed a minute ago
+	g1 := &r.ClusterNode{NodeID: "g1", Addr: "10.0.0.7:6379", Role: "master", Flags: []string{"master", "fail"},
+		PongRecv: now.Add(-2 * time.Hour).UnixMilli()}
+	g2 := &r.ClusterNode{NodeID: "g2", Addr: ":0", Role: "slave", MasterID: "m1", Flags: []string{"slave", "fail", "noaddr"}}
+	g3 := &r.ClusterNode{NodeID: "g3", Addr: "10.0.0.8:6379", Role: "slave", MasterID: "m2", Flags: []string{"slave", "fail"},
+		PongRecv: now.Add(-time.Minute).UnixMilli()}
+	// g4 still owns slots, g5 is flagged fail by m1 only
+	g4 := &r.ClusterNode{NodeID: "g4", Addr: "10.0.0.9:6379", Role: "master", Flags: []string{"master", "fail"},
+		Slots: []*r.SlotRange{{Start: 0, End: 0, SlotCount: 1}}}
+	g5 := &r.ClusterNode{NodeID: "g5", Addr: "10.0.0.6:6379", Role: "master", Flags: []string{"master"}}
+	g5Failed := &r.ClusterNode{NodeID: "g5", Addr: "10.0.0.6:6379", Role: "master", Flags: []string{"master", "fail"}}
+	// h1 is in handshake, it never answered a ping
+	h1 := &r.ClusterNode{NodeID: "h1", Addr: "10.0.0.5:6379", Role: "master", Flags: []string{"master", "handshake"},
+		PingSent: now.Add(-time.Second).UnixMilli()}
+	views := []*nodeView{
+		{Addr: "10.0.0.1:6379", NodeID: "m1", Nodes: map[string]*r.ClusterNode{
+			"m1": m1, "m2": m2, "m3": m3, "g1": g1, "g2": g2, "g3": g3, "g4": g4, "g5": g5Failed, "h1": h1}},
+		{Addr: "10.0.0.2:6379", NodeID: "m2", Nodes: map[string]*r.ClusterNode{
+			"m1": m1, "m2": m2, "m3": m3, "g1": g1, "g2": g2, "g3": g3, "g4": g4, "g5": g5, "h1": h1}},
+		{Addr: "10.0.0.3:6379", NodeID: "m3", Nodes: map[string]*r.ClusterNode{
+			"m1": m1, "m2": m2, "m3": m3, "g2": g2, "g3": g3, "g4": g4, "g5": g5, "h1": h1}},
+		{Addr: "10.0.0.7:6379", Err: errors.New("connection refused")},
+	}
+	stales := findStaleNodes(views, time.Hour, now)
+	expected := []struct {
+		id      string
+		flags   string
+		knownBy int
+		refused string
+	}{
+		{"h1", "handshake", 3, "never answered a ping, it may be joining"},
+		{"g5", "fail", 1, "seen healthy by 10.0.0.2:6379,10.0.0.3:6379"},
+		{"g1", "fail", 2, ""},
+		{"g3", "fail", 3, "last pong 1m0s ago, not older than 1h0m0s"},
+		{"g4", "fail", 3, "owns 1 slots in the view of 10.0.0.1:6379"},
+		{"g2", "fail,noaddr", 3, ""},
+	}
+	if len(stales) != len(expected) {
+		t.Fatalf("findStaleNodes() returned %d nodes, want %d", len(stales), len(expected))
+	}
+	for n, e := range expected {
+		s := stales[n]
+		flags := ""
+		for k, f := range s.Flags {
+			if k > 0 {
+				flags += ","
+			}
+			flags += f
+		}
+		if s.NodeID != e.id || flags != e.flags || len(s.KnownBy) != e.knownBy || s.Refused != e.refused {
+			t.Errorf("stales[%d] = %s %s %d %q, want %s %s %d %q", n, s.NodeID, flags, len(s.KnownBy), s.Refused,
+				e.id, e.flags, e.knownBy, e.refused)
+		}
+	}
+	if stales[5].Age != -1 {
+		t.Errorf("age of g2 = %v, want -1", stales[5].Age)
+	}
+}
+
+func TestFindStaleNodesMasterOfViewer(t *testing.T) {
+	views := []*nodeView{{Addr: "10.0.0.1:6379", NodeID: "m1", Nodes: map[string]*r.ClusterNode{
+		"m1": {NodeID: "m1", Addr: "10.0.0.1:6379", Role: "slave", MasterID: "g1", Flags: []string{"slave"}},
+		"m2": {NodeID: "m2", Addr: "10.0.0.2:6379", Role: "master", Flags: []string{"master"},
+			Slots: []*r.SlotRange{{Start: 5461, End: 10922, SlotCount: 5462}}},
+		"m3": {NodeID: "m3", Addr: "10.0.0.3:6379", Role: "master", Flags: []string{"master"},
+			Slots: []*r.SlotRange{{Start: 10923, End: 16383, SlotCount: 5461}}},
+		"g1": {NodeID: "g1", Addr: "10.0.0.7:6379", Role: "master", Flags: []string{"master", "fail"}},
+	}}}
+	stales := findStaleNodes(views, time.Hour, time.Now())
+	if len(stales) != 1 || stales[0].Refused != "is the master of 10.0.0.1:6379" {
+		t.Fatalf("findStaleNodes() = %+v, want g1 refused as master of 10.0.0.1:6379", stales)
+	}
+}
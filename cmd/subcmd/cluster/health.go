@@ -0,0 +1,213 @@
+package cluster
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+	"redis-cluster-manager/config"
+	r "redis-cluster-manager/redis"
+	"redis-cluster-manager/vars"
+	"strings"
+)
+
+// exit codes of monitoring plugins
+const (
+	healthOK = iota
+	healthWarning
+	healthCritical
+	healthUnknown
+)
+
+var healthStatusNames = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+// healthThresholds are the warning and critical thresholds of `cluster health`
+type healthThresholds struct {
+	MemWarn, MemCrit         float64 // used_memory percentage of maxmemory
+	ClientsWarn, ClientsCrit float64 // connected_clients percentage of maxclients
+	LagWarn, LagCrit         int64   // replication lag in bytes
+	MinReplicas              int     // healthy replicas a master should have
+	MissingWarn, MissingCrit int     // masters with less than MinReplicas healthy replicas
+}
+
+var thresholds = healthThresholds{
+	MemWarn: 80, MemCrit: 90,
+	ClientsWarn: 80, ClientsCrit: 90,
+	LagWarn: 1 << 20, LagCrit: 64 << 20,
+	MinReplicas: 1, MissingWarn: 1, MissingCrit: 0,
+}
+
+var HealthCmd = &cobra.Command{
+	Use:   "health",
+	Short: "Check cluster health as a monitoring plugin",
+	Long: `Check the cluster like a Nagios/Icinga plugin: print a one-line summary followed by perfdata and exit with
+0 (OK), 1 (WARNING), 2 (CRITICAL) or 3 (UNKNOWN). Slots not served by a healthy master and a failed cluster state are
+critical, unreachable nodes and slaves with a broken link are warnings. Memory, clients, replication lag and masters
+missing replicas are compared with the thresholds, a threshold of 0 is disabled.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			exitHealth(healthUnknown, fmt.Sprintf("accepts 1 arg, received %d", len(args)), "")
+		}
+		return nil
+	},
+	Example: fmt.Sprintf("%s cluster health <seed-node> -a \"password\" [--mem-warn 80] [--mem-crit 90] [--lag-crit 67108864]", vars.AppName),
+	// errors of the root PersistentPreRunE (profile, credentials, TLS) are UNKNOWN instead of exiting with 1
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := cmd.Root().PersistentPreRunE(cmd, args); err != nil {
+			exitHealth(healthUnknown, err.Error(), "")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		vars.HostPort = config.ResolveSeed(args[0])
+		report, err := StatusReportOf(vars.HostPort)
+		if err != nil {
+			exitHealth(healthUnknown, err.Error(), "")
+		}
+		result := evaluateHealth(report, thresholds)
+		exitHealth(result.Status, result.Summary, strings.Join(result.Perfdata, " "))
+	},
+}
+
+func InitHealth() {
+	HealthCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		exitHealth(healthUnknown, err.Error(), "")
+		return nil
+	})
+	HealthCmd.Flags().Float64Var(&thresholds.MemWarn, "mem-warn", thresholds.MemWarn, "used_memory percentage of maxmemory for a warning")
+	HealthCmd.Flags().Float64Var(&thresholds.MemCrit, "mem-crit", thresholds.MemCrit, "used_memory percentage of maxmemory for a critical")
+	HealthCmd.Flags().Float64Var(&thresholds.ClientsWarn, "clients-warn", thresholds.ClientsWarn, "connected_clients percentage of maxclients for a warning")
+	HealthCmd.Flags().Float64Var(&thresholds.ClientsCrit, "clients-crit", thresholds.ClientsCrit, "connected_clients percentage of maxclients for a critical")
+	HealthCmd.Flags().Int64Var(&thresholds.LagWarn, "lag-warn", thresholds.LagWarn, "replication lag in bytes for a warning")
+	HealthCmd.Flags().Int64Var(&thresholds.LagCrit, "lag-crit", thresholds.LagCrit, "replication lag in bytes for a critical")
+	HealthCmd.Flags().IntVar(&thresholds.MinReplicas, "min-replicas", thresholds.MinReplicas, "healthy replicas a master should have")
+	HealthCmd.Flags().IntVar(&thresholds.MissingWarn, "missing-warn", thresholds.MissingWarn, "masters with less than --min-replicas healthy replicas for a warning")
+	HealthCmd.Flags().IntVar(&thresholds.MissingCrit, "missing-crit", thresholds.MissingCrit, "masters with less than --min-replicas healthy replicas for a critical")
+}
+
+// exitHealth prints the plugin output and exits with status
+func exitHealth(status int, summary, perfdata string) {
+	line := fmt.Sprintf("RCM CLUSTER %s - %s", healthStatusNames[status], summary)
+	if perfdata != "" {
+		line += " | " + perfdata
+	}
+	fmt.Println(line)
+	os.Exit(status)
+}
+
+type healthResult struct {
+	Status   int
+	Summary  string
+	Perfdata []string
+}
+
+// evaluateHealth compares the status report with the thresholds, the summary lists the problems of the worst status
+// first, or the size of the cluster if there is none
+func evaluateHealth(report *StatusReport, t healthThresholds) healthResult {
+	var (
+		criticals, warnings []string
+		slotsOK             int
+		memMax, clientsMax  float64
+		memNode, clientNode string
+		lagMax              int64
+		lagNode             string
+		missing, linkDown   int
+		nodes               int
+	)
+	for _, shard := range report.Shards {
+		nodes += len(shard.Nodes)
+		if len(shard.Nodes) == 0 || shard.Nodes[0].Role != "master" {
+			continue
+		}
+		master := shard.Nodes[0]
+		if master.Reachable && !master.Loading && master.Health == "online" {
+			slotsOK += shard.Slots
+		}
+		healthyReplicas := 0
+		for _, n := range shard.Nodes {
+			if !n.Reachable || n.Loading {
+				continue
+			}
+			if n.MaxMemory > 0 {
+				if mem := float64(n.UsedMemory) / float64(n.MaxMemory) * 100; mem > memMax {
+					memMax, memNode = mem, n.Addr
+				}
+			}
+			if n.MaxClients > 0 {
+				if clients := float64(n.Clients) / float64(n.MaxClients) * 100; clients > clientsMax {
+					clientsMax, clientNode = clients, n.Addr
+				}
+			}
+			if n.Role != "slave" {
+				continue
+			}
+			if n.Link != "up" {
+				linkDown++
+				continue
+			}
+			if n.LagBytes > lagMax {
+				lagMax, lagNode = n.LagBytes, n.Addr
+			}
+			if !n.SlaveInit && n.Health == "online" {
+				healthyReplicas++
+			}
+		}
+		if shard.Slots > 0 && healthyReplicas < t.MinReplicas {
+			missing++
+		}
+	}
+
+	if report.State != "ok" {
+		criticals = append(criticals, fmt.Sprintf("cluster_state is %s", report.State))
+	}
+	if slotsOK < r.ClusterSlots {
+		criticals = append(criticals, fmt.Sprintf("%d slots not served by a healthy master", r.ClusterSlots-slotsOK))
+	}
+	if len(report.ErrorNodes) > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d nodes unreachable", len(report.ErrorNodes)))
+	}
+	if linkDown > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d slaves with master link down", linkDown))
+	}
+	classify := func(value, warn, crit float64, problem string) {
+		switch {
+		case crit > 0 && value >= crit:
+			criticals = append(criticals, problem)
+		case warn > 0 && value >= warn:
+			warnings = append(warnings, problem)
+		}
+	}
+	classify(memMax, t.MemWarn, t.MemCrit, fmt.Sprintf("memory %.1f%% on %s", memMax, memNode))
+	classify(clientsMax, t.ClientsWarn, t.ClientsCrit, fmt.Sprintf("clients %.1f%% on %s", clientsMax, clientNode))
+	classify(float64(lagMax), float64(t.LagWarn), float64(t.LagCrit), fmt.Sprintf("replication lag %dB on %s", lagMax, lagNode))
+	classify(float64(missing), float64(t.MissingWarn), float64(t.MissingCrit), fmt.Sprintf("%d masters with less than %d healthy replicas", missing, t.MinReplicas))
+
+	result := healthResult{Status: healthOK, Perfdata: []string{
+		fmt.Sprintf("slots_ok=%d;;%d:;0;%d", slotsOK, r.ClusterSlots, r.ClusterSlots),
+		fmt.Sprintf("nodes=%d", nodes),
+		fmt.Sprintf("unreachable=%d;0", len(report.ErrorNodes)),
+		fmt.Sprintf("lag_max=%dB;%s;%s;0", lagMax, threshold(float64(t.LagWarn)), threshold(float64(t.LagCrit))),
+		fmt.Sprintf("mem_max=%.1f%%;%s;%s;0;100", memMax, threshold(t.MemWarn), threshold(t.MemCrit)),
+		fmt.Sprintf("clients_max=%.1f%%;%s;%s;0;100", clientsMax, threshold(t.ClientsWarn), threshold(t.ClientsCrit)),
+		fmt.Sprintf("missing_replicas=%d;%s;%s;0", missing, threshold(float64(t.MissingWarn)), threshold(float64(t.MissingCrit))),
+	}}
+	switch {
+	case len(criticals) > 0:
+		result.Status = healthCritical
+	case len(warnings) > 0:
+		result.Status = healthWarning
+	}
+	if problems := append(criticals, warnings...); len(problems) > 0 {
+		result.Summary = strings.Join(problems, ", ")
+	} else {
+		result.Summary = fmt.Sprintf("%d slots served by %d masters, %d nodes", slotsOK, report.UpMasters, nodes)
+	}
+	return result
+}
+
+// threshold formats a threshold of perfdata, empty if disabled
+func threshold(v float64) string {
+	if v <= 0 {
+		return ""
+	}
+	return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%f", v), "0"), ".")
+}
@@ -0,0 +1,104 @@
+package cluster
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEvaluateHealth(t *testing.T) {
+	tests := []struct {
+		name     string
+		report   *StatusReport
+		status   int
+		summary  []string
+		perfdata []string
+	}{
+		{
+			name: "all healthy",
+			report: &StatusReport{State: "ok", UpMasters: 2, Shards: []ShardReport{
+				{Slots: 8192, Nodes: []NodeReport{
+					{Addr: "127.0.0.1:7000", Role: "master", Health: "online", Reachable: true, UsedMemoryGB: 1, MaxMemoryGB: 4, UsedMemory: 1 << 30, MaxMemory: 4 << 30, Clients: 10, MaxClients: 1000},
+					{Addr: "127.0.0.1:7002", Role: "slave", Health: "online", Reachable: true, Link: "up", UsedMemoryGB: 1, MaxMemoryGB: 4, UsedMemory: 1 << 30, MaxMemory: 4 << 30, Clients: 10, MaxClients: 1000},
+				}},
+				{Slots: 8192, Nodes: []NodeReport{
+					{Addr: "127.0.0.1:7001", Role: "master", Health: "online", Reachable: true, UsedMemoryGB: 1, MaxMemoryGB: 4, UsedMemory: 1 << 30, MaxMemory: 4 << 30, Clients: 10, MaxClients: 1000},
+					{Addr: "127.0.0.1:7003", Role: "slave", Health: "online", Reachable: true, Link: "up", UsedMemoryGB: 1, MaxMemoryGB: 4, UsedMemory: 1 << 30, MaxMemory: 4 << 30, Clients: 10, MaxClients: 1000},
+				}},
+			}},
+			status:   healthOK,
+			perfdata: []string{"slots_ok=16384;", "unreachable=0;", "lag_max=0B;", "mem_max=25.0%;80;90;0;100"},
+		},
+		{
+			name: "unreachable node, link down and lag",
+			report: &StatusReport{State: "ok", UpMasters: 2, ErrorNodes: []NodeError{{Addr: "127.0.0.1:7004"}}, Shards: []ShardReport{
+				{Slots: 8192, Nodes: []NodeReport{
+					{Addr: "127.0.0.1:7000", Role: "master", Health: "online", Reachable: true, UsedMemoryGB: 1, MaxMemoryGB: 4, UsedMemory: 1 << 30, MaxMemory: 4 << 30, Clients: 10, MaxClients: 1000},
+					{Addr: "127.0.0.1:7002", Role: "slave", Health: "online", Reachable: true, Link: "up", LagBytes: 2 << 20, UsedMemoryGB: 1, MaxMemoryGB: 4, UsedMemory: 1 << 30, MaxMemory: 4 << 30, Clients: 10, MaxClients: 1000},
+				}},
+				{Slots: 8192, Nodes: []NodeReport{
+					{Addr: "127.0.0.1:7001", Role: "master", Health: "online", Reachable: true, UsedMemoryGB: 1, MaxMemoryGB: 4, UsedMemory: 1 << 30, MaxMemory: 4 << 30, Clients: 10, MaxClients: 1000},
+					{Addr: "127.0.0.1:7003", Role: "slave", Health: "online", Reachable: true, Link: "down", UsedMemoryGB: 1, MaxMemoryGB: 4, UsedMemory: 1 << 30, MaxMemory: 4 << 30, Clients: 10, MaxClients: 1000},
+				}},
+			}},
+			status:  healthWarning,
+			summary: []string{"1 nodes unreachable", "1 slaves with master link down", "replication lag 2097152B on 127.0.0.1:7002", "1 masters with less than 1 healthy replicas"},
+		},
+		{
+			name: "master unreachable and memory full",
+			report: &StatusReport{State: "ok", UpMasters: 2, ErrorNodes: []NodeError{{Addr: "127.0.0.1:7004"}}, Shards: []ShardReport{
+				{Slots: 8192, Nodes: []NodeReport{
+					{Addr: "127.0.0.1:7000", Role: "master", Health: "online", Reachable: true, UsedMemoryGB: 3.8, MaxMemoryGB: 4, UsedMemory: 4 << 30 * 95 / 100, MaxMemory: 4 << 30, Clients: 10, MaxClients: 1000},
+					{Addr: "127.0.0.1:7002", Role: "slave", Health: "online", Reachable: true, Link: "up", LagBytes: 2 << 20, UsedMemoryGB: 1, MaxMemoryGB: 4, UsedMemory: 1 << 30, MaxMemory: 4 << 30, Clients: 10, MaxClients: 1000},
+				}},
+				{Slots: 8192, Nodes: []NodeReport{
+					{Addr: "127.0.0.1:7001", Role: "master", Health: "online", Reachable: false, UsedMemoryGB: 1, MaxMemoryGB: 4, UsedMemory: 1 << 30, MaxMemory: 4 << 30, Clients: 10, MaxClients: 1000},
+					{Addr: "127.0.0.1:7003", Role: "slave", Health: "online", Reachable: true, Link: "down", UsedMemoryGB: 1, MaxMemoryGB: 4, UsedMemory: 1 << 30, MaxMemory: 4 << 30, Clients: 10, MaxClients: 1000},
+				}},
+			}},
+			status:  healthCritical,
+			summary: []string{"8192 slots not served by a healthy master, memory 95.0% on 127.0.0.1:7000"},
+		},
+		{
+			// 95MB of 100MB is 0.09GB of 0.1GB once rounded, the percentage is taken from the bytes
+			name: "small maxmemory",
+			report: &StatusReport{State: "ok", UpMasters: 2, Shards: []ShardReport{
+				{Slots: 8192, Nodes: []NodeReport{
+					{Addr: "127.0.0.1:7000", Role: "master", Health: "online", Reachable: true, UsedMemoryGB: 0.09, MaxMemoryGB: 0.1, UsedMemory: 95 << 20, MaxMemory: 100 << 20, Clients: 10, MaxClients: 1000},
+					{Addr: "127.0.0.1:7002", Role: "slave", Health: "online", Reachable: true, Link: "up", UsedMemoryGB: 1, MaxMemoryGB: 4, UsedMemory: 1 << 30, MaxMemory: 4 << 30, Clients: 10, MaxClients: 1000},
+				}},
+				{Slots: 8192, Nodes: []NodeReport{
+					{Addr: "127.0.0.1:7001", Role: "master", Health: "online", Reachable: true, UsedMemoryGB: 1, MaxMemoryGB: 4, UsedMemory: 1 << 30, MaxMemory: 4 << 30, Clients: 10, MaxClients: 1000},
+					{Addr: "127.0.0.1:7003", Role: "slave", Health: "online", Reachable: true, Link: "up", UsedMemoryGB: 1, MaxMemoryGB: 4, UsedMemory: 1 << 30, MaxMemory: 4 << 30, Clients: 10, MaxClients: 1000},
+				}},
+			}},
+			status:  healthCritical,
+			summary: []string{"memory 95.0% on 127.0.0.1:7000"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := evaluateHealth(tt.report, thresholds)
+			if result.Status != tt.status {
+				t.Fatalf("evaluateHealth() = %+v, want %d", result, tt.status)
+			}
+			for _, want := range tt.summary {
+				if !strings.Contains(result.Summary, want) {
+					t.Errorf("summary %s does not contain %s", result.Summary, want)
+				}
+			}
+			perfdata := strings.Join(result.Perfdata, " ")
+			for _, want := range tt.perfdata {
+				if !strings.Contains(perfdata, want) {
+					t.Errorf("perfdata %s does not contain %s", perfdata, want)
+				}
+			}
+		})
+	}
+}
+
+func TestThreshold(t *testing.T) {
+	if threshold(80) != "80" || threshold(0.5) != "0.5" || threshold(0) != "" {
+		t.Fatalf("threshold() = %s, %s, %s", threshold(80), threshold(0.5), threshold(0))
+	}
+}
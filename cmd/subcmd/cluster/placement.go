@@ -0,0 +1,525 @@
+package cluster
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"os"
+	"redis-cluster-manager/config"
+	"redis-cluster-manager/perf"
+	r "redis-cluster-manager/redis"
+	"redis-cluster-manager/vars"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	locationFile      string        // file of ip -> rack/zone mapping
+	maxMastersPerHost int           // max masters allowed on one host, 0 means ceil(masters/hosts)
+	syncTimeout       time.Duration // max time to wait for a moved slave to finish it's full sync
+)
+
+var PlacementCmd = &cobra.Command{
+	Use:   "placement",
+	Short: "Audit where masters and slaves physically run",
+	Long: `Check the anti-affinity of masters and slaves: copies of a shard on the same host, too many masters on one host
+and uneven slave counts per master. With a location file (one "<ip> <rack> <zone>" per line, # for comments)
+rack- and zone-level anti-affinity are checked too.
+CLUSTER REPLICATE moves and, for hosts running too many masters, CLUSTER FAILOVER to slaves on other hosts are
+suggested to fix the violations, and applied one by one with --apply.`,
+	Args: cobra.ExactArgs(1),
+	Example: fmt.Sprintf("%s cluster placement <seed-node> -a \"password\" [-l locations.txt] [--apply]",
+		vars.AppName),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vars.HostPort = config.ResolveSeed(args[0])
+		f := perf.StartCpuProfile()
+		defer perf.StopCpuProfile(f)
+		if err := printPlacementAudit(vars.HostPort); err != nil {
+			return err
+		}
+		perf.MemProfile()
+		return nil
+	},
+}
+
+func InitPlacement() {
+	PlacementCmd.Flags().StringVarP(&locationFile, "location-file", "l", "", "file of \"<ip> <rack> <zone>\" lines")
+	PlacementCmd.Flags().IntVar(&maxMastersPerHost, "max-masters-per-host", 0, "max masters allowed on one host, default ceil(masters/hosts)")
+	PlacementCmd.Flags().BoolVar(&applyPlan, "apply", false, "apply the suggested moves")
+	PlacementCmd.Flags().DurationVar(&failoverTimeout, "failover-timeout", time.Second*30, "max time to wait for each failover")
+	PlacementCmd.Flags().DurationVar(&syncTimeout, "sync-timeout", time.Minute*30, "max time to wait for each moved slave to finish full sync")
+}
+
+// location is where a host is placed
+type location struct {
+	Rack string
+	Zone string
+}
+
+// loadLocations reads "<ip> <rack> <zone>" lines from path
+func loadLocations(path string) (map[string]location, error) {
+	locations := make(map[string]location)
+	if path == "" {
+		return locations, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open location file: %v", err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("invalid location file line %d: %s", lineNo, line)
+		}
+		locations[fields[0]] = location{Rack: fields[1], Zone: fields[2]}
+	}
+	return locations, scanner.Err()
+}
+
+// conflict levels between two copies of a shard, the larger the worse
+const (
+	conflictNone = iota
+	conflictZone
+	conflictRack
+	conflictHost
+)
+
+var conflictNames = map[int]string{conflictZone: "zone", conflictRack: "rack", conflictHost: "host"}
+
+// placement is the master/slave assignment of a cluster, the moves are planned on it
+type placement struct {
+	masters   []*r.ClusterNode  // masters serving slots, sorted by addr
+	slaves    []*r.ClusterNode  // slaves sorted by addr
+	assign    map[string]string // slave nodeID -> master nodeID
+	nodes     map[string]*r.ClusterNode
+	locations map[string]location
+}
+
+// replicaMove is a suggested `cluster replicate` on Slave to make it a slave of To, or a `cluster failover` on Slave
+// to promote it over it's master From if Failover is set
+type replicaMove struct {
+	Slave    *r.ClusterNode
+	From     *r.ClusterNode
+	To       *r.ClusterNode
+	Failover bool
+	Reason   string
+}
+
+func newPlacement(clusterNodes []*r.ClusterNode, locations map[string]location) *placement {
+	p := &placement{
+		assign:    make(map[string]string),
+		nodes:     make(map[string]*r.ClusterNode),
+		locations: locations,
+	}
+	for _, n := range clusterNodes {
+		p.nodes[n.NodeID] = n
+	}
+	for _, n := range clusterNodes {
+		if n.HasFlag("fail") || n.HasFlag("noaddr") || n.HasFlag("handshake") {
+			continue
+		}
+		if n.Role == "master" && n.GetSlotCount() > 0 {
+			p.masters = append(p.masters, n)
+		}
+	}
+	for _, n := range clusterNodes {
+		if n.Role != "slave" || n.HasFlag("fail") || n.HasFlag("noaddr") || n.HasFlag("handshake") {
+			continue
+		}
+		if m, exists := p.nodes[n.MasterID]; exists && m.GetSlotCount() > 0 {
+			p.slaves = append(p.slaves, n)
+			p.assign[n.NodeID] = n.MasterID
+		}
+	}
+	sort.Slice(p.masters, func(i, j int) bool { return r.CompareAddr(p.masters[i].Addr, p.masters[j].Addr) < 0 })
+	sort.Slice(p.slaves, func(i, j int) bool { return r.CompareAddr(p.slaves[i].Addr, p.slaves[j].Addr) < 0 })
+	return p
+}
+
+// conflict returns how close two nodes are placed
+func (p *placement) conflict(a, b *r.ClusterNode) int {
+	if a.Host() == b.Host() {
+		return conflictHost
+	}
+	la, okA := p.locations[a.Host()]
+	lb, okB := p.locations[b.Host()]
+	if !okA || !okB {
+		return conflictNone
+	}
+	if la.Zone == lb.Zone && la.Rack == lb.Rack {
+		return conflictRack
+	}
+	if la.Zone == lb.Zone {
+		return conflictZone
+	}
+	return conflictNone
+}
+
+// slavesOf returns current slaves of master, except the ones in excluded
+func (p *placement) slavesOf(masterID string, excluded ...*r.ClusterNode) []*r.ClusterNode {
+	var slaves []*r.ClusterNode
+	for _, s := range p.slaves {
+		if p.assign[s.NodeID] != masterID {
+			continue
+		}
+		skip := false
+		for _, e := range excluded {
+			skip = skip || e.NodeID == s.NodeID
+		}
+		if !skip {
+			slaves = append(slaves, s)
+		}
+	}
+	return slaves
+}
+
+// shardConflict returns the worst conflict between slave and the other copies of the shard of master
+func (p *placement) shardConflict(slave *r.ClusterNode, masterID string, excluded ...*r.ClusterNode) int {
+	worst := p.conflict(slave, p.nodes[masterID])
+	for _, s := range p.slavesOf(masterID, append(excluded, slave)...) {
+		worst = max(worst, p.conflict(slave, s))
+	}
+	return worst
+}
+
+func (p *placement) move(slave *r.ClusterNode, toID, reason string) replicaMove {
+	m := replicaMove{Slave: slave, From: p.nodes[p.assign[slave.NodeID]], To: p.nodes[toID], Reason: reason}
+	p.assign[slave.NodeID] = toID
+	return m
+}
+
+// failover promotes slave over it's master, the master and the other slaves become slaves of it
+func (p *placement) failover(slave *r.ClusterNode, reason string) replicaMove {
+	master := p.nodes[p.assign[slave.NodeID]]
+	for n := range p.masters {
+		if p.masters[n] == master {
+			p.masters[n] = slave
+		}
+	}
+	for n := range p.slaves {
+		if p.slaves[n] == slave {
+			p.slaves[n] = master
+		}
+	}
+	for id, masterID := range p.assign {
+		if masterID == master.NodeID {
+			p.assign[id] = slave.NodeID
+		}
+	}
+	delete(p.assign, slave.NodeID)
+	p.assign[master.NodeID] = slave.NodeID
+	sort.Slice(p.masters, func(i, j int) bool { return r.CompareAddr(p.masters[i].Addr, p.masters[j].Addr) < 0 })
+	sort.Slice(p.slaves, func(i, j int) bool { return r.CompareAddr(p.slaves[i].Addr, p.slaves[j].Addr) < 0 })
+	return replicaMove{Slave: slave, From: master, To: slave, Failover: true, Reason: reason}
+}
+
+// hostMasters returns the masters count of every host running a node, and maxMasters or it's default
+// ceil(masters/hosts) if it's 0. hosts running only slaves count, so that masters can be spread to them
+func (p *placement) hostMasters(maxMasters int) (map[string]int, int) {
+	hostMasters := make(map[string]int)
+	for _, n := range p.nodes {
+		if !n.HasFlag("fail") && !n.HasFlag("noaddr") && !n.HasFlag("handshake") {
+			hostMasters[n.Host()] += 0
+		}
+	}
+	for _, m := range p.masters {
+		hostMasters[m.Host()]++
+	}
+	if maxMasters <= 0 && len(hostMasters) > 0 {
+		maxMasters = (len(p.masters) + len(hostMasters) - 1) / len(hostMasters)
+	}
+	return hostMasters, maxMasters
+}
+
+// audit returns the violations found in current placement
+func (p *placement) audit(maxMasters int) []string {
+	var violations []string
+	for _, s := range p.slaves {
+		masterID := p.assign[s.NodeID]
+		if c := p.conflict(s, p.nodes[masterID]); c != conflictNone {
+			violations = append(violations, fmt.Sprintf("slave %s and it's master %s are on the same %s",
+				s.Addr, p.nodes[masterID].Addr, conflictNames[c]))
+		}
+		for _, sibling := range p.slavesOf(masterID, s) {
+			if c := p.conflict(s, sibling); c != conflictNone && s.Addr < sibling.Addr {
+				violations = append(violations, fmt.Sprintf("slaves %s and %s of master %s are on the same %s",
+					s.Addr, sibling.Addr, p.nodes[masterID].Addr, conflictNames[c]))
+			}
+		}
+	}
+	hostMasters, maxMasters := p.hostMasters(maxMasters)
+	var hosts []string
+	for host := range hostMasters {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		if hostMasters[host] > maxMasters {
+			violations = append(violations, fmt.Sprintf("host %s runs %d masters, more than %d",
+				host, hostMasters[host], maxMasters))
+		}
+	}
+	lo, hi := p.slaveCountRange()
+	if hi-lo > 1 || (lo == 0 && hi > 0) {
+		for _, m := range p.masters {
+			if n := len(p.slavesOf(m.NodeID)); n == lo {
+				violations = append(violations, fmt.Sprintf("master %s has %d slaves, while others have up to %d",
+					m.Addr, n, hi))
+			}
+		}
+	}
+	return violations
+}
+
+// slaveCountRange returns the min and max slave count of all masters
+func (p *placement) slaveCountRange() (int, int) {
+	lo, hi := -1, 0
+	for _, m := range p.masters {
+		n := len(p.slavesOf(m.NodeID))
+		if lo == -1 || n < lo {
+			lo = n
+		}
+		hi = max(hi, n)
+	}
+	return max(lo, 0), hi
+}
+
+// planMasterSpread plans failovers of masters on hosts running more than maxMasters masters, each to a slave on the
+// host running the fewest masters, as long as that host stays within maxMasters
+func (p *placement) planMasterSpread(maxMasters int) []replicaMove {
+	hostMasters, maxMasters := p.hostMasters(maxMasters)
+	var moves []replicaMove
+	for {
+		var (
+			best      *r.ClusterNode
+			bestCount int
+		)
+		for _, m := range p.masters {
+			if hostMasters[m.Host()] <= maxMasters {
+				continue
+			}
+			for _, s := range p.slavesOf(m.NodeID) {
+				if count := hostMasters[s.Host()]; count < maxMasters && (best == nil || count < bestCount) {
+					best, bestCount = s, count
+				}
+			}
+		}
+		if best == nil {
+			return moves
+		}
+		from := p.nodes[p.assign[best.NodeID]]
+		moves = append(moves, p.failover(best, fmt.Sprintf("host %s runs %d masters, more than %d",
+			from.Host(), hostMasters[from.Host()], maxMasters)))
+		hostMasters[from.Host()]--
+		hostMasters[best.Host()]++
+	}
+}
+
+// planAntiAffinity plans moves for slaves which share a host/rack/zone with another copy of their shard.
+// a slave is moved to a better placed master if that keeps the slave counts balanced, otherwise it is swapped
+// with a slave of that master
+func (p *placement) planAntiAffinity() []replicaMove {
+	var moves []replicaMove
+	for _, s := range p.slaves {
+		from := p.assign[s.NodeID]
+		current := p.shardConflict(s, from)
+		if current == conflictNone {
+			continue
+		}
+		reason := fmt.Sprintf("same %s as another copy of shard %s", conflictNames[current], p.nodes[from].Addr)
+		var (
+			bestMove    *r.ClusterNode
+			bestSwap    *r.ClusterNode
+			bestSwapTo  *r.ClusterNode
+			bestScore   = current
+			bestSwapSum = 2 * current
+		)
+		fromCount := len(p.slavesOf(from))
+		for _, m := range p.masters {
+			if m.NodeID == from {
+				continue
+			}
+			c := p.shardConflict(s, m.NodeID)
+			count := len(p.slavesOf(m.NodeID))
+			if c < bestScore && fromCount-1 >= count {
+				bestMove, bestScore = m, c
+			}
+			// try to swap s with x, a slave of m
+			for _, x := range p.slavesOf(m.NodeID) {
+				newS := p.shardConflict(s, m.NodeID, x)
+				newX := p.shardConflict(x, from, s)
+				oldX := p.shardConflict(x, m.NodeID)
+				if newS < current && newX <= oldX && newS+newX < bestSwapSum {
+					bestSwap, bestSwapTo, bestSwapSum = x, m, newS+newX
+				}
+			}
+		}
+		if bestMove != nil {
+			moves = append(moves, p.move(s, bestMove.NodeID, reason))
+		} else if bestSwap != nil {
+			moves = append(moves, p.move(s, bestSwapTo.NodeID, reason))
+			moves = append(moves, p.move(bestSwap, from, fmt.Sprintf("swapped with %s", s.Addr)))
+		}
+	}
+	return moves
+}
+
+// planBalance plans moves from masters with the most slaves to masters with the fewest,
+// until slave counts differ by at most one. no move will put two copies of a shard on the same host
+func (p *placement) planBalance() []replicaMove {
+	var moves []replicaMove
+	for {
+		byCount := make([]*r.ClusterNode, len(p.masters))
+		copy(byCount, p.masters)
+		sort.SliceStable(byCount, func(i, j int) bool {
+			return len(p.slavesOf(byCount[i].NodeID)) < len(p.slavesOf(byCount[j].NodeID))
+		})
+		if len(byCount) == 0 {
+			return moves
+		}
+		lo := len(p.slavesOf(byCount[0].NodeID))
+		hi := len(p.slavesOf(byCount[len(byCount)-1].NodeID))
+		if hi-lo <= 1 {
+			return moves
+		}
+		var (
+			best      *r.ClusterNode
+			bestTo    *r.ClusterNode
+			bestScore = conflictHost
+		)
+		for _, to := range byCount {
+			if len(p.slavesOf(to.NodeID)) != lo {
+				continue
+			}
+			for _, from := range byCount {
+				if len(p.slavesOf(from.NodeID)) != hi {
+					continue
+				}
+				for _, s := range p.slavesOf(from.NodeID) {
+					if c := p.shardConflict(s, to.NodeID); c < bestScore {
+						best, bestTo, bestScore = s, to, c
+					}
+				}
+			}
+		}
+		if best == nil {
+			// every candidate would break host anti-affinity
+			return moves
+		}
+		moves = append(moves, p.move(best, bestTo.NodeID, fmt.Sprintf("balance slaves: %d -> %d", hi, lo)))
+	}
+}
+
+func printPlacementAudit(hostPort string) error {
+	locations, err := loadLocations(locationFile)
+	if err != nil {
+		return err
+	}
+	seedNode, err := NewSeedNode(hostPort)
+	if err != nil {
+		return err
+	}
+	defer seedNode.Close()
+	if !seedNode.ClusterEnabled {
+		return fmt.Errorf("seed node %s is not a cluster node", seedNode.Addr)
+	}
+	clusterNodes, err := r.GetClusterNodes(seedNode.Client)
+	if err != nil {
+		return err
+	}
+	p := newPlacement(clusterNodes, locations)
+	for _, n := range clusterNodes {
+		if _, exists := locations[n.Host()]; len(locations) > 0 && !exists {
+			color.Yellow("host %s of node %s is not found in location file\n", n.Host(), n.Addr)
+		}
+	}
+	violations := p.audit(maxMastersPerHost)
+	if len(violations) == 0 {
+		color.Green("No placement violation found.")
+		return nil
+	}
+	color.Cyan("Violations: %d\n", len(violations))
+	for _, v := range violations {
+		color.Red("  %s\n", v)
+	}
+	// masters are spread first, the slave moves are planned on the topology after the failovers
+	moves := p.planMasterSpread(maxMastersPerHost)
+	moves = append(moves, p.planAntiAffinity()...)
+	moves = append(moves, p.planBalance()...)
+	return printAndApplyMoves(moves)
+}
+
+// printAndApplyMoves prints moves as `cluster replicate` and `cluster failover` commands and applies them one by one
+// if applyPlan is set
+func printAndApplyMoves(moves []replicaMove) error {
+	if len(moves) == 0 {
+		color.Yellow("No move can fix the violations.")
+		return nil
+	}
+	color.Cyan("Suggested moves: %d\n", len(moves))
+	for _, m := range moves {
+		if m.Failover {
+			fmt.Printf("  on %-24s CLUSTER FAILOVER  # promote over %s, %s\n", m.Slave.Addr, m.From.Addr, m.Reason)
+			continue
+		}
+		fmt.Printf("  on %-24s CLUSTER REPLICATE %s  # %s -> %s, %s\n", m.Slave.Addr, m.To.NodeID, m.From.Addr, m.To.Addr, m.Reason)
+	}
+	if !applyPlan {
+		color.Cyan("Run with --apply to apply the moves.")
+		return nil
+	}
+	if err := config.CheckWritable("applying moves"); err != nil {
+		return err
+	}
+	for n, m := range moves {
+		if m.Failover {
+			color.Yellow("[%d/%d] Failing over %s to %s ...\n", n+1, len(moves), m.From.Addr, m.Slave.Addr)
+			if err := applyFailoverMove(m); err != nil {
+				return err
+			}
+			continue
+		}
+		color.Yellow("[%d/%d] Moving %s from %s to %s ...\n", n+1, len(moves), m.Slave.Addr, m.From.Addr, m.To.Addr)
+		slave, err := r.NewInstance(m.Slave.Addr)
+		if err != nil {
+			return err
+		}
+		if slave.SlaveInit || slave.LoadingError {
+			slave.Close()
+			return fmt.Errorf("slave %s is still in full sync, try again later", slave.Addr)
+		}
+		err = slave.Replicate(m.To.NodeID, m.To.Addr, syncTimeout)
+		slave.Close()
+		if err != nil {
+			return err
+		}
+	}
+	color.Cyan("Done!")
+	return nil
+}
+
+// applyFailoverMove promotes the slave of a failover move and waits until it's master has become it's slave
+func applyFailoverMove(m replicaMove) error {
+	master, err := r.NewInstance(m.From.Addr)
+	if err != nil {
+		return err
+	}
+	defer master.Close()
+	slave, err := r.NewInstance(m.Slave.Addr)
+	if err != nil {
+		return err
+	}
+	defer slave.Close()
+	if slave.SlaveInit || slave.LoadingError || slave.MasterLinkStatus != "up" {
+		return fmt.Errorf("slave %s is not in sync, try again later", slave.Addr)
+	}
+	return verifiedFailover(master, slave)
+}
@@ -0,0 +1,106 @@
+package cluster
+
+import (
+	r "redis-cluster-manager/redis"
+	"testing"
+)
+
+func slotsOf(n int) *r.SlotRange {
+	return &r.SlotRange{Start: 0, End: n - 1, SlotCount: n}
+}
+
+func TestPlanAntiAffinitySwapsSlaves(t *testing.T) {
+	nodes := []*r.ClusterNode{
+		{NodeID: "m1", Addr: "10.0.0.1:6379", Role: "master", Flags: []string{"master"}, Slots: []*r.SlotRange{slotsOf(100)}},
+		{NodeID: "m2", Addr: "10.0.0.2:6379", Role: "master", Flags: []string{"master"}, Slots: []*r.SlotRange{slotsOf(100)}},
+		{NodeID: "m3", Addr: "10.0.0.3:6379", Role: "master", Flags: []string{"master"}, Slots: []*r.SlotRange{slotsOf(100)}},
+		{NodeID: "s1", Addr: "10.0.0.1:6380", Role: "slave", MasterID: "m1", Flags: []string{"slave"}},
+		{NodeID: "s2", Addr: "10.0.0.3:6380", Role: "slave", MasterID: "m2", Flags: []string{"slave"}},
+		{NodeID: "s3", Addr: "10.0.0.2:6380", Role: "slave", MasterID: "m3", Flags: []string{"slave"}},
+	}
+	p := newPlacement(nodes, nil)
+	if violations := p.audit(0); len(violations) != 1 {
+		t.Fatalf("violations = %v, want 1", violations)
+	}
+	moves := p.planAntiAffinity()
+	if len(moves) != 2 {
+		t.Fatalf("len(moves) = %d, want 2", len(moves))
+	}
+	if moves[0].Slave.NodeID != "s1" || moves[0].To.NodeID == "m1" || moves[1].To.NodeID != "m1" {
+		t.Fatalf("unexpected moves: %+v %+v", moves[0], moves[1])
+	}
+	if violations := p.audit(0); len(violations) != 0 {
+		t.Fatalf("violations after moves = %v", violations)
+	}
+}
+
+func TestPlanAntiAffinityWithLocations(t *testing.T) {
+	nodes := []*r.ClusterNode{
+		{NodeID: "m1", Addr: "10.0.0.1:6379", Role: "master", Flags: []string{"master"}, Slots: []*r.SlotRange{slotsOf(100)}},
+		{NodeID: "m2", Addr: "10.0.1.1:6379", Role: "master", Flags: []string{"master"}, Slots: []*r.SlotRange{slotsOf(100)}},
+		{NodeID: "s1", Addr: "10.0.0.2:6380", Role: "slave", MasterID: "m1", Flags: []string{"slave"}},
+		{NodeID: "s2", Addr: "10.0.1.2:6380", Role: "slave", MasterID: "m2", Flags: []string{"slave"}},
+	}
+	locations := map[string]location{
+		"10.0.0.1": {Rack: "r1", Zone: "z1"},
+		"10.0.0.2": {Rack: "r1", Zone: "z1"},
+		"10.0.1.1": {Rack: "r2", Zone: "z2"},
+		"10.0.1.2": {Rack: "r2", Zone: "z2"},
+	}
+	p := newPlacement(nodes, locations)
+	if violations := p.audit(0); len(violations) != 2 {
+		t.Fatalf("violations = %v, want 2", violations)
+	}
+	if moves := p.planAntiAffinity(); len(moves) != 2 {
+		t.Fatalf("len(moves) = %d, want 2", len(moves))
+	}
+	if violations := p.audit(0); len(violations) != 0 {
+		t.Fatalf("violations after moves = %v", violations)
+	}
+}
+
+func TestPlanBalance(t *testing.T) {
+	nodes := []*r.ClusterNode{
+		{NodeID: "m1", Addr: "10.0.0.1:6379", Role: "master", Flags: []string{"master"}, Slots: []*r.SlotRange{slotsOf(100)}},
+		{NodeID: "m2", Addr: "10.0.0.2:6379", Role: "master", Flags: []string{"master"}, Slots: []*r.SlotRange{slotsOf(100)}},
+		{NodeID: "m3", Addr: "10.0.0.3:6379", Role: "master", Flags: []string{"master"}, Slots: []*r.SlotRange{slotsOf(100)}},
+		{NodeID: "s1a", Addr: "10.0.0.2:6380", Role: "slave", MasterID: "m1", Flags: []string{"slave"}},
+		{NodeID: "s1b", Addr: "10.0.0.3:6380", Role: "slave", MasterID: "m1", Flags: []string{"slave"}},
+		{NodeID: "s1c", Addr: "10.0.0.4:6380", Role: "slave", MasterID: "m1", Flags: []string{"slave"}},
+		{NodeID: "s3", Addr: "10.0.0.1:6381", Role: "slave", MasterID: "m3", Flags: []string{"slave"}},
+	}
+	p := newPlacement(nodes, nil)
+	moves := p.planBalance()
+	if len(moves) != 1 || moves[0].To.NodeID != "m2" || moves[0].Slave.Host() == "10.0.0.2" {
+		t.Fatalf("unexpected moves: %+v", moves)
+	}
+	if lo, hi := p.slaveCountRange(); lo != 1 || hi != 2 {
+		t.Fatalf("slave count range = [%d, %d], want [1, 2]", lo, hi)
+	}
+}
+
+func TestPlanMasterSpread(t *testing.T) {
+	nodes := []*r.ClusterNode{
+		{NodeID: "m1", Addr: "10.0.0.1:6379", Role: "master", Flags: []string{"master"}, Slots: []*r.SlotRange{slotsOf(100)}},
+		{NodeID: "m2", Addr: "10.0.0.1:6380", Role: "master", Flags: []string{"master"}, Slots: []*r.SlotRange{slotsOf(100)}},
+		{NodeID: "m3", Addr: "10.0.0.2:6379", Role: "master", Flags: []string{"master"}, Slots: []*r.SlotRange{slotsOf(100)}},
+		{NodeID: "s1", Addr: "10.0.0.2:6380", Role: "slave", MasterID: "m1", Flags: []string{"slave"}},
+		{NodeID: "s2", Addr: "10.0.0.3:6380", Role: "slave", MasterID: "m2", Flags: []string{"slave"}},
+		{NodeID: "s3", Addr: "10.0.0.3:6379", Role: "slave", MasterID: "m3", Flags: []string{"slave"}},
+	}
+	p := newPlacement(nodes, nil)
+	if violations := p.audit(1); len(violations) != 1 {
+		t.Fatalf("violations = %v, want 1", violations)
+	}
+	moves := p.planMasterSpread(1)
+	if len(moves) != 1 || !moves[0].Failover || moves[0].Slave.NodeID != "s2" || moves[0].From.NodeID != "m2" {
+		t.Fatalf("unexpected moves: %+v", moves)
+	}
+	// m2 is a slave of s2 after the failover
+	if p.assign["m2"] != "s2" || len(p.slavesOf("s2")) != 1 {
+		t.Fatalf("assign = %v after failover", p.assign)
+	}
+	if violations := p.audit(1); len(violations) != 0 {
+		t.Fatalf("violations after moves = %v", violations)
+	}
+}
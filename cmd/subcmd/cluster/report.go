@@ -0,0 +1,321 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"redis-cluster-manager/config"
+	r "redis-cluster-manager/redis"
+	"redis-cluster-manager/vars"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var jsonOutput bool // print the report in JSON instead of tables
+
+// StatusReport is the result of `cluster status`, printed by --json and served by `serve api`
+type StatusReport struct {
+	Seed         string        `json:"seed"`
+	SkippedSeeds []string      `json:"skipped_seeds,omitempty"`
+	Version      string        `json:"version"`
+	State        string        `json:"state"`
+	Slots        int           `json:"slots"`
+	UpMasters    int           `json:"up_masters"`
+	UpNodes      int           `json:"up_nodes"`
+	Shards       []ShardReport `json:"shards"`
+	ErrorNodes   []NodeError   `json:"error_nodes"`
+}
+
+// ShardReport is a shard of StatusReport, the master comes first
+type ShardReport struct {
+	Slots      int          `json:"slots"`
+	SlotRanges string       `json:"slot_ranges"`
+	NoMaster   bool         `json:"no_master,omitempty"` // slaves whose master is not known by the seed node
+	Nodes      []NodeReport `json:"nodes"`
+}
+
+// NodeReport is a node of StatusReport, the stats are left empty if it's not reachable
+type NodeReport struct {
+	NodeID       string  `json:"node_id"`
+	Addr         string  `json:"addr"`
+	DialAddr     string  `json:"dial_addr"`
+	Role         string  `json:"role"`
+	Health       string  `json:"health"` // health reported by the seed node
+	Reachable    bool    `json:"reachable"`
+	Loading      bool    `json:"loading,omitempty"`
+	UsedMemoryGB float64 `json:"used_memory_gb"`
+	MaxMemoryGB  float64 `json:"max_memory_gb"`
+	UsedMemory   int64   `json:"used_memory"` // bytes
+	MaxMemory    int64   `json:"max_memory"`  // bytes, 0 if not limited
+	Keys         int64   `json:"keys"`
+	Clients      int     `json:"clients"`
+	MaxClients   int     `json:"max_clients"`
+
+	// replication of a slave, the numbers are always present since 0 is a value: a replica fully caught up
+	SlaveInit    bool    `json:"slave_init,omitempty"`
+	SyncProgress float64 `json:"sync_progress"` // percentage of the rdb received during full sync, -1 if unknown
+	LagBytes     int64   `json:"lag_bytes"`     // -1 if unknown, e.g. the master can not be connected
+	Link         string  `json:"link,omitempty"`
+	LastIO       int     `json:"last_io_seconds"` // -1 if unknown
+
+	// replication backlog, of a master or a slave with cascading slaves
+	BacklogBytes   int64   `json:"backlog_bytes"`
+	BacklogSeconds float64 `json:"backlog_seconds"` // seconds of writes the backlog holds, -1 if no write
+}
+
+// NodeError is a node that can not be connected
+type NodeError struct {
+	Addr   string `json:"addr"`
+	NodeID string `json:"node_id"`
+	Error  string `json:"error"`
+}
+
+// seedFor connects to the first usable seed of comma separated hostPort without printing, skipped seeds are returned
+func seedFor(hostPort string) (*r.Instance, []string, error) {
+	seedNode, skipped, err := r.NewSeedInstance(hostPort)
+	var skippedSeeds []string
+	for _, e := range skipped {
+		skippedSeeds = append(skippedSeeds, e.Error())
+	}
+	return seedNode, skippedSeeds, err
+}
+
+func printJSON(v interface{}) error {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %v", err)
+	}
+	fmt.Println(string(out))
+	return nil
+}
+
+// StatusReportOf gets the status of the cluster of comma separated seeds without printing
+func StatusReportOf(hostPort string) (*StatusReport, error) {
+	seedNode, skipped, err := seedFor(hostPort)
+	if err != nil {
+		return nil, err
+	}
+	defer seedNode.Close()
+	if !seedNode.ClusterEnabled {
+		return nil, fmt.Errorf("seed node %s is not a cluster node, JSON reports are only for redis cluster", seedNode.Addr)
+	}
+	report, err := statusReport(seedNode)
+	if err != nil {
+		return nil, err
+	}
+	report.SkippedSeeds = skipped
+	return report, nil
+}
+
+func statusReport(seedNode *r.Instance) (*StatusReport, error) {
+	clusterInfo, err := r.ParseClusterInfo(seedNode.Client)
+	if err != nil {
+		return nil, err
+	}
+	// the nodes are taken from the shards, a second `cluster nodes` fetch may see another topology
+	shards, err := r.GetClusterShards(seedNode.Client)
+	if err != nil {
+		return nil, err
+	}
+	clusterInstances, errs := r.NewClusterInstances(r.ShardsNodesInfo(shards))
+	defer r.CloseInstances(clusterInstances)
+	byNodeID := make(map[string]*r.Instance)
+	for _, i := range clusterInstances {
+		byNodeID[i.NodeID] = i
+	}
+
+	report := &StatusReport{Seed: seedNode.Addr, Version: seedNode.Version,
+		State: clusterInfo["cluster_state"], UpNodes: len(clusterInstances), Shards: []ShardReport{}, ErrorNodes: []NodeError{}}
+	for _, shard := range shards {
+		report.Slots += shard.GetSlotCount()
+		var masterInstance *r.Instance
+		master := shard.Master()
+		if master != nil {
+			masterInstance = byNodeID[master.ID]
+		}
+		shardReport := ShardReport{Slots: shard.GetSlotCount(), SlotRanges: strings.TrimSpace(shard.StringSlots()),
+			NoMaster: master == nil}
+		for _, n := range shard.Nodes {
+			node := NodeReport{NodeID: n.ID, Addr: n.Addr, DialAddr: r.DialAddr(n.Addr), Role: n.Role, Health: n.Health}
+			if i := byNodeID[n.ID]; i != nil {
+				fillNodeReport(&node, i, masterInstance)
+				if i.Role == "master" {
+					report.UpMasters++
+				}
+			}
+			shardReport.Nodes = append(shardReport.Nodes, node)
+		}
+		report.Shards = append(report.Shards, shardReport)
+	}
+	for nodeInfo, err := range errs {
+		n := strings.Split(nodeInfo, ",")
+		report.ErrorNodes = append(report.ErrorNodes, NodeError{Addr: n[0], NodeID: n[1], Error: err.Error()})
+	}
+	sort.Slice(report.ErrorNodes, func(i, j int) bool {
+		return r.CompareAddr(report.ErrorNodes[i].Addr, report.ErrorNodes[j].Addr) < 0
+	})
+	return report, nil
+}
+
+// fillNodeReport fills the stats of a reachable node, master is the instance of it's master, nil if unknown
+func fillNodeReport(node *NodeReport, i *r.Instance, master *r.Instance) {
+	node.DialAddr, node.Reachable, node.Loading = i.DialAddr, true, i.LoadingError
+	if i.LoadingError {
+		return
+	}
+	node.Role = i.Role
+	node.UsedMemoryGB, node.MaxMemoryGB = i.UsedMemory, i.MaxMemory
+	node.UsedMemory, node.MaxMemory = i.UsedMemoryBytes, i.MaxMemoryBytes
+	node.Keys, _ = strconv.ParseInt(i.KeysCount, 10, 64)
+	node.Clients, node.MaxClients = i.ClientsCount, i.MaxClients
+	node.BacklogBytes, node.BacklogSeconds = i.ReplBacklogSize, i.BacklogCoverage()
+	if i.Role != "slave" {
+		return
+	}
+	node.SlaveInit, node.Link, node.LastIO, node.LagBytes = i.SlaveInit, i.MasterLinkStatus, i.MasterLastIO, -1
+	node.SyncProgress = i.SyncProgress
+	if master != nil && !master.LoadingError && !i.SlaveInit {
+		node.LagBytes = i.ReplLag(master)
+	}
+}
+
+// NodeInfoReport is the `info` of a node
+type NodeInfoReport struct {
+	Addr    string            `json:"addr"`
+	NodeID  string            `json:"node_id"`
+	Section string            `json:"section"`
+	Info    map[string]string `json:"info"`
+}
+
+// NodeInfoOf runs `info section` on node, a host:port or a node ID, of the cluster of comma separated seeds
+func NodeInfoOf(hostPort, node, section string) (*NodeInfoReport, error) {
+	i, err := connectNode(hostPort, node)
+	if err != nil {
+		return nil, err
+	}
+	defer i.Close()
+	info, err := r.ParseInfo(i.Client, section)
+	if err != nil {
+		return nil, err
+	}
+	return &NodeInfoReport{Addr: i.Addr, NodeID: i.NodeID, Section: section, Info: info}, nil
+}
+
+// connectNode connects to node, a host:port or a node ID, of the cluster of comma separated seeds
+func connectNode(hostPort, node string) (*r.Instance, error) {
+	seedNode, _, err := seedFor(hostPort)
+	if err != nil {
+		return nil, err
+	}
+	defer seedNode.Close()
+	if !seedNode.ClusterEnabled {
+		return nil, fmt.Errorf("seed node %s is not a cluster node", seedNode.Addr)
+	}
+	clusterNodesInfo, err := r.ParseClusterNodes(seedNode.Client)
+	if err != nil {
+		return nil, err
+	}
+	for _, nodeInfo := range clusterNodesInfo {
+		candidate := &r.Instance{Addr: nodeInfo[1], DialAddr: r.DialAddr(nodeInfo[1]), NodeID: nodeInfo[0]}
+		if !matchNode(candidate, node) {
+			continue
+		}
+		i, err := r.NewInstance(nodeInfo[1])
+		if err != nil {
+			return nil, err
+		}
+		i.UpdateNodeClusterInfo(clusterNodesInfo)
+		return i, nil
+	}
+	return nil, fmt.Errorf("node %s not found in cluster", node)
+}
+
+// ExecReport is the output of a command on each node
+type ExecReport struct {
+	Command []string     `json:"command"`
+	Results []ExecResult `json:"results"`
+}
+
+type ExecResult struct {
+	Addr   string   `json:"addr"`
+	NodeID string   `json:"node_id"`
+	Output []string `json:"output"` // lines formatted like redis-cli does
+}
+
+// ExecReportOf runs args on the nodes or the role of the cluster of comma separated seeds like `cluster exec`,
+// with the same forbidden commands and read-only policy
+func ExecReportOf(hostPort string, args []string, nodes, role string) (*ExecReport, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("no command given")
+	}
+	if config.IsForbidden(args[0]) {
+		return nil, fmt.Errorf("command `%s` is forbidden to execute", args[0])
+	}
+	if nodes != "" && role != "" {
+		return nil, fmt.Errorf("nodes and role are mutually exclusive")
+	}
+	if role != "" && role != vars.ROLE_MASTER && role != vars.ROLE_SLAVE && role != vars.ROLE_ALL {
+		return nil, fmt.Errorf("role must be `master` or `slave` or `all` when specified")
+	}
+	seedNode, _, err := seedFor(hostPort)
+	if err != nil {
+		return nil, err
+	}
+	defer seedNode.Close()
+	if err := checkExecWritable(seedNode, args); err != nil {
+		return nil, err
+	}
+	if !seedNode.ClusterEnabled {
+		return nil, fmt.Errorf("seed node %s is not a cluster node", seedNode.Addr)
+	}
+	clusterNodesInfo, err := r.ParseClusterNodes(seedNode.Client)
+	if err != nil {
+		return nil, err
+	}
+	clusterInstances, errs := r.NewClusterInstances(clusterNodesInfo)
+	defer r.CloseInstances(clusterInstances)
+	_, execInstances, err := filterInstancesBy(clusterInstances, nodes, role, seedNode.Addr)
+	if err != nil {
+		if len(errs) > 0 {
+			return nil, fmt.Errorf("%v, %d nodes can not be connected", err, len(errs))
+		}
+		return nil, err
+	}
+	results := execOn(execInstances, args)
+	sort.Sort(r.InstancesAscByAddr(execInstances))
+	report := &ExecReport{Command: args, Results: []ExecResult{}}
+	for _, i := range execInstances {
+		report.Results = append(report.Results, ExecResult{Addr: i.Addr, NodeID: i.NodeID, Output: resultLines(results[i.Addr])})
+	}
+	return report, nil
+}
+
+// FailoverReport is the result of a verified failover
+type FailoverReport struct {
+	OldMaster string `json:"old_master"`
+	NewMaster string `json:"new_master"`
+}
+
+// FailoverTo promotes node, a slave given by host:port or node ID, with a verified failover like drain-host does
+func FailoverTo(hostPort, node string) (*FailoverReport, error) {
+	if err := config.CheckWritable("failover"); err != nil {
+		return nil, err
+	}
+	slave, err := connectNode(hostPort, node)
+	if err != nil {
+		return nil, err
+	}
+	defer slave.Close()
+	if slave.Role != "slave" || slave.MasterID == "" {
+		return nil, fmt.Errorf("%s is not a slave", slave.Addr)
+	}
+	master, err := connectNode(hostPort, slave.MasterID)
+	if err != nil {
+		return nil, fmt.Errorf("master %s of %s is not reachable: %v", slave.MasterID, slave.Addr, err)
+	}
+	defer master.Close()
+	if err := verifiedFailover(master, slave); err != nil {
+		return nil, err
+	}
+	return &FailoverReport{OldMaster: master.Addr, NewMaster: slave.Addr}, nil
+}
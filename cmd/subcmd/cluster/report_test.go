@@ -0,0 +1,26 @@
+package cluster
+
+import (
+	"encoding/json"
+	r "redis-cluster-manager/redis"
+	"strings"
+	"testing"
+)
+
+func TestNodeReportJSONKeepsZeros(t *testing.T) {
+	master := &r.Instance{Addr: "10.0.0.1:6379", Role: "master", MasterReplOffset: 1000, MasterLastIO: -1, SyncProgress: -1}
+	slave := &r.Instance{Addr: "10.0.0.2:6379", Role: "slave", Master: "10.0.0.1:6379", MasterLinkStatus: "up",
+		SlaveReplOffset: 1000, MasterLastIO: 0, SyncProgress: -1}
+	node := NodeReport{Addr: slave.Addr}
+	fillNodeReport(&node, slave, master)
+	out, err := json.Marshal(node)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	for _, want := range []string{`"lag_bytes":0`, `"last_io_seconds":0`, `"sync_progress":-1`, `"backlog_bytes":0`,
+		`"backlog_seconds":-1`} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("%s does not contain %s", out, want)
+		}
+	}
+}
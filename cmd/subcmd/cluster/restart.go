@@ -0,0 +1,253 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"net"
+	"os"
+	"os/exec"
+	"redis-cluster-manager/config"
+	"redis-cluster-manager/perf"
+	r "redis-cluster-manager/redis"
+	"redis-cluster-manager/vars"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	restartHook    string        // local command to restart a node, placeholders will be replaced
+	restartTimeout time.Duration // max time to wait for a restarted node to become healthy
+)
+
+// readyCheckInterval is the interval between two checks while waiting for a restarted node
+const readyCheckInterval = time.Second
+
+var RollingRestartCmd = &cobra.Command{
+	Use:   "rolling-restart",
+	Short: "Restart all cluster nodes one by one with a user-supplied hook",
+	Long: `Restart cluster nodes shard by shard, slaves first. Masters are failed over to their best slave before restart.
+The restart is done by a local hook command, in which {host}, {port}, {addr} and {node_id} are replaced with
+those of the node to be restarted, e.g. "ssh {host} systemctl restart redis@{port}".
+After each restart rcm waits for the node to reconnect and finish loading, for replication to be in sync and for
+cluster_state to be ok. The run aborts on the first unhealthy step.
+The restart order is only shown by default, the restarts are done with --apply.`,
+	Args: cobra.ExactArgs(1),
+	Example: fmt.Sprintf("%s cluster rolling-restart <seed-node> -a \"password\" --hook \"ssh {host} systemctl restart redis@{port}\" [--apply]",
+		vars.AppName),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vars.HostPort = config.ResolveSeed(args[0])
+		f := perf.StartCpuProfile()
+		defer perf.StopCpuProfile(f)
+		if err := rollingRestart(vars.HostPort); err != nil {
+			return err
+		}
+		perf.MemProfile()
+		return nil
+	},
+}
+
+func InitRollingRestart() {
+	RollingRestartCmd.Flags().StringVar(&restartHook, "hook", "", "local command to restart a node, supports {host} {port} {addr} {node_id}")
+	RollingRestartCmd.Flags().DurationVar(&restartTimeout, "wait-timeout", time.Minute*10, "max time to wait for a restarted node to become healthy")
+	RollingRestartCmd.Flags().DurationVar(&failoverTimeout, "failover-timeout", time.Second*30, "max time to wait for each failover")
+	RollingRestartCmd.Flags().BoolVar(&applyPlan, "apply", false, "do the restarts in the shown order")
+	_ = RollingRestartCmd.MarkFlagRequired("hook")
+}
+
+func rollingRestart(hostPort string) error {
+	seedNode, clusterInstances, errCount, err := connectCluster(hostPort)
+	if err != nil {
+		return err
+	}
+	defer seedNode.Close()
+	defer r.CloseInstances(clusterInstances)
+	if errCount > 0 {
+		return fmt.Errorf("%d nodes can not be connected, fix them before rolling restart", errCount)
+	}
+	if err := checkClusterStateOK(seedNode); err != nil {
+		return err
+	}
+	order, err := restartOrder(clusterInstances)
+	if err != nil {
+		return err
+	}
+	color.Cyan("%-8s%-24s%-16s%s\n", "Shard", "Address", "Role", "Hook")
+	for n, shard := range order {
+		for _, i := range shard {
+			fmt.Printf("%-8d%-24s%-16s%s\n", n+1, i.Addr, i.Role, expandHook(i))
+		}
+	}
+	if !applyPlan {
+		color.Cyan("Run with --apply to do the restarts.")
+		return nil
+	}
+	if err := config.CheckWritable("rolling-restart"); err != nil {
+		return err
+	}
+
+	for n, shard := range order {
+		color.Cyan("Restarting shard %d/%d ...\n", n+1, len(order))
+		master := shard[len(shard)-1]
+		for _, slave := range shard[:len(shard)-1] {
+			if err := restartNode(seedNode, slave); err != nil {
+				return err
+			}
+		}
+		if len(shard) > 1 {
+			// slaves have been restarted and reconnected, pick the best one to take over
+			candidate := bestDrainCandidate(master, clusterInstances, "")
+			if candidate == nil {
+				return fmt.Errorf("no healthy slave to fail over master %s", master.Addr)
+			}
+			color.Yellow("Failing over %s to %s ...\n", master.Addr, candidate.Addr)
+			if err := verifiedFailover(master, candidate); err != nil {
+				return err
+			}
+		}
+		if err := restartNode(seedNode, master); err != nil {
+			return err
+		}
+	}
+	color.Cyan("Done!")
+	return nil
+}
+
+// restartOrder groups the instances by shard sorted by master addr, each shard lists it's slaves then it's master.
+// a master serving slots without slave can not be restarted without making it's slots unavailable
+func restartOrder(clusterInstances []*r.Instance) ([][]*r.Instance, error) {
+	var masters []*r.Instance
+	for _, i := range clusterInstances {
+		if i.Role == "master" {
+			masters = append(masters, i)
+		}
+	}
+	sort.Sort(r.InstancesAscByAddr(masters))
+	var order [][]*r.Instance
+	for _, m := range masters {
+		var slaves []*r.Instance
+		for _, i := range clusterInstances {
+			if i.MasterID == m.NodeID {
+				slaves = append(slaves, i)
+			}
+		}
+		if len(slaves) == 0 && m.GetSlotCount() > 0 {
+			return nil, fmt.Errorf("master %s has no slave, restarting it makes %d slots unavailable", m.Addr, m.GetSlotCount())
+		}
+		sort.Sort(r.InstancesAscByAddr(slaves))
+		order = append(order, append(slaves, m))
+	}
+	return order, nil
+}
+
+// expandHook replaces the placeholders in restartHook with node info of i
+func expandHook(i *r.Instance) string {
+	host, port, err := net.SplitHostPort(i.Addr)
+	if err != nil {
+		host = i.Addr
+	}
+	return strings.NewReplacer(
+		"{host}", host,
+		"{port}", port,
+		"{addr}", i.Addr,
+		"{node_id}", i.NodeID,
+	).Replace(restartHook)
+}
+
+// restartNode runs the restart hook for i and waits until it is healthy again.
+// the client of i is replaced with the client of the reconnected instance
+func restartNode(seedNode, i *r.Instance) error {
+	serverInfo, err := r.ParseInfo(i.Client, "server")
+	if err != nil {
+		return err
+	}
+	runID := serverInfo["run_id"]
+	hook := expandHook(i)
+	color.Yellow("Restarting %s with `%s` ...\n", i.Addr, hook)
+	ctx, cancel := context.WithTimeout(context.Background(), restartTimeout)
+	defer cancel()
+	c := exec.CommandContext(ctx, "sh", "-c", hook)
+	c.Stdout, c.Stderr = os.Stdout, os.Stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("restart hook failed on %s: %v", i.Addr, err)
+	}
+	restarted, err := waitNodeReady(i.Addr, runID)
+	if err != nil {
+		return err
+	}
+	restarted.NodeID = i.NodeID
+	i.Close()
+	*i = *restarted
+	if err := checkClusterStateOK(seedNode); err != nil {
+		return err
+	}
+	fmt.Printf("%s restarted and healthy\n", i.Addr)
+	return nil
+}
+
+// waitNodeReady waits until the node at addr has a new run_id, finished loading and it's replication is in sync
+func waitNodeReady(addr, oldRunID string) (*r.Instance, error) {
+	deadline := time.Now().Add(restartTimeout)
+	var lastErr error
+	for time.Now().Before(deadline) {
+		time.Sleep(readyCheckInterval)
+		i, err := r.NewInstance(addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if lastErr = nodeReady(i, oldRunID); lastErr == nil {
+			if lastErr = nodeClusterStateOK(i); lastErr == nil {
+				return i, nil
+			}
+		}
+		i.Close()
+	}
+	return nil, fmt.Errorf("%s is not healthy after %v: %v", addr, restartTimeout, lastErr)
+}
+
+// nodeReady checks the info fetched when i was connected: loading finished, run_id changed and replication in sync
+func nodeReady(i *r.Instance, oldRunID string) error {
+	if i.LoadingError {
+		return fmt.Errorf("still loading")
+	}
+	if i.Info["run_id"] == oldRunID {
+		return fmt.Errorf("run_id not changed, node was not restarted")
+	}
+	if i.Role == "slave" && (i.MasterLinkStatus != "up" || i.SlaveInit) {
+		return fmt.Errorf("replication not in sync, master_link_status=%s", i.MasterLinkStatus)
+	}
+	return nil
+}
+
+// nodeClusterStateOK checks cluster_state seen by i
+func nodeClusterStateOK(i *r.Instance) error {
+	clusterInfo, err := r.ParseClusterInfo(i.Client)
+	if err != nil {
+		return err
+	}
+	if clusterInfo["cluster_state"] != "ok" {
+		return fmt.Errorf("cluster_state is %s", clusterInfo["cluster_state"])
+	}
+	return nil
+}
+
+// checkClusterStateOK waits a while for cluster_state of seedNode to become ok
+func checkClusterStateOK(seedNode *r.Instance) error {
+	deadline := time.Now().Add(failoverTimeout)
+	for {
+		clusterInfo, err := r.ParseClusterInfo(seedNode.Client)
+		if err == nil && clusterInfo["cluster_state"] == "ok" {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("cluster_state of seed node %s is %s", seedNode.Addr, clusterInfo["cluster_state"])
+		}
+		time.Sleep(readyCheckInterval)
+	}
+}
@@ -0,0 +1,103 @@
+package cluster
+
+import (
+	r "redis-cluster-manager/redis"
+	"testing"
+)
+
+func TestExpandHook(t *testing.T) {
+	restartHook = "ssh {host} systemctl restart redis@{port} # {addr} {node_id}"
+	i := &r.Instance{Addr: "10.0.0.5:6379", NodeID: "abc"}
+	want := "ssh 10.0.0.5 systemctl restart redis@6379 # 10.0.0.5:6379 abc"
+	if got := expandHook(i); got != want {
+		t.Fatalf("expandHook() = %q, want %q", got, want)
+	}
+}
+
+func TestNodeReady(t *testing.T) {
+	tests := []struct {
+		name     string
+		instance *r.Instance
+		wantErr  bool
+	}{
+		{
+			name:     "still loading",
+			instance: &r.Instance{LoadingError: true},
+			wantErr:  true,
+		},
+		{
+			name:     "not restarted",
+			instance: &r.Instance{Role: "master", Info: map[string]string{"run_id": "old"}},
+			wantErr:  true,
+		},
+		{
+			name:     "restarted master",
+			instance: &r.Instance{Role: "master", Info: map[string]string{"run_id": "new"}},
+		},
+		{
+			name:     "slave with link down",
+			instance: &r.Instance{Role: "slave", Info: map[string]string{"run_id": "new"}, MasterLinkStatus: "down"},
+			wantErr:  true,
+		},
+		{
+			name:     "slave in full sync",
+			instance: &r.Instance{Role: "slave", Info: map[string]string{"run_id": "new"}, MasterLinkStatus: "up", SlaveInit: true},
+			wantErr:  true,
+		},
+		{
+			name:     "slave in sync",
+			instance: &r.Instance{Role: "slave", Info: map[string]string{"run_id": "new"}, MasterLinkStatus: "up"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := nodeReady(tt.instance, "old"); (err != nil) != tt.wantErr {
+				t.Fatalf("nodeReady() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRestartOrderSlavesFirst(t *testing.T) {
+	instances := []*r.Instance{
+		{Addr: "10.0.0.2:6379", NodeID: "m2", Role: "master", Slots: []*r.SlotRange{{Start: 8192, End: 16383, SlotCount: 8192}}},
+		{Addr: "10.0.0.1:6380", Role: "slave", MasterID: "m2"},
+		{Addr: "10.0.0.1:6379", NodeID: "m1", Role: "master", Slots: []*r.SlotRange{{Start: 0, End: 8191, SlotCount: 8192}}},
+		{Addr: "10.0.0.3:6380", Role: "slave", MasterID: "m1"},
+		{Addr: "10.0.0.2:6380", Role: "slave", MasterID: "m1"},
+		{Addr: "10.0.0.4:6379", NodeID: "m4", Role: "master"},
+	}
+	order, err := restartOrder(instances)
+	if err != nil {
+		t.Fatalf("restartOrder() error = %v", err)
+	}
+	want := [][]string{
+		{"10.0.0.2:6380", "10.0.0.3:6380", "10.0.0.1:6379"},
+		{"10.0.0.1:6380", "10.0.0.2:6379"},
+		{"10.0.0.4:6379"},
+	}
+	if len(order) != len(want) {
+		t.Fatalf("restartOrder() = %d shards, want %d", len(order), len(want))
+	}
+	for n, shard := range order {
+		var addrs []string
+		for _, i := range shard {
+			addrs = append(addrs, i.Addr)
+		}
+		if len(addrs) != len(want[n]) {
+			t.Fatalf("shard %d = %v, want %v", n, addrs, want[n])
+		}
+		for k := range addrs {
+			if addrs[k] != want[n][k] {
+				t.Fatalf("shard %d = %v, want %v", n, addrs, want[n])
+			}
+		}
+	}
+
+	// a master serving slots without slave is refused
+	instances = append(instances, &r.Instance{Addr: "10.0.0.5:6379", NodeID: "m5", Role: "master", Slots: []*r.SlotRange{{Start: 0, End: 0, SlotCount: 1}}})
+	if _, err := restartOrder(instances); err == nil {
+		t.Fatalf("restartOrder() with a master without slave should fail")
+	}
+}
@@ -1 +1,174 @@
 package cluster
+
+import (
+	"context"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"redis-cluster-manager/config"
+	"redis-cluster-manager/perf"
+	r "redis-cluster-manager/redis"
+	"redis-cluster-manager/vars"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var slowlogCount int64 = 10
+
+var SlowlogCmd = &cobra.Command{
+	Use:   "slowlog",
+	Short: "Collect the slowlogs of all nodes",
+	Long: `Collect the slowlogs of all nodes of the cluster and show them as one list, the slowest first.
+Each entry shows the node it was logged on, so that hot keys and slow commands of a shard can be found.`,
+	Args:    cobra.ExactArgs(1),
+	Example: fmt.Sprintf("%s cluster slowlog <seed-node> -a \"password\" --count 20 [--json]", vars.AppName),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vars.HostPort = config.ResolveSeed(args[0])
+		f := perf.StartCpuProfile()
+		defer perf.StopCpuProfile(f)
+		err := printClusterSlowlog(vars.HostPort)
+		if err != nil {
+			return err
+		}
+		perf.MemProfile()
+		return nil
+	},
+}
+
+func InitSlowlog() {
+	SlowlogCmd.Flags().Int64VarP(&slowlogCount, "count", "n", slowlogCount, "number of entries fetched from each node")
+	SlowlogCmd.Flags().BoolVar(&jsonOutput, "json", false, "print the slowlogs in JSON")
+}
+
+// SlowlogReport is the slowlogs of all nodes, the slowest first
+type SlowlogReport struct {
+	Seed       string         `json:"seed"`
+	Entries    []SlowlogEntry `json:"entries"`
+	ErrorNodes []NodeError    `json:"error_nodes"`
+}
+
+type SlowlogEntry struct {
+	Addr       string    `json:"addr"`
+	NodeID     string    `json:"node_id"`
+	Role       string    `json:"role"`
+	ID         int64     `json:"id"`
+	Time       time.Time `json:"time"`
+	Micros     int64     `json:"duration_us"`
+	Args       []string  `json:"args"`
+	ClientAddr string    `json:"client_addr,omitempty"`
+	ClientName string    `json:"client_name,omitempty"`
+}
+
+// SlowlogReportOf collects count slowlog entries of each node of the cluster of comma separated seeds
+func SlowlogReportOf(hostPort string, count int64) (*SlowlogReport, error) {
+	seedNode, _, err := seedFor(hostPort)
+	if err != nil {
+		return nil, err
+	}
+	defer seedNode.Close()
+	return slowlogReport(seedNode, count)
+}
+
+func slowlogReport(seedNode *r.Instance, count int64) (*SlowlogReport, error) {
+	if !seedNode.ClusterEnabled {
+		return nil, fmt.Errorf("seed node %s is not a cluster node", seedNode.Addr)
+	}
+	clusterNodesInfo, err := r.ParseClusterNodes(seedNode.Client)
+	if err != nil {
+		return nil, err
+	}
+	clusterInstances, errs := r.NewClusterInstances(clusterNodesInfo)
+	defer r.CloseInstances(clusterInstances)
+	report := &SlowlogReport{Seed: seedNode.Addr, Entries: []SlowlogEntry{}, ErrorNodes: []NodeError{}}
+	for nodeInfo, err := range errs {
+		n := strings.Split(nodeInfo, ",")
+		report.ErrorNodes = append(report.ErrorNodes, NodeError{Addr: n[0], NodeID: n[1], Error: err.Error()})
+	}
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, instance := range clusterInstances {
+		wg.Add(1)
+		go func(i *r.Instance) {
+			defer wg.Done()
+			logs, err := i.Client.SlowLogGet(context.Background(), count).Result()
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				report.ErrorNodes = append(report.ErrorNodes, NodeError{Addr: i.Addr, NodeID: i.NodeID, Error: err.Error()})
+				return
+			}
+			for _, l := range logs {
+				report.Entries = append(report.Entries, SlowlogEntry{Addr: i.Addr, NodeID: i.NodeID, Role: i.Role, ID: l.ID,
+					Time: l.Time, Micros: l.Duration.Microseconds(), Args: l.Args, ClientAddr: l.ClientAddr, ClientName: l.ClientName})
+			}
+		}(instance)
+	}
+	wg.Wait()
+	sortSlowlog(report.Entries)
+	sort.Slice(report.ErrorNodes, func(i, j int) bool {
+		return r.CompareAddr(report.ErrorNodes[i].Addr, report.ErrorNodes[j].Addr) < 0
+	})
+	return report, nil
+}
+
+// sortSlowlog sorts the entries the slowest first, the latest first for the same duration
+func sortSlowlog(entries []SlowlogEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Micros != entries[j].Micros {
+			return entries[i].Micros > entries[j].Micros
+		}
+		return entries[i].Time.After(entries[j].Time)
+	})
+}
+
+// formatSlowlogArgs joins the args like redis-cli shows them, shortened to max runes
+func formatSlowlogArgs(args []string, max int) string {
+	quoted := make([]string, 0, len(args))
+	for _, a := range args {
+		if a == "" || strings.ContainsAny(a, " \"") {
+			a = fmt.Sprintf("%q", a)
+		}
+		quoted = append(quoted, a)
+	}
+	line := []rune(strings.Join(quoted, " "))
+	if len(line) > max {
+		return string(line[:max-3]) + "..."
+	}
+	return string(line)
+}
+
+func printClusterSlowlog(hostPort string) error {
+	if jsonOutput {
+		report, err := SlowlogReportOf(hostPort, slowlogCount)
+		if err != nil {
+			return err
+		}
+		return printJSON(report)
+	}
+	seedNode, err := NewSeedNode(hostPort)
+	if err != nil {
+		return err
+	}
+	defer seedNode.Close()
+	report, err := slowlogReport(seedNode, slowlogCount)
+	if err != nil {
+		return err
+	}
+	color.Cyan("%-24s%-8s%-21s%-14s%s\n", "Node", "Role", "Time", "Duration(us)", "Command")
+	fmt.Printf("%-24s%-8s%-21s%-14s%s\n", "----", "----", "----", "------------", "-------")
+	for _, e := range report.Entries {
+		fmt.Printf("%-24s%-8s%-21s%-14d%s\n", e.Addr, e.Role, e.Time.Format("2006-01-02 15:04:05"), e.Micros,
+			formatSlowlogArgs(e.Args, 80))
+	}
+	for _, n := range report.ErrorNodes {
+		fmt.Printf("%-24s%s\n", n.Addr, color.RedString("%s", n.Error))
+	}
+	if len(report.Entries) == 0 {
+		color.Green("No slowlog found.\n")
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package cluster
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSortSlowlog(t *testing.T) {
+	now := time.Now()
+	entries := []SlowlogEntry{
+		{Addr: "a", ID: 1, Micros: 100, Time: now},
+		{Addr: "b", ID: 2, Micros: 3000, Time: now},
+		{Addr: "c", ID: 3, Micros: 100, Time: now.Add(time.Second)},
+	}
+	sortSlowlog(entries)
+	if entries[0].Addr != "b" || entries[1].Addr != "c" || entries[2].Addr != "a" {
+		t.Fatalf("sortSlowlog() = %v, want b, c, a", entries)
+	}
+}
+
+func TestFormatSlowlogArgs(t *testing.T) {
+	if got := formatSlowlogArgs([]string{"SET", "k", "a b", ""}, 80); got != `SET k "a b" ""` {
+		t.Fatalf("formatSlowlogArgs() = %s", got)
+	}
+	if got := formatSlowlogArgs([]string{"GET", "0123456789"}, 10); got != "GET 012..." {
+		t.Fatalf("formatSlowlogArgs() = %s", got)
+	}
+}
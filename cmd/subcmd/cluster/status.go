@@ -4,30 +4,43 @@ import (
 	"fmt"
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
+	"redis-cluster-manager/config"
 	"redis-cluster-manager/perf"
 	r "redis-cluster-manager/redis"
 	"redis-cluster-manager/vars"
-	"sort"
+	"strconv"
 	"strings"
-	"sync"
-	"sync/atomic"
 )
 
 var (
-	showSlots bool // whether to show slots info or not
+	showSlots       bool                // whether to show slots info or not
+	lagThreshold    int64 = 1024 * 1024 // replication lag in bytes above which a slave is highlighted
+	lastIOThreshold       = 30          // master_last_io_seconds_ago above which a slave is highlighted
 )
 
+// minBacklogCoverage is the min seconds of writes the backlog should hold,
+// a slave disconnected longer than that needs a full sync
+const minBacklogCoverage = 60
+
 var StatusCmd = &cobra.Command{
 	Use:     "status",
 	Short:   "Show cluster status",
 	Long:    `Show cluster status`,
 	Args:    cobra.ExactArgs(1),
-	Example: fmt.Sprintf("%s cluster status <seed-node> -a \"password\"", vars.AppName),
+	Example: fmt.Sprintf("%s cluster status <seed-node> -a \"password\" [--json]", vars.AppName),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		vars.HostPort = args[0]
+		vars.HostPort = config.ResolveSeed(args[0])
 		f := perf.StartCpuProfile()
 		defer perf.StopCpuProfile(f)
-		err := printClusterStatus(vars.HostPort)
+		var err error
+		if jsonOutput {
+			var report *StatusReport
+			if report, err = StatusReportOf(vars.HostPort); err == nil {
+				err = printJSON(report)
+			}
+		} else {
+			err = printClusterStatus(vars.HostPort)
+		}
 		if err != nil {
 			return err
 		}
@@ -38,178 +51,151 @@ var StatusCmd = &cobra.Command{
 
 func InitStatus() {
 	StatusCmd.Flags().BoolVarP(&showSlots, "show-slots", "s", false, "Show slots info or not, default false")
+	StatusCmd.Flags().Int64Var(&lagThreshold, "lag-threshold", lagThreshold, "replication lag in bytes above which a slave is highlighted")
+	StatusCmd.Flags().IntVar(&lastIOThreshold, "last-io-threshold", lastIOThreshold, "master_last_io_seconds_ago above which a slave is highlighted")
+	StatusCmd.Flags().BoolVar(&jsonOutput, "json", false, "print the status in JSON, for redis cluster only")
+}
+
+// NewSeedNode connects to the first usable seed of comma separated hostPort, reports the skipped seeds and the one
+// used, vars.HostPort is set to the seed used
+func NewSeedNode(hostPort string) (*r.Instance, error) {
+	seedNode, skipped, err := r.NewSeedInstance(hostPort)
+	for _, e := range skipped {
+		color.Yellow("Skipped %v\n", e)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if strings.Contains(hostPort, ",") {
+		color.Cyan("Using seed node %s\n", seedNode.Addr)
+	}
+	vars.HostPort = seedNode.Addr
+	return seedNode, nil
 }
 
 // printClusterStatus
 // if cluster is a sharding cluster, it shows sharding cluster status
-// if cluster is a master-slave/sentinel cluster, it calls printMasterSlaveStatus
+// if cluster is a master-slave/sentinel cluster, it calls PrintMasterSlaveStatus
 func printClusterStatus(hostPort string) error {
-	// we call the provided node as `the seed node`(vars.HostPort above)
-	seedNode, err := r.NewInstance(hostPort)
+	// we call the provided node as `the seed node`(vars.HostPort above), the first usable one if several are given
+	seedNode, err := NewSeedNode(hostPort)
 	if err != nil {
 		return err
 	}
 	defer seedNode.Close()
 	if !seedNode.ClusterEnabled {
-		return printMasterSlaveStatus(seedNode)
+		return PrintMasterSlaveStatus(seedNode)
 	}
-	clusterInfo, err := r.ParseClusterInfo(seedNode.Client)
+	report, err := statusReport(seedNode)
 	if err != nil {
 		return err
 	}
-	clusterState := clusterInfo["cluster_state"]
-	if clusterState == "fail" {
+	if report.State == "fail" {
 		return fmt.Errorf("seed node cluster mode ON, but it's cluster state is fail, might be a orphaned node")
 	}
-	// get cluster instances by running `cluster nodes` on seed node
-	clusterNodesInfo, err := r.ParseClusterNodes(seedNode.Client)
-	if err != nil {
-		return err
-	}
-	// get cluster instances simultaneously
-	var (
-		clusterInstances []*r.Instance // all instances that can be connected
-		displayedSlaves  []*r.Instance // slaves that have alive master
-		OrphanedSlaves   []*r.Instance // slaves that have no alive master, clusterInstances - displayedSlaves
-		mu               sync.Mutex
-		wg               sync.WaitGroup
-		warnings         sync.Map     // instances can not be created err messages
-		errInstanceCount atomic.Int32 // instances can not be created counter
-		slotsCount       int          // slots count of all masters
-	)
-	for _, nodeInfo := range clusterNodesInfo {
-		nodeId := nodeInfo[0]
-		addr := nodeInfo[1]
-		wg.Add(1)
-		go func(addr, nodeId string) {
-			defer wg.Done()
-			if i, err := r.NewInstance(addr); err != nil {
-				warnings.Store(fmt.Sprintf("%s,%s", addr, nodeId), err)
-				errInstanceCount.Add(1)
-				return
-			} else {
-				i.UpdateNodeClusterInfo(clusterNodesInfo)
-				mu.Lock()
-				clusterInstances = append(clusterInstances, i)
-				mu.Unlock()
-			}
-		}(addr, nodeId)
-	}
-	wg.Wait()
+	printStatusReport(report)
+	return nil
+}
+
+// printStatusReport prints the nodes of report grouped by shard, followed by the counts and the error nodes
+func printStatusReport(report *StatusReport) {
 	// Print Cluster Basic Info
-	fmt.Println(strings.Repeat("=", 155))
-	fmt.Printf("%-16s:\t%s\n", "Cluster Version", seedNode.Version)
-	fmt.Println(strings.Repeat("=", 155))
+	width := 206 + len(formatDialed(""))
+	fmt.Println(strings.Repeat("=", width))
+	fmt.Printf("%-16s:\t%s\n", "Cluster Version", report.Version)
+	fmt.Println(strings.Repeat("=", width))
 	// Print Node Banner
-	color.Cyan("%-45s%-24s%-16s%-16s%-16s%-16s%-12s%s\n", "NodeID", "Address", "Role", "Memory(GB)",
-		"KeysCount", "Clients", "Slots", "SlotRanges")
-	fmt.Printf("%-45s%-24s%-16s%-16s%-16s%-16s%-12s%s\n", "------", "-------", "----", "----------",
-		"---------", "-------", "-----", "----------")
-	// get all masters
-	var clusterMasters []*r.Instance
-	for _, i := range clusterInstances {
-		if i.Role == "master" {
-			clusterMasters = append(clusterMasters, i)
-			for _, slot := range i.Slots {
-				slotsCount += slot.SlotCount
-			}
-		}
-	}
-	sortedMasters := r.InstancesAscByAddr(clusterMasters)
-	sort.Sort(sortedMasters)
-	for _, m := range sortedMasters {
-		// print master info
-		fmt.Print(color.RedString("%-45s", m.NodeID))
-		fmt.Print(color.RedString("%-24s", m.Addr))
-		fmt.Printf("%-16s", formatRole(m, false))
-		fmt.Printf("%-16s", formatMemory(m))
-		fmt.Printf("%-16s", formatKeysCount(m))
-		fmt.Printf("%-16s", formatClients(m))
-		fmt.Printf("%-12d", m.GetSlotCount())
-		if showSlots {
-			fmt.Printf("%s\n", m.StringSlots())
-		} else {
-			fmt.Print("...\n")
-		}
-		// print slaves info: get slaves and sort them then print them
-		var slaves []*r.Instance
-		for _, i := range clusterInstances {
-			if i.Master == m.Addr {
-				slaves = append(slaves, i)
-				displayedSlaves = append(displayedSlaves, i)
-			}
-		}
-		sortedSlaves := r.InstancesAscByAddr(slaves)
-		sort.Sort(sortedSlaves)
-		for _, s := range sortedSlaves {
-			fmt.Printf("%-45s", s.NodeID)
-			fmt.Printf("%-24s", s.Addr)
-			fmt.Printf("%-16s", formatRole(s, true))
-			fmt.Printf("%-16s", formatMemory(s))
-			fmt.Printf("%-16s", formatKeysCount(s))
-			fmt.Printf("%-16s", formatClients(s))
-			// skip slot info for slave
-			fmt.Printf("%-12s", "")
-			fmt.Printf("%s\n", "")
+	color.Cyan("%-45s%-24s%s%-16s%-16s%-16s%-16s%-14s%-8s%-11s%-18s%-12s%s\n", "NodeID", "Address", dialedHeader("Dialed"),
+		"Role", "Memory(GB)", "KeysCount", "Clients", "Lag(B)", "Link", "LastIO(s)", "Backlog", "Slots", "SlotRanges")
+	fmt.Printf("%-45s%-24s%s%-16s%-16s%-16s%-16s%-14s%-8s%-11s%-18s%-12s%s\n", "------", "-------", dialedHeader("------"),
+		"----", "----------", "---------", "-------", "------", "----", "---------", "-------", "-----", "----------")
+	for _, shard := range report.Shards {
+		if shard.NoMaster {
+			// slaves whose master is not known by the seed node
+			fmt.Printf("%-45s%-24s%s%s\n", "-", "-", formatDialed(""), color.RedString("no master"))
 		}
-	}
-	// when a master's connection count reaches maxclients, no new connections are allowed,
-	// that means it is alive, but we can not create an instance for it, so it seems it's slaves are orphaned.
-	// we need to display these orphaned slaves in the end
-	for _, i := range clusterInstances {
-		if i.Role == "slave" {
-			slaveDisplayed := false
-			for _, ds := range displayedSlaves {
-				if i.Addr == ds.Addr {
-					slaveDisplayed = true
-					break
+		for k, n := range shard.Nodes {
+			isMaster := k == 0 && !shard.NoMaster
+			if !n.Reachable {
+				fmt.Print(color.RedString("%-45s%-24s", n.NodeID, n.Addr))
+				fmt.Print(formatDialed(n.DialAddr))
+				fmt.Print(color.RedString("%-16s%s", formatShardRole(n.Role, !isMaster), "unreachable, health: "+n.Health))
+				if isMaster {
+					fmt.Printf(" %d slots", shard.Slots)
 				}
+				fmt.Println()
+				continue
+			}
+			if isMaster {
+				// print master info
+				fmt.Print(color.RedString("%-45s", n.NodeID))
+				fmt.Print(color.RedString("%-24s", n.Addr))
+			} else {
+				fmt.Printf("%-45s", n.NodeID)
+				fmt.Printf("%-24s", n.Addr)
 			}
-			if !slaveDisplayed {
-				OrphanedSlaves = append(OrphanedSlaves, i)
+			fmt.Print(formatDialed(n.DialAddr))
+			fmt.Printf("%-16s", formatRole(n, !isMaster))
+			fmt.Printf("%-16s", formatMemory(n))
+			fmt.Printf("%-16s", formatKeysCount(n))
+			fmt.Printf("%-16s", formatClients(n))
+			if !isMaster {
+				fmt.Print(formatReplication(n))
+				// skip backlog and slot info for slave
+				fmt.Printf("%-18s%-12s\n", "", "")
+				continue
+			}
+			fmt.Printf("%-14s%-8s%-11s", "", "", "")
+			fmt.Print(formatBacklog(n))
+			fmt.Printf("%-12d", shard.Slots)
+			if showSlots {
+				fmt.Printf("%s\n", shard.SlotRanges)
+			} else {
+				fmt.Print("...\n")
 			}
 		}
 	}
-	if len(OrphanedSlaves) > 0 {
-		color.Red("Orphaned Slaves (whose masters can not connected, see Warnings below):")
-		for _, os := range OrphanedSlaves {
-			fmt.Printf("%-45s", os.NodeID)
-			fmt.Printf("%-24s", os.Addr)
-			fmt.Printf("%-16s", formatRole(os, true))
-			fmt.Printf("%-16s", formatMemory(os))
-			fmt.Printf("%-16s", formatKeysCount(os))
-			fmt.Printf("%-16s", formatClients(os))
-			// skip slot info for slave
-			fmt.Printf("%-12s", "")
-			fmt.Printf("%s\n", "")
+	color.Cyan("Total up masters in cluster: %d\n", report.UpMasters)
+	color.Cyan("Total up members in cluster: %d\n", report.UpNodes)
+	if len(report.ErrorNodes) != 0 {
+		color.Cyan("Warnings:")
+		for _, n := range report.ErrorNodes {
+			color.Red("failed to create instance for node [addr=%s] [node_id=%s], error: %v\n", n.Addr, n.NodeID, n.Error)
 		}
+		color.Cyan("Error nodes in cluster: %d\n", len(report.ErrorNodes))
 	}
-	for _, i := range clusterInstances {
-		i.Close()
+	if report.Slots != 16384 {
+		color.Red("Master slot count is not 16384(%d). Some slots missing or migrating. Please check your cluster status.", report.Slots)
 	}
-	color.Cyan("Total up masters in cluster: %d\n", len(clusterMasters))
-	color.Cyan("Total up members in cluster: %d\n", len(clusterInstances))
-	if errInstanceCount.Load() != 0 {
-		color.Cyan("Warnings:")
-		warnings.Range(func(nodeInfo, err interface{}) bool {
-			n := strings.Split(nodeInfo.(string), ",")
-			color.Red("failed to create instance for node [addr=%s] [node_id=%s], error: %v\n", n[0], n[1], err)
-			return true
-		})
-		color.Cyan("Error nodes in cluster: %d\n", errInstanceCount.Load())
+}
+
+// dialedHeader returns the header cell of the Dialed column, which is shown only if address translation is enabled
+func dialedHeader(title string) string {
+	if !r.NATEnabled() {
+		return ""
 	}
-	if slotsCount != 16384 {
-		color.Red("Master slot count is not 16384(%d). Some slots missing or migrating. Please check your cluster status.", slotsCount)
+	return fmt.Sprintf("%-24s", title)
+}
+
+// formatDialed returns the Dialed cell of a node, "" if address translation is not enabled
+func formatDialed(dialAddr string) string {
+	return dialedHeader(dialAddr)
+}
+
+// formatShardRole formats the role of a node that can not be connected
+func formatShardRole(role string, slavePrefix bool) string {
+	if slavePrefix {
+		return "-" + role
 	}
-	return nil
+	return role
 }
 
-func formatRole(i *r.Instance, slavePrefix bool) string {
-	role := i.Role
+func formatRole(n NodeReport, slavePrefix bool) string {
+	role := n.Role
 	if role == "" {
 		role = "unknown"
 	}
-	if i.LoadingError || i.SlaveInit {
+	if n.Loading || n.SlaveInit {
 		role += "(init)"
 	}
 	if slavePrefix {
@@ -218,95 +204,153 @@ func formatRole(i *r.Instance, slavePrefix bool) string {
 	return role
 }
 
-func formatMemory(i *r.Instance) string {
-	if i.LoadingError {
+func formatMemory(n NodeReport) string {
+	if n.Loading {
 		return "-"
 	}
-	return fmt.Sprintf("%.2f/%.2f", i.UsedMemory, i.MaxMemory)
+	return fmt.Sprintf("%.2f/%.2f", n.UsedMemoryGB, n.MaxMemoryGB)
 }
 
-func formatKeysCount(i *r.Instance) string {
-	if i.LoadingError || i.KeysCount == "" {
+func formatKeysCount(n NodeReport) string {
+	if n.Loading {
 		return "-"
 	}
-	return i.KeysCount
+	return strconv.FormatInt(n.Keys, 10)
 }
 
-func formatClients(i *r.Instance) string {
-	if i.LoadingError {
+func formatClients(n NodeReport) string {
+	if n.Loading {
 		return "-"
 	}
-	return fmt.Sprintf("%d/%d", i.ClientsCount, i.MaxClients)
+	return fmt.Sprintf("%d/%d", n.Clients, n.MaxClients)
 }
 
-// printMasterSlaveStatus print status of a master-slave/sentinel cluster, called by printClusterStatus
-func printMasterSlaveStatus(seedNode *r.Instance) error {
-	members, err := seedNode.GetMasterSlaveMembers()
+// PrintMasterSlaveStatus print status of a master-slave/sentinel cluster, called by printClusterStatus and sentinel status.
+// cascading slaves are displayed as an indented tree under their masters
+func PrintMasterSlaveStatus(seedNode *r.Instance) error {
+	tree, err := seedNode.GetReplicationTree()
 	if err != nil {
 		return err
 	}
+	defer tree.Close()
 	var (
-		master         *r.Instance
-		upSlaves       []*r.Instance
-		mu             sync.Mutex
-		wg             sync.WaitGroup
-		warnings       sync.Map     // instances can not be created err messages
-		errSlavesCount atomic.Int32 // slaves can not be created counter
+		upSlaves       int
+		errSlavesCount int
+		warnings       []string // nodes can not be created or replication cycles
 	)
-	// members can be retrieved means master is ok
-	master, _ = r.NewInstance(members[0])
-	defer master.Close()
-	// get slave instances simultaneously
-	for _, slave := range members[1:] {
-		wg.Add(1)
-		go func(addr string) {
-			defer wg.Done()
-			if i, err := r.NewInstance(addr); err != nil {
-				warnings.Store(addr, err)
-				errSlavesCount.Add(1)
-				return
-			} else {
-				mu.Lock()
-				upSlaves = append(upSlaves, i)
-				mu.Unlock()
-			}
-		}(slave)
-	}
-	wg.Wait()
 	// Print Cluster Basic Info
-	fmt.Println(strings.Repeat("=", 79))
+	width := 151 + len(formatDialed(""))
+	fmt.Println(strings.Repeat("=", width))
 	fmt.Printf("%-16s:\t%s\n", "Cluster Version", seedNode.Version)
-	fmt.Println(strings.Repeat("=", 79))
+	fmt.Println(strings.Repeat("=", width))
 	// Print Node Banner
-	color.Cyan("%-24s%-16s%-16s%-16s%s\n", "Address", "Role", "Memory(GB)", "KeysCount", "Clients")
-	fmt.Printf("%-24s%-16s%-16s%-16s%s\n", "-------", "----", "----------", "---------", "-------")
-	// print master info
-	fmt.Print(color.RedString("%-24s", master.Addr))
-	fmt.Printf("%-16s", formatRole(master, false))
-	fmt.Printf("%-16s", formatMemory(master))
-	fmt.Printf("%-16s", formatKeysCount(master))
-	fmt.Printf("%s\n", formatClients(master))
-	// print slaves info
-	sortedUpSlaves := r.InstancesAscByAddr(upSlaves)
-	sort.Sort(sortedUpSlaves)
-	for _, s := range sortedUpSlaves {
-		fmt.Printf("%-24s", s.Addr)
-		fmt.Printf("%-16s", formatRole(s, true))
-		fmt.Printf("%-16s", formatMemory(s))
-		fmt.Printf("%-16s", formatKeysCount(s))
-		fmt.Printf("%s\n", formatClients(s))
-	}
-	for _, i := range upSlaves {
-		i.Close()
-	}
-	color.Cyan("Total up slaves in cluster: %d\n", len(upSlaves))
-	if errSlavesCount.Load() != 0 {
+	color.Cyan("%-32s%s%-16s%-16s%-16s%-16s%-14s%-8s%-11s%s\n", "Address", dialedHeader("Dialed"), "Role", "Memory(GB)",
+		"KeysCount", "Clients", "Lag(B)", "Link", "LastIO(s)", "Backlog")
+	fmt.Printf("%-32s%s%-16s%-16s%-16s%-16s%-14s%-8s%-11s%s\n", "-------", dialedHeader("------"), "----", "----------",
+		"---------", "-------", "------", "----", "---------", "-------")
+	tree.Walk(func(n *r.ReplicationNode) {
+		addr := n.Addr
+		if n.Depth > 0 {
+			addr = strings.Repeat("  ", n.Depth-1) + "└─" + n.Addr
+		}
+		if n.Cycle {
+			errSlavesCount++
+			warnings = append(warnings, fmt.Sprintf("replication cycle detected, slave [addr=%s] is already in the tree", n.Addr))
+			fmt.Printf("%-32s%s%s\n", addr, formatDialed(r.DialAddr(n.Addr)), color.RedString("replication cycle"))
+			return
+		}
+		if n.Instance == nil {
+			errSlavesCount++
+			warnings = append(warnings, fmt.Sprintf("failed to create instance for slave [addr=%s], error: %v", n.Addr, n.Err))
+			fmt.Printf("%-32s%s%s\n", addr, formatDialed(r.DialAddr(n.Addr)), color.RedString("unreachable"))
+			return
+		}
+		node := NodeReport{Addr: n.Addr}
+		fillNodeReport(&node, n.Instance, nil)
+		if n.Depth == 0 {
+			// print master info
+			fmt.Print(color.RedString("%-32s", addr))
+			fmt.Print(formatDialed(node.DialAddr))
+			fmt.Printf("%-16s", formatRole(node, false))
+		} else {
+			upSlaves++
+			fmt.Printf("%-32s", addr)
+			fmt.Print(formatDialed(node.DialAddr))
+			fmt.Printf("%-16s", formatRole(node, true))
+		}
+		fmt.Printf("%-16s", formatMemory(node))
+		fmt.Printf("%-16s", formatKeysCount(node))
+		fmt.Printf("%-16s", formatClients(node))
+		if n.Link == nil {
+			fmt.Printf("%-14s%-8s%-11s", "", "", "")
+		} else {
+			// the lag is reported by the master of the slave, the link by the slave itself
+			node.LagBytes, node.Link, node.LastIO = n.Link.Lag, n.Link.Status, n.Link.LastIO
+			fmt.Print(formatReplication(node))
+		}
+		fmt.Println(formatBacklog(node))
+	})
+	color.Cyan("Total up slaves in cluster: %d\n", upSlaves)
+	if errSlavesCount != 0 {
 		color.Cyan("Warnings:")
-		warnings.Range(func(addr, err interface{}) bool {
-			color.Red("failed to create instance for slave [addr=%v], error: %v\n", addr, err)
-			return true
-		})
-		color.Cyan("Error slaves in cluster: %d\n", errSlavesCount.Load())
+		for _, w := range warnings {
+			color.Red("%s", w)
+		}
+		color.Cyan("Error slaves in cluster: %d\n", errSlavesCount)
 	}
 	return nil
 }
+
+// formatReplication formats Lag(B), Link and LastIO(s) columns of a slave.
+// stale or lagging slaves are highlighted in red, sync progress is shown in Lag(B) during full sync
+func formatReplication(n NodeReport) string {
+	if n.Loading {
+		return fmt.Sprintf("%-14s%-8s%-11s", "-", "-", "-")
+	}
+	var lagCell, linkCell, lastIOCell string
+	switch {
+	case n.SlaveInit && n.SyncProgress >= 0:
+		lagCell = color.YellowString("%-14s", fmt.Sprintf("sync %.1f%%", n.SyncProgress))
+	case n.SlaveInit:
+		lagCell = color.YellowString("%-14s", "sync")
+	case n.LagBytes < 0:
+		lagCell = fmt.Sprintf("%-14s", "-")
+	case n.LagBytes > lagThreshold:
+		lagCell = color.RedString("%-14d", n.LagBytes)
+	default:
+		lagCell = fmt.Sprintf("%-14d", n.LagBytes)
+	}
+	linkStatus := n.Link
+	if linkStatus == "" {
+		linkStatus = "-"
+	}
+	linkCell = fmt.Sprintf("%-8s", linkStatus)
+	if linkStatus != "up" {
+		linkCell = color.RedString("%-8s", linkStatus)
+	}
+	switch {
+	case n.LastIO < 0:
+		lastIOCell = fmt.Sprintf("%-11s", "-")
+	case n.LastIO > lastIOThreshold:
+		lastIOCell = color.RedString("%-11d", n.LastIO)
+	default:
+		lastIOCell = fmt.Sprintf("%-11d", n.LastIO)
+	}
+	return lagCell + linkCell + lastIOCell
+}
+
+// formatBacklog formats Backlog column: repl_backlog_size/seconds of writes it holds, red if it holds too few
+func formatBacklog(n NodeReport) string {
+	if n.Loading {
+		return fmt.Sprintf("%-18s", "-")
+	}
+	size := fmt.Sprintf("%.1fMB", float64(n.BacklogBytes)/1024/1024)
+	if n.BacklogSeconds < 0 {
+		return fmt.Sprintf("%-18s", size+"/-")
+	}
+	backlog := fmt.Sprintf("%s/%.0fs", size, n.BacklogSeconds)
+	if n.BacklogSeconds < minBacklogCoverage {
+		return color.RedString("%-18s", backlog)
+	}
+	return fmt.Sprintf("%-18s", backlog)
+}
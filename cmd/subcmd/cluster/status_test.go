@@ -0,0 +1,48 @@
+package cluster
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormatReplication(t *testing.T) {
+	tests := []struct {
+		name string
+		node NodeReport
+		want string
+	}{
+		{
+			name: "in sync",
+			node: NodeReport{Role: "slave", LagBytes: 10, Link: "up", LastIO: 1},
+			want: "10 up 1",
+		},
+		{
+			name: "master not reachable",
+			node: NodeReport{Role: "slave", LagBytes: -1, Link: "down", LastIO: -1},
+			want: "- down -",
+		},
+		{
+			name: "full sync",
+			node: NodeReport{Role: "slave", SlaveInit: true, SyncProgress: 42.5, LagBytes: -1, Link: "down", LastIO: -1},
+			want: "sync 42.5% down -",
+		},
+		{
+			name: "full sync of unknown size",
+			node: NodeReport{Role: "slave", SlaveInit: true, SyncProgress: -1, LagBytes: -1, Link: "down", LastIO: -1},
+			want: "sync down -",
+		},
+		{
+			name: "loading",
+			node: NodeReport{Role: "slave", Loading: true},
+			want: "- - -",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strings.Join(strings.Fields(formatReplication(tt.node)), " "); got != tt.want {
+				t.Fatalf("formatReplication() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,700 @@
+package cluster
+
+import (
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+	"os"
+	"redis-cluster-manager/config"
+	"redis-cluster-manager/perf"
+	r "redis-cluster-manager/redis"
+	"redis-cluster-manager/vars"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var uiInterval time.Duration // time between two refreshes of the dashboard
+
+// uiSortKeys are the orders of the node list, switched by `o`
+var uiSortKeys = []string{"shard", "addr", "memory", "ops", "health"}
+
+// uiTab is a pane of the node detail, the command is run on the selected node with execOn
+type uiTab struct {
+	Key  string
+	Name string
+	Args []string // nil for the info fetched by the last refresh
+}
+
+var uiTabs = []uiTab{
+	{Key: "i", Name: "Info"},
+	{Key: "c", Name: "Config", Args: []string{"CONFIG", "GET", "*"}},
+	{Key: "l", Name: "Clients", Args: []string{"CLIENT", "LIST"}},
+	{Key: "s", Name: "Slowlog", Args: []string{"SLOWLOG", "GET", "32"}},
+	{Key: "t", Name: "Latency", Args: []string{"LATENCY", "LATEST"}},
+}
+
+const uiHelp = "↑↓/jk select  i c l s t detail  PgUp/PgDn scroll  / filter  o sort  r reload  F failover  q quit"
+
+var UICmd = &cobra.Command{
+	Use:   "ui",
+	Short: "Interactive terminal dashboard of a cluster",
+	Long: `Full-screen dashboard of a cluster: the nodes grouped by shard with their health and rates, refreshed every
+--interval, and a detail pane of the selected node showing it's info, config, clients, slowlog or latency.
+The node list can be sorted and filtered. A slave can be promoted by a verified failover after confirmation.`,
+	Args:    cobra.ExactArgs(1),
+	Example: fmt.Sprintf("%s ui <seed-node> -a \"password\" [-i 2s]", vars.AppName),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vars.HostPort = config.ResolveSeed(args[0])
+		f := perf.StartCpuProfile()
+		defer perf.StopCpuProfile(f)
+		if err := runUI(vars.HostPort); err != nil {
+			return err
+		}
+		perf.MemProfile()
+		return nil
+	},
+}
+
+func InitUI() {
+	UICmd.Flags().DurationVarP(&uiInterval, "interval", "i", time.Second*2, "time between two refreshes")
+	UICmd.Flags().DurationVar(&failoverTimeout, "failover-timeout", time.Second*30, "max time to wait for a failover")
+}
+
+// uiRow is a node in the node list, copied from the watcher so that the event loop never reads it
+type uiRow struct {
+	Addr    string
+	NodeID  string
+	Shard   int // shard number in topology order, 0 if the master is unknown
+	Role    string
+	Health  string
+	Memory  int64
+	Ops     float64
+	Clients int // -1 if the node is down
+	Slots   int
+}
+
+// uiRows returns the nodes of w grouped by shards in topology order with their shard numbers, the nodes not in
+// shards, e.g. joined since the shards were fetched, follow in the order of w with shard 0
+func uiRows(w *clusterWatcher, shards []*r.Shard) []*uiRow {
+	var rows []*uiRow
+	listed := make(map[string]bool)
+	newRow := func(node *watchedNode) *uiRow {
+		listed[node.Addr] = true
+		row := &uiRow{Addr: node.Addr, NodeID: node.NodeID, Health: watchStatus(node.Cur), Memory: node.Cur.UsedMemory,
+			Ops: node.Cur.rate(node.Prev, "total_commands_processed"), Clients: -1, Slots: node.Slots}
+		if node.Cur.Err == nil && node.Instance != nil {
+			row.Clients = node.Instance.ClientsCount
+		}
+		return row
+	}
+	for n, shard := range shards {
+		for _, shardNode := range shard.Nodes {
+			node, exists := w.nodes[shardNode.Addr]
+			if !exists || listed[node.Addr] {
+				continue
+			}
+			row := newRow(node)
+			row.Shard, row.Role = n+1, formatShardRole(shardNode.Role, shardNode.Role != "master")
+			rows = append(rows, row)
+		}
+	}
+	for _, node := range w.order() {
+		if listed[node.Addr] {
+			continue
+		}
+		row := newRow(node)
+		row.Role = "-"
+		if node.Cur.Err == nil && node.Cur.Role != "" {
+			row.Role = node.Cur.Role
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// filterRows returns the rows whose addr, node ID, role or health contains filter, case-insensitively
+func filterRows(rows []*uiRow, filter string) []*uiRow {
+	filter = strings.ToLower(strings.TrimSpace(filter))
+	if filter == "" {
+		return rows
+	}
+	var filtered []*uiRow
+	for _, row := range rows {
+		for _, field := range []string{row.Addr, row.NodeID, row.Role, row.Health} {
+			if strings.Contains(strings.ToLower(field), filter) {
+				filtered = append(filtered, row)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// sortRows sorts rows by key, rows in topology order are kept for "shard" and ties
+func sortRows(rows []*uiRow, key string) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		switch key {
+		case "addr":
+			return r.CompareAddr(rows[i].Addr, rows[j].Addr) < 0
+		case "memory":
+			return rows[i].Memory > rows[j].Memory
+		case "ops":
+			return rows[i].Ops > rows[j].Ops
+		case "health":
+			return rows[i].Health != "ok" && rows[j].Health == "ok"
+		}
+		return false
+	})
+}
+
+// resultLines formats a result of execOn to lines like redis-cli does
+func resultLines(result interface{}) []string {
+	switch v := result.(type) {
+	case nil:
+		return []string{"(nil)"}
+	case string:
+		return strings.Split(strings.TrimRight(strings.ReplaceAll(v, "\r\n", "\n"), "\n"), "\n")
+	case int64:
+		return []string{fmt.Sprintf("(integer) %d", v)}
+	case []interface{}:
+		if len(v) == 0 {
+			return []string{"(empty array)"}
+		}
+		var lines []string
+		for n, item := range v {
+			prefix := fmt.Sprintf("%d) ", n+1)
+			for k, line := range resultLines(item) {
+				if k == 0 {
+					lines = append(lines, prefix+line)
+				} else {
+					lines = append(lines, strings.Repeat(" ", len(prefix))+line)
+				}
+			}
+		}
+		return lines
+	case map[interface{}]interface{}:
+		var keys []string
+		values := make(map[string]interface{})
+		for k, value := range v {
+			key := fmt.Sprint(k)
+			keys = append(keys, key)
+			values[key] = value
+		}
+		sort.Strings(keys)
+		var lines []string
+		for _, key := range keys {
+			valueLines := resultLines(values[key])
+			lines = append(lines, key+" "+valueLines[0])
+			for _, line := range valueLines[1:] {
+				lines = append(lines, strings.Repeat(" ", len(key)+1)+line)
+			}
+		}
+		return lines
+	}
+	return []string{fmt.Sprint(result)}
+}
+
+// fit truncates or pads s to width runes
+func fit(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	if n := utf8.RuneCountInString(s); n < width {
+		return s + strings.Repeat(" ", width-n)
+	}
+	return string([]rune(s)[:width])
+}
+
+// uiState is the state of the dashboard, it's only accessed by the event loop of runUI
+type uiState struct {
+	seed        string
+	version     string
+	jobs        chan<- uiJob
+	shards      []*r.Shard // of the last successful fetch
+	all         []*uiRow
+	rows        []*uiRow // filtered and sorted
+	changed     map[string]bool
+	selected    string // addr of the selected node
+	sortKey     int
+	filter      string
+	editing     bool // typing the filter
+	tab         int
+	detail      []string
+	detailAddr  string
+	detailTab   int
+	detailAt    time.Time
+	scroll      int
+	message     string
+	confirm     func(yes bool) // action waiting for `y`
+	refreshed   time.Time
+	refreshing  bool // a refresh job is running
+	loading     bool // a detail job is running
+	reload      bool // load the detail again once the running job is done
+	failingOver bool // a failover is being checked, confirmed or run
+}
+
+// uiJob is run by the worker of runUI, the only goroutine touching the watcher and the node connections, so that
+// slow nodes never block the keys. it returns the change of the state applied by the event loop
+type uiJob func(w *clusterWatcher) func(ui *uiState)
+
+// uiJobLimit is the buffer of the job and the result channels, at most one refresh, one detail and one failover
+// job are pending at the same time so that neither the event loop nor the worker blocks on a send
+const uiJobLimit = 4
+
+func runUI(hostPort string) error {
+	if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return fmt.Errorf("%s ui needs a terminal, use `%s cluster watch` instead", vars.AppName, vars.AppName)
+	}
+	seedNode, err := NewSeedNode(hostPort)
+	if err != nil {
+		return err
+	}
+	defer seedNode.Close()
+	if !seedNode.ClusterEnabled {
+		return fmt.Errorf("seed node %s is not a cluster node", seedNode.Addr)
+	}
+	w := &clusterWatcher{seedNode: seedNode, nodes: make(map[string]*watchedNode), version: seedNode.Version}
+	defer w.close()
+
+	jobs := make(chan uiJob, uiJobLimit)
+	results := make(chan func(*uiState), uiJobLimit)
+	quit, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case job := <-jobs:
+				results <- job(w)
+			case <-quit:
+				return
+			}
+		}
+	}()
+	// the connections are closed after the running job is done
+	defer func() {
+		close(quit)
+		<-done
+	}()
+
+	oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return fmt.Errorf("failed to set terminal to raw mode: %v", err)
+	}
+	defer term.Restore(int(os.Stdin.Fd()), oldState)
+	// alternate screen without cursor, restored on exit
+	fmt.Print("\033[?1049h\033[?25l")
+	defer fmt.Print("\033[?25h\033[?1049l")
+
+	keys := make(chan string, 16)
+	go readKeys(keys)
+	ui := &uiState{seed: seedNode.Addr, version: w.version, jobs: jobs, detailTab: -1}
+	ui.message = "Connecting to cluster nodes ..."
+	ui.refresh()
+	ticker := time.NewTicker(uiInterval)
+	defer ticker.Stop()
+	for {
+		ui.draw()
+		select {
+		case key, ok := <-keys:
+			if !ok || ui.handleKey(key) {
+				return nil
+			}
+		case apply := <-results:
+			apply(ui)
+		case <-ticker.C:
+			ui.refresh()
+		}
+	}
+}
+
+// readKeys reads keys from stdin in raw mode, escape sequences are sent as names: up, down, pgup, pgdn
+func readKeys(keys chan<- string) {
+	buf := make([]byte, 16)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			close(keys)
+			return
+		}
+		seq := string(buf[:n])
+		switch seq {
+		case "\033[A", "\033OA":
+			keys <- "up"
+		case "\033[B", "\033OB":
+			keys <- "down"
+		case "\033[5~":
+			keys <- "pgup"
+		case "\033[6~":
+			keys <- "pgdn"
+		case "\033":
+			keys <- "esc"
+		case "\r", "\n":
+			keys <- "enter"
+		case "\x7f", "\b":
+			keys <- "backspace"
+		default:
+			if strings.HasPrefix(seq, "\033") {
+				continue
+			}
+			for _, c := range seq {
+				keys <- string(c)
+			}
+		}
+	}
+}
+
+// refresh samples the cluster in the worker, ticks while a refresh is running are skipped
+func (ui *uiState) refresh() {
+	if ui.refreshing {
+		return
+	}
+	ui.refreshing = true
+	shards := ui.shards
+	ui.jobs <- func(w *clusterWatcher) func(*uiState) {
+		changed := w.refresh()
+		now := time.Now()
+		if fetched, err := w.clusterShards(); err == nil {
+			shards = fetched
+		} else {
+			w.addEvent(now, err.Error())
+		}
+		rows := uiRows(w, shards)
+		return func(ui *uiState) {
+			if ui.refreshed.IsZero() {
+				ui.message = ""
+			}
+			ui.refreshing = false
+			ui.changed, ui.refreshed, ui.shards, ui.all = changed, now, shards, rows
+			ui.update()
+			if ui.tab == 0 {
+				ui.loadDetail()
+			}
+		}
+	}
+}
+
+// update applies the filter and the order to the rows, and keeps the selection on a visible node
+func (ui *uiState) update() {
+	rows := filterRows(append([]*uiRow(nil), ui.all...), ui.filter)
+	sortRows(rows, uiSortKeys[ui.sortKey])
+	ui.rows = rows
+	if ui.selectedIndex() < 0 && len(rows) > 0 {
+		ui.selected = rows[0].Addr
+	}
+	if ui.detailAddr != ui.selected || ui.detailTab != ui.tab {
+		ui.loadDetail()
+	}
+}
+
+func (ui *uiState) selectedIndex() int {
+	for n, row := range ui.rows {
+		if row.Addr == ui.selected {
+			return n
+		}
+	}
+	return -1
+}
+
+// loadDetail loads the current tab of the selected node in the worker, if a load is running it's loaded again
+// once that one is done, as the selection or the tab may have changed meanwhile
+func (ui *uiState) loadDetail() {
+	if ui.loading {
+		ui.reload = true
+		return
+	}
+	ui.loading = true
+	addr, tab := ui.selected, ui.tab
+	ui.jobs <- func(w *clusterWatcher) func(*uiState) {
+		detail := nodeDetail(w.nodes[addr], tab)
+		return func(ui *uiState) {
+			ui.loading = false
+			if ui.detailAddr != addr || ui.detailTab != tab {
+				ui.scroll = 0
+			}
+			ui.detail, ui.detailAddr, ui.detailTab, ui.detailAt = detail, addr, tab, time.Now()
+			if ui.reload {
+				ui.reload = false
+				ui.loadDetail()
+			}
+		}
+	}
+}
+
+// nodeDetail returns the lines of tab of node, it's run by the worker
+func nodeDetail(node *watchedNode, tab int) []string {
+	switch {
+	case node == nil || node.Cur == nil:
+		return nil
+	case node.Cur.Err != nil || node.Instance == nil:
+		return []string{fmt.Sprintf("%v", node.Cur.Err)}
+	case uiTabs[tab].Args == nil:
+		var keys []string
+		for k := range node.Instance.Info {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var lines []string
+		for _, k := range keys {
+			lines = append(lines, k+":"+node.Instance.Info[k])
+		}
+		return lines
+	case config.IsForbidden(uiTabs[tab].Args[0]):
+		return []string{fmt.Sprintf("command `%s` is forbidden to execute", uiTabs[tab].Args[0])}
+	}
+	results := execOn([]*r.Instance{node.Instance}, uiTabs[tab].Args)
+	return resultLines(results[node.Instance.Addr])
+}
+
+// handleKey handles a key, returns true to quit
+func (ui *uiState) handleKey(key string) bool {
+	if ui.confirm != nil {
+		action := ui.confirm
+		ui.confirm = nil
+		action(key == "y" || key == "Y")
+		return false
+	}
+	if ui.editing {
+		switch key {
+		case "enter":
+			ui.editing = false
+		case "esc":
+			ui.editing, ui.filter = false, ""
+		case "backspace":
+			if n := utf8.RuneCountInString(ui.filter); n > 0 {
+				ui.filter = string([]rune(ui.filter)[:n-1])
+			}
+		default:
+			if utf8.RuneCountInString(key) == 1 && key >= " " {
+				ui.filter += key
+			}
+		}
+		ui.update()
+		return false
+	}
+	ui.message = ""
+	switch key {
+	case "q", "\x03":
+		return true
+	case "up", "k", "down", "j":
+		n := ui.selectedIndex()
+		if key == "up" || key == "k" {
+			n--
+		} else {
+			n++
+		}
+		if n >= 0 && n < len(ui.rows) {
+			ui.selected = ui.rows[n].Addr
+			ui.loadDetail()
+		}
+	case "pgup":
+		ui.scroll = max(0, ui.scroll-ui.detailHeight())
+	case "pgdn":
+		ui.scroll = max(0, min(ui.scroll+ui.detailHeight(), len(ui.detail)-ui.detailHeight()))
+	case "/":
+		ui.editing = true
+	case "esc":
+		ui.filter = ""
+		ui.update()
+	case "o":
+		ui.sortKey = (ui.sortKey + 1) % len(uiSortKeys)
+		ui.update()
+	case "r":
+		ui.loadDetail()
+	case "F":
+		ui.askFailover()
+	default:
+		for n, tab := range uiTabs {
+			if key == tab.Key {
+				ui.tab = n
+				ui.loadDetail()
+			}
+		}
+	}
+	return false
+}
+
+// askFailover checks the selected slave and it's master in the worker, then asks to promote the slave by a
+// verified failover
+func (ui *uiState) askFailover() {
+	if ui.failingOver {
+		ui.message = "A failover is in progress."
+		return
+	}
+	if err := config.CheckWritable("failover"); err != nil {
+		ui.message = err.Error()
+		return
+	}
+	ui.failingOver = true
+	addr := ui.selected
+	ui.jobs <- func(w *clusterWatcher) func(*uiState) {
+		master, err := failoverMaster(w, addr)
+		return func(ui *uiState) {
+			if err != nil {
+				ui.failingOver, ui.message = false, fmt.Sprintf("Can not fail over: %v.", err)
+				return
+			}
+			ui.message = fmt.Sprintf("Fail over master %s to %s? [y/N]", master, addr)
+			ui.confirm = func(yes bool) {
+				if !yes {
+					ui.failingOver, ui.message = false, "Cancelled."
+					return
+				}
+				ui.message = fmt.Sprintf("Failing over %s to %s ...", master, addr)
+				ui.failover(master, addr)
+			}
+		}
+	}
+}
+
+// failoverMaster returns the addr of the master of the slave at addr if both can be used for a failover, it's run
+// by the worker
+func failoverMaster(w *clusterWatcher, addr string) (string, error) {
+	slave := w.nodes[addr]
+	if slave == nil || slave.Instance == nil || slave.Cur.Err != nil || slave.Cur.Role != "slave" {
+		return "", fmt.Errorf("%s is not a reachable slave", addr)
+	}
+	master := w.masterOf(slave)
+	if master == nil || master.Instance == nil || master.Cur.Err != nil {
+		return "", fmt.Errorf("master %s of %s is not reachable", slave.Cur.Master, slave.Addr)
+	}
+	return master.Addr, nil
+}
+
+// failover promotes the slave of masterAddr by a verified failover in the worker, the nodes are looked up again
+// as a refresh may have run since they were checked
+func (ui *uiState) failover(masterAddr, slaveAddr string) {
+	ui.jobs <- func(w *clusterWatcher) func(*uiState) {
+		message := fmt.Sprintf("Failover finished, %s is the new master.", slaveAddr)
+		master, slave := w.nodes[masterAddr], w.nodes[slaveAddr]
+		if master == nil || master.Instance == nil || slave == nil || slave.Instance == nil {
+			message = fmt.Sprintf("Failover failed: %s or %s left the cluster", masterAddr, slaveAddr)
+		} else if err := verifiedFailover(master.Instance, slave.Instance); err != nil {
+			message = fmt.Sprintf("Failover failed: %v", err)
+		}
+		return func(ui *uiState) {
+			ui.failingOver, ui.message = false, message
+			ui.refresh()
+		}
+	}
+}
+
+func (ui *uiState) size() (int, int) {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width <= 0 || height <= 0 {
+		return 80, 24
+	}
+	return width, height
+}
+
+// tableHeight is the number of node rows shown, about half of the screen
+func (ui *uiState) tableHeight() int {
+	_, height := ui.size()
+	return max(3, (height-7)/2)
+}
+
+// detailHeight is the number of detail lines shown below the node list
+func (ui *uiState) detailHeight() int {
+	_, height := ui.size()
+	return max(1, height-7-ui.tableHeight())
+}
+
+// draw redraws the whole screen, the terminal is in raw mode so lines end with \r\n
+func (ui *uiState) draw() {
+	width, _ := ui.size()
+	var lines []string
+	add := func(line string, style func(string) string) {
+		line = fit(line, width)
+		if style != nil {
+			line = style(line)
+		}
+		lines = append(lines, line)
+	}
+	cyan := func(s string) string { return color.CyanString("%s", s) }
+	red := func(s string) string { return color.RedString("%s", s) }
+	yellow := func(s string) string { return color.YellowString("%s", s) }
+	reverse := func(s string) string { return color.New(color.ReverseVideo).Sprint(s) }
+
+	up := 0
+	for _, row := range ui.all {
+		if row.Health != "down" {
+			up++
+		}
+	}
+	add(fmt.Sprintf("%s ui  seed %s  version %s  nodes up %d/%d  refreshed %s", vars.AppName, ui.seed,
+		ui.version, up, len(ui.all), ui.refreshed.Format("15:04:05")), cyan)
+	filter := ui.filter
+	if ui.editing {
+		filter += "_"
+	}
+	add(fmt.Sprintf("sort: %s  filter: %s  shown %d", uiSortKeys[ui.sortKey], filter, len(ui.rows)), nil)
+	format := "%-7s%-24s%-10s%-12s%-10s%-10s%-10s%s"
+	add(fmt.Sprintf(format, "Shard", "Address", "Role", "Health", "Memory", "Ops/s", "Clients", "Slots"), cyan)
+
+	tableHeight := ui.tableHeight()
+	top := 0
+	if n := ui.selectedIndex(); n >= tableHeight {
+		top = n - tableHeight + 1
+	}
+	for n := top; n < top+tableHeight; n++ {
+		if n >= len(ui.rows) {
+			add("", nil)
+			continue
+		}
+		row := ui.rows[n]
+		shard, clients, slots := "-", "-", "-"
+		if row.Shard > 0 {
+			shard = strconv.Itoa(row.Shard)
+		}
+		if row.Clients >= 0 {
+			clients = strconv.Itoa(row.Clients)
+		}
+		if row.Role == "master" {
+			slots = strconv.Itoa(row.Slots)
+		}
+		line := fmt.Sprintf(format, shard, row.Addr, row.Role, row.Health, r.FormatBytes(float64(row.Memory)),
+			formatRate(row.Ops, 1), clients, slots)
+		var style func(string) string
+		switch {
+		case row.Addr == ui.selected:
+			style = reverse
+		case row.Health != "ok":
+			style = red
+		case ui.changed[row.Addr]:
+			style = yellow
+		}
+		add(line, style)
+	}
+
+	var tabs []string
+	for n, tab := range uiTabs {
+		name := "[" + tab.Key + "]" + tab.Name
+		if n == ui.tab {
+			name = "<" + name + ">"
+		}
+		tabs = append(tabs, name)
+	}
+	fetched := "fetched " + ui.detailAt.Format("15:04:05")
+	if ui.loading {
+		fetched = "loading ..."
+	}
+	add(fmt.Sprintf("%s  %s  %s", ui.detailAddr, strings.Join(tabs, " "), fetched), cyan)
+	detailHeight := ui.detailHeight()
+	for n := ui.scroll; n < ui.scroll+detailHeight; n++ {
+		if n < len(ui.detail) {
+			add(ui.detail[n], nil)
+		} else {
+			add("", nil)
+		}
+	}
+	if ui.confirm != nil {
+		add(ui.message, yellow)
+	} else {
+		add(ui.message, nil)
+	}
+	add(uiHelp, cyan)
+	fmt.Print("\033[H" + strings.Join(lines, "\r\n") + "\033[J")
+}
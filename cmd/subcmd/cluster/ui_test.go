@@ -0,0 +1,137 @@
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	r "redis-cluster-manager/redis"
+	"reflect"
+	"testing"
+)
+
+func TestResultLines(t *testing.T) {
+	cases := []struct {
+		result   interface{}
+		expected []string
+	}{
+		{nil, []string{"(nil)"}},
+		{"id=1 addr=a\nid=2 addr=b\n", []string{"id=1 addr=a", "id=2 addr=b"}},
+		{int64(3), []string{"(integer) 3"}},
+		{[]interface{}{}, []string{"(empty array)"}},
+		{[]interface{}{[]interface{}{int64(1), "get k"}, "x"}, []string{"1) 1) (integer) 1", "   2) get k", "2) x"}},
+		{map[interface{}]interface{}{"maxmemory": "0", "appendonly": "no"}, []string{"appendonly no", "maxmemory 0"}},
+	}
+	for _, c := range cases {
+		if lines := resultLines(c.result); !reflect.DeepEqual(lines, c.expected) {
+			t.Errorf("resultLines(%v) = %q, want %q", c.result, lines, c.expected)
+		}
+	}
+}
+
+func TestFilterAndSortRows(t *testing.T) {
+	newRow := func(addr, nodeID, role, health string, memory int64) *uiRow {
+		return &uiRow{Addr: addr, NodeID: nodeID, Role: role, Health: health, Memory: memory}
+	}
+	rows := []*uiRow{
+		newRow("10.0.0.1:6379", "m1", "master", "ok", 100),
+		newRow("10.0.0.2:6380", "s1", "-slave", "link down", 300),
+		newRow("10.0.0.2:6379", "m2", "master", "ok", 200),
+	}
+	addrs := func(rows []*uiRow) []string {
+		var result []string
+		for _, row := range rows {
+			result = append(result, row.Addr)
+		}
+		return result
+	}
+	if got := addrs(filterRows(rows, " 10.0.0.2")); !reflect.DeepEqual(got, []string{"10.0.0.2:6380", "10.0.0.2:6379"}) {
+		t.Errorf("filterRows(10.0.0.2) = %v", got)
+	}
+	if got := addrs(filterRows(rows, "SLAVE")); !reflect.DeepEqual(got, []string{"10.0.0.2:6380"}) {
+		t.Errorf("filterRows(SLAVE) = %v", got)
+	}
+	sortRows(rows, "memory")
+	if got := addrs(rows); !reflect.DeepEqual(got, []string{"10.0.0.2:6380", "10.0.0.2:6379", "10.0.0.1:6379"}) {
+		t.Errorf("sortRows(memory) = %v", got)
+	}
+	sortRows(rows, "addr")
+	if got := addrs(rows); !reflect.DeepEqual(got, []string{"10.0.0.1:6379", "10.0.0.2:6379", "10.0.0.2:6380"}) {
+		t.Errorf("sortRows(addr) = %v", got)
+	}
+	sortRows(rows, "health")
+	if got := addrs(rows); !reflect.DeepEqual(got, []string{"10.0.0.2:6380", "10.0.0.1:6379", "10.0.0.2:6379"}) {
+		t.Errorf("sortRows(health) = %v", got)
+	}
+}
+
+func TestFit(t *testing.T) {
+	if got := fit("abc", 5); got != "abc  " {
+		t.Errorf("fit() = %q, want %q", got, "abc  ")
+	}
+	if got := fit("↑↓abc", 3); got != "↑↓a" {
+		t.Errorf("fit() = %q, want %q", got, "↑↓a")
+	}
+}
+
+func TestUIRows(t *testing.T) {
+	w := &clusterWatcher{nodes: map[string]*watchedNode{
+		"10.0.0.1:6379": {Addr: "10.0.0.1:6379", Cur: &watchSample{Role: "master"}},
+		"10.0.0.2:6380": {Addr: "10.0.0.2:6380", Cur: &watchSample{Role: "slave", Master: "10.0.0.1:6379", LinkStatus: "up"}},
+		// the master of the second shard is down, it's slave still reports it as master
+		"10.0.0.2:6379": {Addr: "10.0.0.2:6379", Cur: &watchSample{Err: errors.New("connection refused")}},
+		"10.0.0.1:6380": {Addr: "10.0.0.1:6380", Cur: &watchSample{Role: "slave", Master: "10.0.0.2:6379", LinkStatus: "down"}},
+		// joined after the shards were fetched
+		"10.0.0.3:6379": {Addr: "10.0.0.3:6379", Cur: &watchSample{Role: "master"}},
+	}}
+	shards := []*r.Shard{
+		{Nodes: []*r.ShardNode{{Addr: "10.0.0.1:6379", Role: "master"}, {Addr: "10.0.0.2:6380", Role: "slave"}}},
+		{Nodes: []*r.ShardNode{{Addr: "10.0.0.2:6379", Role: "master"}, {Addr: "10.0.0.1:6380", Role: "slave"}}},
+	}
+	var got []string
+	for _, row := range uiRows(w, shards) {
+		got = append(got, fmt.Sprintf("%s %d %s %s", row.Addr, row.Shard, row.Role, row.Health))
+	}
+	want := []string{
+		"10.0.0.1:6379 1 master ok",
+		"10.0.0.2:6380 1 -slave ok",
+		"10.0.0.2:6379 2 master down",
+		"10.0.0.1:6380 2 -slave link down",
+		"10.0.0.3:6379 0 master ok",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("uiRows() = %q, want %q", got, want)
+	}
+}
+
+func TestFailoverMaster(t *testing.T) {
+	w := &clusterWatcher{nodes: map[string]*watchedNode{
+		"10.0.0.1:6379": {Addr: "10.0.0.1:6379", NodeID: "m1", Instance: &r.Instance{}, Cur: &watchSample{Role: "master"}},
+		"10.0.0.2:6379": {Addr: "10.0.0.2:6379", NodeID: "s1", MasterID: "m1", Instance: &r.Instance{},
+			Cur: &watchSample{Role: "slave"}},
+		"10.0.0.3:6379": {Addr: "10.0.0.3:6379", NodeID: "m2", Cur: &watchSample{Err: errors.New("connection refused")}},
+		"10.0.0.4:6379": {Addr: "10.0.0.4:6379", NodeID: "s2", MasterID: "m2", Instance: &r.Instance{},
+			Cur: &watchSample{Role: "slave"}},
+	}}
+	tests := []struct {
+		name    string
+		addr    string
+		want    string
+		wantErr bool
+	}{
+		{name: "slave of a reachable master", addr: "10.0.0.2:6379", want: "10.0.0.1:6379"},
+		{name: "master selected", addr: "10.0.0.1:6379", wantErr: true},
+		{name: "master down", addr: "10.0.0.4:6379", wantErr: true},
+		{name: "no node selected", addr: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := failoverMaster(w, tt.addr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("failoverMaster() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("failoverMaster() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
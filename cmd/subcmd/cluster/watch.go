@@ -0,0 +1,486 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+	"math"
+	"os"
+	"os/signal"
+	"redis-cluster-manager/config"
+	"redis-cluster-manager/perf"
+	r "redis-cluster-manager/redis"
+	"redis-cluster-manager/vars"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	watchInterval time.Duration // time between two refreshes
+	watchCount    int           // number of refreshes, 0 for endless
+	watchMemJump  float64       // min used memory change in percent to be highlighted
+)
+
+// watchEventLimit is the number of latest changes shown below the table
+const watchEventLimit = 10
+
+// watchCounters are the cumulative counters of `info all` shown as per second rates, in column order
+var watchCounters = []string{"total_commands_processed", "total_net_input_bytes", "total_net_output_bytes",
+	"keyspace_hits", "keyspace_misses", "evicted_keys", "expired_keys"}
+
+var WatchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Refresh the cluster status periodically with rates and changes",
+	Long: `Keep connections to all cluster nodes open and refresh their info every --interval. Per node rates of ops,
+network input/output, keyspace hits/misses, evicted and expired keys are shown, nodes changed since the last refresh
+are highlighted and the latest changes are listed: role flips, failures, restarts, replication links and memory jumps.
+The table is redrawn in place on a terminal. Press Ctrl-C to quit.`,
+	Args:    cobra.ExactArgs(1),
+	Example: fmt.Sprintf("%s cluster watch <seed-node> -a \"password\" [-i 2s]", vars.AppName),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vars.HostPort = config.ResolveSeed(args[0])
+		f := perf.StartCpuProfile()
+		defer perf.StopCpuProfile(f)
+		if err := watchCluster(vars.HostPort); err != nil {
+			return err
+		}
+		perf.MemProfile()
+		return nil
+	},
+}
+
+func InitWatch() {
+	WatchCmd.Flags().DurationVarP(&watchInterval, "interval", "i", time.Second*2, "time between two refreshes")
+	WatchCmd.Flags().IntVar(&watchCount, "count", 0, "number of refreshes, 0 for endless")
+	WatchCmd.Flags().Float64Var(&watchMemJump, "mem-jump", 10, "min used memory change in percent to be highlighted")
+}
+
+// watchSample is the state of a node at a refresh
+type watchSample struct {
+	At         time.Time
+	Err        error
+	Loading    bool
+	Role       string
+	Master     string
+	LinkStatus string
+	Flags      string // fail or fail? seen by the cluster, "" if none
+	UsedMemory int64  // used_memory in bytes
+	Uptime     int64  // uptime_in_seconds
+	Counters   map[string]int64
+}
+
+// watchedNode is a cluster node with it's open instance, nil if it can not be connected
+type watchedNode struct {
+	Addr     string
+	NodeID   string
+	MasterID string // master node ID seen by the cluster, "" if it's a master
+	Slots    int    // number of slots served, seen by the cluster
+	Instance *r.Instance
+	Prev     *watchSample
+	Cur      *watchSample
+}
+
+func newWatchSample(i *r.Instance, err error, at time.Time) *watchSample {
+	s := &watchSample{At: at, Err: err, Counters: make(map[string]int64)}
+	if err != nil || i == nil {
+		return s
+	}
+	s.Loading = i.LoadingError
+	s.Role, s.Master, s.LinkStatus = i.Role, i.Master, i.MasterLinkStatus
+	s.UsedMemory, _ = strconv.ParseInt(i.Info["used_memory"], 10, 64)
+	s.Uptime, _ = strconv.ParseInt(i.Info["uptime_in_seconds"], 10, 64)
+	for _, counter := range watchCounters {
+		if v, err := strconv.ParseInt(i.Info[counter], 10, 64); err == nil {
+			s.Counters[counter] = v
+		}
+	}
+	return s
+}
+
+// rate returns the per second rate of counter since prev, -1 if unknown or the counter was reset by a restart
+func (s *watchSample) rate(prev *watchSample, counter string) float64 {
+	if prev == nil || s.Err != nil || prev.Err != nil {
+		return -1
+	}
+	cur, curOK := s.Counters[counter]
+	last, lastOK := prev.Counters[counter]
+	seconds := s.At.Sub(prev.At).Seconds()
+	if !curOK || !lastOK || cur < last || seconds <= 0 {
+		return -1
+	}
+	return float64(cur-last) / seconds
+}
+
+// watchChanges returns the changes of a node from prev to cur worth highlighting
+func watchChanges(addr string, prev, cur *watchSample, memJump float64) []string {
+	if prev == nil {
+		return nil
+	}
+	if prev.Err == nil && cur.Err != nil {
+		return []string{fmt.Sprintf("%s is down: %v", addr, cur.Err)}
+	}
+	if prev.Err != nil && cur.Err == nil {
+		return []string{fmt.Sprintf("%s is up again as %s", addr, cur.Role)}
+	}
+	if cur.Err != nil {
+		return nil
+	}
+	var changes []string
+	if cur.Uptime < prev.Uptime {
+		changes = append(changes, fmt.Sprintf("%s restarted", addr))
+	}
+	if prev.Loading != cur.Loading {
+		if cur.Loading {
+			changes = append(changes, fmt.Sprintf("%s is loading", addr))
+		} else {
+			changes = append(changes, fmt.Sprintf("%s finished loading", addr))
+		}
+	}
+	if prev.Role != cur.Role && prev.Role != "" && cur.Role != "" {
+		changes = append(changes, fmt.Sprintf("%s role changed: %s -> %s", addr, prev.Role, cur.Role))
+	} else if cur.Role == "slave" && prev.Master != cur.Master {
+		changes = append(changes, fmt.Sprintf("%s master changed: %s -> %s", addr, prev.Master, cur.Master))
+	}
+	if cur.Role == "slave" && prev.Role == "slave" && prev.LinkStatus != cur.LinkStatus {
+		changes = append(changes, fmt.Sprintf("%s master link %s -> %s", addr, prev.LinkStatus, cur.LinkStatus))
+	}
+	if prev.Flags != cur.Flags {
+		changes = append(changes, fmt.Sprintf("%s flags changed: %s -> %s", addr, formatFlags(prev.Flags), formatFlags(cur.Flags)))
+	}
+	if prev.UsedMemory > 0 {
+		percent := float64(cur.UsedMemory-prev.UsedMemory) / float64(prev.UsedMemory) * 100
+		if math.Abs(percent) >= memJump {
+			changes = append(changes, fmt.Sprintf("%s used memory %s -> %s (%+.0f%%)", addr,
+				r.FormatBytes(float64(prev.UsedMemory)), r.FormatBytes(float64(cur.UsedMemory)), percent))
+		}
+	}
+	return changes
+}
+
+// watchStatus returns the health of a sampled node: ok, down, loading, fail flags or the down replication link
+func watchStatus(s *watchSample) string {
+	switch {
+	case s.Err != nil:
+		return "down"
+	case s.Loading:
+		return "loading"
+	case s.Flags != "":
+		return s.Flags
+	case s.Role == "slave" && s.LinkStatus != "up":
+		return "link " + s.LinkStatus
+	}
+	return "ok"
+}
+
+func formatFlags(flags string) string {
+	if flags == "" {
+		return "none"
+	}
+	return flags
+}
+
+func formatRate(rate float64, divisor float64) string {
+	if rate < 0 {
+		return "-"
+	}
+	if divisor == 1 {
+		return strconv.FormatFloat(rate, 'f', 0, 64)
+	}
+	return strconv.FormatFloat(rate/divisor, 'f', 1, 64)
+}
+
+// clusterWatcher keeps the watched nodes and the latest changes between refreshes
+type clusterWatcher struct {
+	seedNode *r.Instance
+	nodes    map[string]*watchedNode // by addr
+	events   []string
+	version  string
+}
+
+func watchCluster(hostPort string) error {
+	seedNode, err := NewSeedNode(hostPort)
+	if err != nil {
+		return err
+	}
+	defer seedNode.Close()
+	if !seedNode.ClusterEnabled {
+		return fmt.Errorf("seed node %s is not a cluster node", seedNode.Addr)
+	}
+	w := &clusterWatcher{seedNode: seedNode, nodes: make(map[string]*watchedNode), version: seedNode.Version}
+	defer w.close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	inPlace := term.IsTerminal(int(os.Stdout.Fd()))
+	if inPlace {
+		fmt.Print("\033[H\033[2J")
+	}
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for n := 1; ; n++ {
+		changed := w.refresh()
+		screen := w.render(changed)
+		if inPlace {
+			// redraw from the top left, clearing the rest of every line and of the screen
+			fmt.Print("\033[H" + strings.ReplaceAll(screen, "\n", "\033[K\n") + "\033[J")
+		} else {
+			fmt.Print(screen)
+		}
+		if watchCount > 0 && n >= watchCount {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			fmt.Println()
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *clusterWatcher) close() {
+	for _, node := range w.nodes {
+		if node.Instance != nil {
+			node.Instance.Close()
+		}
+	}
+}
+
+// clusterNodes gets `cluster nodes` from the seed node, or from any connected node if the seed node fails
+func (w *clusterWatcher) clusterNodes() ([]*r.ClusterNode, error) {
+	nodes, err := r.GetClusterNodes(w.seedNode.Client)
+	if err == nil {
+		return nodes, nil
+	}
+	for _, node := range w.nodes {
+		if node.Instance != nil && node.Cur != nil && node.Cur.Err == nil {
+			if nodes, e := r.GetClusterNodes(node.Instance.Client); e == nil {
+				return nodes, nil
+			}
+		}
+	}
+	return nil, err
+}
+
+// clusterShards gets `cluster shards` from the seed node, or from any connected node if the seed node fails
+func (w *clusterWatcher) clusterShards() ([]*r.Shard, error) {
+	shards, err := r.GetClusterShards(w.seedNode.Client)
+	if err == nil {
+		return shards, nil
+	}
+	for _, node := range w.nodes {
+		if node.Instance != nil && node.Cur != nil && node.Cur.Err == nil {
+			if shards, e := r.GetClusterShards(node.Instance.Client); e == nil {
+				return shards, nil
+			}
+		}
+	}
+	return nil, err
+}
+
+// refresh updates the node list and samples all nodes simultaneously, returns the addrs of changed nodes
+func (w *clusterWatcher) refresh() map[string]bool {
+	now := time.Now()
+	changed := make(map[string]bool)
+	clusterNodes, err := w.clusterNodes()
+	if err != nil {
+		w.addEvent(now, err.Error())
+	}
+	flags := make(map[string]string)
+	if err == nil {
+		seen := make(map[string]bool)
+		for _, n := range clusterNodes {
+			if !dialable(n) {
+				continue
+			}
+			seen[n.Addr] = true
+			var failFlags []string
+			for _, flag := range []string{"fail", "fail?"} {
+				if n.HasFlag(flag) {
+					failFlags = append(failFlags, flag)
+				}
+			}
+			flags[n.Addr] = strings.Join(failFlags, ",")
+			node, exists := w.nodes[n.Addr]
+			if !exists {
+				node = &watchedNode{Addr: n.Addr}
+				w.nodes[n.Addr] = node
+				if w.hasSamples() {
+					w.addEvent(now, fmt.Sprintf("%s joined the cluster", n.Addr))
+					changed[n.Addr] = true
+				}
+			}
+			node.NodeID, node.MasterID, node.Slots = n.NodeID, n.MasterID, n.GetSlotCount()
+		}
+		for addr, node := range w.nodes {
+			if !seen[addr] {
+				w.addEvent(now, fmt.Sprintf("%s left the cluster", addr))
+				if node.Instance != nil {
+					node.Instance.Close()
+				}
+				delete(w.nodes, addr)
+			}
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, node := range w.nodes {
+		wg.Add(1)
+		go func(node *watchedNode) {
+			defer wg.Done()
+			var err error
+			if node.Instance == nil {
+				node.Instance, err = r.NewInstance(node.Addr)
+			} else {
+				err = node.Instance.Refresh()
+			}
+			node.Prev = node.Cur
+			node.Cur = newWatchSample(node.Instance, err, time.Now())
+		}(node)
+	}
+	wg.Wait()
+
+	var addrs []string
+	for addr := range w.nodes {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return r.CompareAddr(addrs[i], addrs[j]) < 0 })
+	for _, addr := range addrs {
+		node := w.nodes[addr]
+		node.Cur.Flags = flags[addr]
+		if node.Prev != nil && err != nil {
+			// cluster nodes failed, keep the last known flags
+			node.Cur.Flags = node.Prev.Flags
+		}
+		for _, change := range watchChanges(addr, node.Prev, node.Cur, watchMemJump) {
+			w.addEvent(now, change)
+			changed[addr] = true
+		}
+	}
+	return changed
+}
+
+// hasSamples reports whether the nodes have been sampled at least once
+func (w *clusterWatcher) hasSamples() bool {
+	for _, node := range w.nodes {
+		if node.Cur != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *clusterWatcher) addEvent(at time.Time, event string) {
+	w.events = append(w.events, at.Format("15:04:05")+" "+event)
+	if len(w.events) > watchEventLimit {
+		w.events = w.events[len(w.events)-watchEventLimit:]
+	}
+}
+
+// masterOf returns the master of node seen by the cluster, nil if it's not watched. the master addr of
+// `info replication` is not used, it may differ from the addr announced in `cluster nodes`
+func (w *clusterWatcher) masterOf(node *watchedNode) *watchedNode {
+	if node.MasterID == "" {
+		return nil
+	}
+	for _, m := range w.nodes {
+		if m.NodeID == node.MasterID {
+			return m
+		}
+	}
+	return nil
+}
+
+// order returns the nodes as masters ordered by addr each followed by it's slaves, then down and orphaned nodes
+func (w *clusterWatcher) order() []*watchedNode {
+	var masters, others []*watchedNode
+	slaves := make(map[string][]*watchedNode)
+	for _, node := range w.nodes {
+		master := w.masterOf(node)
+		switch {
+		case node.Cur.Err == nil && node.Cur.Role == "master":
+			masters = append(masters, node)
+		case node.Cur.Err == nil && node.Cur.Role == "slave" && master != nil:
+			slaves[master.Addr] = append(slaves[master.Addr], node)
+		default:
+			others = append(others, node)
+		}
+	}
+	byAddr := func(nodes []*watchedNode) {
+		sort.Slice(nodes, func(i, j int) bool { return r.CompareAddr(nodes[i].Addr, nodes[j].Addr) < 0 })
+	}
+	byAddr(masters)
+	byAddr(others)
+	var ordered []*watchedNode
+	for _, m := range masters {
+		ordered = append(ordered, m)
+		byAddr(slaves[m.Addr])
+		ordered = append(ordered, slaves[m.Addr]...)
+		delete(slaves, m.Addr)
+	}
+	// slaves of a slave or a down master
+	var rest []*watchedNode
+	for _, s := range slaves {
+		rest = append(rest, s...)
+	}
+	byAddr(rest)
+	return append(append(ordered, rest...), others...)
+}
+
+func (w *clusterWatcher) render(changed map[string]bool) string {
+	var b strings.Builder
+	b.WriteString(strings.Repeat("=", 150) + "\n")
+	b.WriteString(fmt.Sprintf("%-16s:\t%s\n", "Cluster Version", w.version))
+	b.WriteString(fmt.Sprintf("%-16s:\t%s (every %v)\n", "Refreshed At", time.Now().Format("2006-01-02 15:04:05"), watchInterval))
+	b.WriteString(strings.Repeat("=", 150) + "\n")
+	format := "%-24s%-14s%-12s%-10s%-12s%-12s%-10s%-10s%-10s%-10s%s\n"
+	b.WriteString(color.CyanString(format, "Address", "Role", "Memory", "Ops/s", "NetIn(KB/s)", "NetOut(KB/s)",
+		"Hits/s", "Misses/s", "Evicted/s", "Expired/s", "Status"))
+	b.WriteString(fmt.Sprintf(format, "-------", "----", "------", "-----", "-----------", "------------",
+		"------", "--------", "---------", "---------", "------"))
+	upMasters, upNodes := 0, 0
+	for _, node := range w.order() {
+		cur := node.Cur
+		if cur.Err != nil {
+			b.WriteString(color.RedString("%-24s%s\n", node.Addr, fmt.Sprintf("%v", cur.Err)))
+			continue
+		}
+		upNodes++
+		role := formatShardRole(cur.Role, cur.Role == "slave")
+		if cur.Role == "master" {
+			upMasters++
+		}
+		status := watchStatus(cur)
+		rates := make([]string, len(watchCounters))
+		for n, counter := range watchCounters {
+			divisor := 1.0
+			if strings.HasPrefix(counter, "total_net_") {
+				divisor = 1024
+			}
+			rates[n] = formatRate(cur.rate(node.Prev, counter), divisor)
+		}
+		line := fmt.Sprintf(format, node.Addr, role, r.FormatBytes(float64(cur.UsedMemory)), rates[0], rates[1], rates[2],
+			rates[3], rates[4], rates[5], rates[6], status)
+		switch {
+		case status != "ok":
+			line = color.RedString("%s", line)
+		case changed[node.Addr]:
+			line = color.YellowString("%s", line)
+		}
+		b.WriteString(line)
+	}
+	b.WriteString(fmt.Sprintf("Total up masters in cluster: %d\n", upMasters))
+	b.WriteString(fmt.Sprintf("Total up members in cluster: %d\n", upNodes))
+	if len(w.events) > 0 {
+		b.WriteString(color.CyanString("Latest changes:\n"))
+		for _, event := range w.events {
+			b.WriteString("  " + event + "\n")
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,115 @@
+package cluster
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWatchSampleRate(t *testing.T) {
+	start := time.Unix(1000, 0)
+	prev := &watchSample{At: start, Role: "master", Uptime: 100, Counters: map[string]int64{"total_commands_processed": 1000}}
+	tests := []struct {
+		name    string
+		prev    *watchSample
+		cur     *watchSample
+		counter string
+		want    float64
+	}{
+		{
+			name: "per second",
+			prev: prev,
+			cur: &watchSample{At: start.Add(2 * time.Second), Role: "master", Uptime: 102,
+				Counters: map[string]int64{"total_commands_processed": 3000}},
+			counter: "total_commands_processed",
+			want:    1000,
+		},
+		{
+			name: "without prev",
+			cur: &watchSample{At: start.Add(2 * time.Second), Role: "master", Uptime: 102,
+				Counters: map[string]int64{"total_commands_processed": 3000}},
+			counter: "total_commands_processed",
+			want:    -1,
+		},
+		{
+			name: "missing counter",
+			prev: prev,
+			cur: &watchSample{At: start.Add(2 * time.Second), Role: "master", Uptime: 102,
+				Counters: map[string]int64{"total_commands_processed": 3000}},
+			counter: "evicted_keys",
+			want:    -1,
+		},
+		{
+			name: "counters reset by a restart",
+			prev: prev,
+			cur: &watchSample{At: start.Add(2 * time.Second), Role: "master", Uptime: 2,
+				Counters: map[string]int64{"total_commands_processed": 10}},
+			counter: "total_commands_processed",
+			want:    -1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rate := tt.cur.rate(tt.prev, tt.counter); rate != tt.want {
+				t.Fatalf("rate() = %v, want %v", rate, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatchChanges(t *testing.T) {
+	start := time.Unix(1000, 0)
+	prev := &watchSample{At: start, Role: "master", UsedMemory: 1 << 30, Uptime: 100}
+	cur := &watchSample{At: start.Add(time.Second), Role: "master", UsedMemory: 1 << 30, Uptime: 101}
+	if changes := watchChanges("10.0.0.1:6379", prev, cur, 10); len(changes) != 0 {
+		t.Errorf("watchChanges() = %v, want no change", changes)
+	}
+
+	cur.Role, cur.Master, cur.LinkStatus = "slave", "10.0.0.2:6379", "up"
+	cur.Uptime = 5
+	cur.Flags = "fail?"
+	cur.UsedMemory = 1 << 29
+	expected := []string{
+		"10.0.0.1:6379 restarted",
+		"10.0.0.1:6379 role changed: master -> slave",
+		"10.0.0.1:6379 flags changed: none -> fail?",
+		"10.0.0.1:6379 used memory 1.0GB -> 512.0MB (-50%)",
+	}
+	if changes := watchChanges("10.0.0.1:6379", prev, cur, 10); !reflect.DeepEqual(changes, expected) {
+		t.Errorf("watchChanges() = %v, want %v", changes, expected)
+	}
+
+	down := &watchSample{At: start.Add(time.Second), Err: errors.New("connection refused")}
+	expected = []string{"10.0.0.1:6379 is down: connection refused"}
+	if changes := watchChanges("10.0.0.1:6379", prev, down, 10); !reflect.DeepEqual(changes, expected) {
+		t.Errorf("watchChanges() = %v, want %v", changes, expected)
+	}
+	expected = []string{"10.0.0.1:6379 is up again as master"}
+	if changes := watchChanges("10.0.0.1:6379", down, prev, 10); !reflect.DeepEqual(changes, expected) {
+		t.Errorf("watchChanges() = %v, want %v", changes, expected)
+	}
+}
+
+func TestWatchOrder(t *testing.T) {
+	// the slaves report the master by it's hostname, the cluster announces it's ip
+	w := &clusterWatcher{nodes: map[string]*watchedNode{
+		"10.0.0.2:6379": {Addr: "10.0.0.2:6379", NodeID: "m2", Cur: &watchSample{Role: "master"}},
+		"10.0.0.1:6379": {Addr: "10.0.0.1:6379", NodeID: "m1", Cur: &watchSample{Role: "master"}},
+		"10.0.0.2:6380": {Addr: "10.0.0.2:6380", NodeID: "s1", MasterID: "m1",
+			Cur: &watchSample{Role: "slave", Master: "redis-1.example.com:6379"}},
+		"10.0.0.1:6380": {Addr: "10.0.0.1:6380", NodeID: "s2", MasterID: "m2",
+			Cur: &watchSample{Role: "slave", Master: "redis-2.example.com:6379"}},
+		"10.0.0.3:6379": {Addr: "10.0.0.3:6379", NodeID: "s3", MasterID: "m3", Cur: &watchSample{Role: "slave"}},
+		"10.0.0.4:6379": {Addr: "10.0.0.4:6379", Cur: &watchSample{Err: errors.New("connection refused")}},
+	}}
+	var got []string
+	for _, node := range w.order() {
+		got = append(got, node.Addr)
+	}
+	want := []string{"10.0.0.1:6379", "10.0.0.2:6380", "10.0.0.2:6379", "10.0.0.1:6380", "10.0.0.3:6379", "10.0.0.4:6379"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("order() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,268 @@
+package cluster
+
+import (
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"redis-cluster-manager/config"
+	"redis-cluster-manager/perf"
+	r "redis-cluster-manager/redis"
+	"redis-cluster-manager/vars"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	downSpecs []string // nodes to be simulated as down: host=<ip>[,<ip>...] or [node=]<nodeID>[,<nodeID>...]
+)
+
+var WhatifCmd = &cobra.Command{
+	Use:   "whatif",
+	Short: "Simulate the impact of hosts or nodes going down",
+	Long: `Use the current topology and slave placement to work out what happens if the given hosts or nodes go down:
+which masters fail over to which slaves, which slots lose every copy, which shards are left without slave, and
+whether the cluster remains writable. Nothing is changed on the cluster.
+Nodes already flagged as fail are treated as down too.`,
+	Args: cobra.ExactArgs(1),
+	Example: fmt.Sprintf("%s cluster whatif <seed-node> -a \"password\" --down host=10.0.0.5\n"+
+		"%s cluster whatif <seed-node> -a \"password\" --down host=10.0.0.5,10.0.0.6 --down node=<nodeID>,<nodeID>",
+		vars.AppName, vars.AppName),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vars.HostPort = config.ResolveSeed(args[0])
+		f := perf.StartCpuProfile()
+		defer perf.StopCpuProfile(f)
+		if err := printWhatif(vars.HostPort); err != nil {
+			return err
+		}
+		perf.MemProfile()
+		return nil
+	},
+}
+
+func InitWhatif() {
+	WhatifCmd.Flags().StringArrayVar(&downSpecs, "down", nil, "hosts or nodes to be simulated as down: host=<ip>,... or node=<nodeID>,...")
+	_ = WhatifCmd.MarkFlagRequired("down")
+}
+
+// parseDownSpecs parses --down values to sets of hosts and node IDs, a value without prefix is a node ID list
+func parseDownSpecs(specs []string) (map[string]bool, map[string]bool, error) {
+	hosts, nodeIDs := make(map[string]bool), make(map[string]bool)
+	for _, spec := range specs {
+		target := nodeIDs
+		if v, found := strings.CutPrefix(spec, "host="); found {
+			target, spec = hosts, v
+		} else if v, found := strings.CutPrefix(spec, "node="); found {
+			spec = v
+		}
+		for _, item := range strings.Split(spec, ",") {
+			if item = strings.TrimSpace(item); len(item) == 0 {
+				return nil, nil, fmt.Errorf("invalid --down value: %s", spec)
+			}
+			target[item] = true
+		}
+	}
+	return hosts, nodeIDs, nil
+}
+
+// checkDownTargets makes sure every host and node ID of --down is in the cluster, so that a typo does not simulate nothing
+func checkDownTargets(nodes []*r.ClusterNode, hosts, nodeIDs map[string]bool) error {
+	knownHosts, knownIDs := make(map[string]bool), make(map[string]bool)
+	for _, n := range nodes {
+		knownHosts[n.Host()], knownIDs[n.NodeID] = true, true
+	}
+	var unknown []string
+	for host := range hosts {
+		if !knownHosts[host] {
+			unknown = append(unknown, "host "+host)
+		}
+	}
+	for nodeID := range nodeIDs {
+		if !knownIDs[nodeID] {
+			unknown = append(unknown, "node "+nodeID)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("%s not found in cluster", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+type whatifFailover struct {
+	Master   *r.ClusterNode
+	Promoted *r.ClusterNode
+	Left     int // slaves left in the shard after the failover
+}
+
+type whatifResult struct {
+	Down         []*r.ClusterNode
+	Failovers    []whatifFailover
+	LostMasters  []*r.ClusterNode // masters whose slots lose every copy
+	LostSlots    int
+	NoSlave      []string // addr of masters(after failover) that are left without any slave
+	Voters       int      // masters serving slots, which vote in failover elections
+	AliveVoters  int
+	MajorityLost bool
+	FullCoverage bool // cluster-require-full-coverage
+}
+
+// simulateDown works out the result of nodes matching isDown going down, offsets(nodeID -> slave_repl_offset) is used to
+// predict which slave wins the election like redis does; slaves without offset are ranked by addr
+func simulateDown(nodes []*r.ClusterNode, isDown func(*r.ClusterNode) bool, offsets map[string]int64,
+	fullCoverage bool) *whatifResult {
+	result := &whatifResult{FullCoverage: fullCoverage}
+	down := func(n *r.ClusterNode) bool {
+		return isDown(n) || n.HasFlag("fail")
+	}
+	slavesOf := make(map[string][]*r.ClusterNode)
+	var masters []*r.ClusterNode
+	for _, n := range nodes {
+		if down(n) {
+			result.Down = append(result.Down, n)
+		}
+		if n.Role == "slave" {
+			slavesOf[n.MasterID] = append(slavesOf[n.MasterID], n)
+		} else if n.Role == "master" && n.GetSlotCount() > 0 {
+			masters = append(masters, n)
+			result.Voters++
+			if !down(n) {
+				result.AliveVoters++
+			}
+		}
+	}
+	sort.Slice(masters, func(i, j int) bool { return r.CompareAddr(masters[i].Addr, masters[j].Addr) < 0 })
+	// a failover must be authorized by the majority of masters
+	result.MajorityLost = result.AliveVoters <= result.Voters/2
+	for _, m := range masters {
+		var aliveSlaves []*r.ClusterNode
+		for _, s := range slavesOf[m.NodeID] {
+			if !down(s) {
+				aliveSlaves = append(aliveSlaves, s)
+			}
+		}
+		if !down(m) {
+			if len(aliveSlaves) == 0 {
+				result.NoSlave = append(result.NoSlave, m.Addr)
+			}
+			continue
+		}
+		if len(aliveSlaves) == 0 || result.MajorityLost {
+			result.LostMasters = append(result.LostMasters, m)
+			result.LostSlots += m.GetSlotCount()
+			continue
+		}
+		sort.Slice(aliveSlaves, func(i, j int) bool {
+			oi, oj := offsets[aliveSlaves[i].NodeID], offsets[aliveSlaves[j].NodeID]
+			if oi != oj {
+				return oi > oj
+			}
+			return r.CompareAddr(aliveSlaves[i].Addr, aliveSlaves[j].Addr) < 0
+		})
+		result.Failovers = append(result.Failovers, whatifFailover{
+			Master:   m,
+			Promoted: aliveSlaves[0],
+			Left:     len(aliveSlaves) - 1,
+		})
+		if len(aliveSlaves) == 1 {
+			result.NoSlave = append(result.NoSlave, aliveSlaves[0].Addr)
+		}
+	}
+	return result
+}
+
+// Writable describes whether the cluster accepts writes after the simulated failure
+func (w *whatifResult) Writable() (string, bool) {
+	if w.MajorityLost {
+		return fmt.Sprintf("NO, only %d of %d masters alive, no failover can be authorized and cluster_state becomes fail",
+			w.AliveVoters, w.Voters), false
+	}
+	if w.LostSlots > 0 && w.FullCoverage {
+		return fmt.Sprintf("NO, %d slots lose every copy and cluster-require-full-coverage is yes", w.LostSlots), false
+	}
+	if w.LostSlots > 0 {
+		return fmt.Sprintf("PARTIALLY, %d slots lose every copy, other slots remain writable", w.LostSlots), false
+	}
+	return "YES", true
+}
+
+func printWhatif(hostPort string) error {
+	hosts, nodeIDs, err := parseDownSpecs(downSpecs)
+	if err != nil {
+		return err
+	}
+	seedNode, err := NewSeedNode(hostPort)
+	if err != nil {
+		return err
+	}
+	defer seedNode.Close()
+	if !seedNode.ClusterEnabled {
+		return fmt.Errorf("seed node %s is not a cluster node", seedNode.Addr)
+	}
+	clusterNodes, err := r.GetClusterNodes(seedNode.Client)
+	if err != nil {
+		return err
+	}
+	if err := checkDownTargets(clusterNodes, hosts, nodeIDs); err != nil {
+		return err
+	}
+	isDown := func(n *r.ClusterNode) bool {
+		return hosts[n.Host()] || nodeIDs[n.NodeID]
+	}
+	// replication offsets are read from alive slaves of down masters, so that the election can be predicted
+	offsets := make(map[string]int64)
+	for _, m := range clusterNodes {
+		if m.Role != "master" || !isDown(m) {
+			continue
+		}
+		for _, s := range clusterNodes {
+			if s.MasterID != m.NodeID || isDown(s) || s.HasFlag("fail") {
+				continue
+			}
+			if i, err := r.NewInstance(s.Addr); err == nil {
+				if replInfo, err := r.ParseInfo(i.Client, "replication"); err == nil {
+					offsets[s.NodeID], _ = strconv.ParseInt(replInfo["slave_repl_offset"], 10, 64)
+				}
+				i.Close()
+			}
+		}
+	}
+	fullCoverage := r.ParseConfigGet(seedNode.Client, "cluster-require-full-coverage") != "no"
+	result := simulateDown(clusterNodes, isDown, offsets, fullCoverage)
+
+	color.Cyan("Nodes down: %d\n", len(result.Down))
+	for _, n := range result.Down {
+		fmt.Printf("  %-45s%-24s%s\n", n.NodeID, n.Addr, n.Role)
+	}
+	color.Cyan("Failovers: %d\n", len(result.Failovers))
+	if len(result.Failovers) > 0 {
+		color.Cyan("  %-24s%-12s%-24s%s\n", "Master", "Slots", "Promoted", "SlavesLeft")
+		for _, f := range result.Failovers {
+			fmt.Printf("  %-24s%-12d%-24s%d\n", f.Master.Addr, f.Master.GetSlotCount(), f.Promoted.Addr, f.Left)
+		}
+	}
+	if len(result.LostMasters) > 0 {
+		color.Red("Slots losing every copy: %d\n", result.LostSlots)
+		for _, m := range result.LostMasters {
+			var ranges []string
+			for _, slotRange := range m.Slots {
+				ranges = append(ranges, slotRange.String())
+			}
+			color.Red("  master %s: %s\n", m.Addr, strings.Join(ranges, " "))
+		}
+	}
+	if len(result.NoSlave) > 0 {
+		color.Yellow("Shards left without slave (by master addr): %d\n", len(result.NoSlave))
+		for _, addr := range result.NoSlave {
+			color.Yellow("  %s\n", addr)
+		}
+	}
+	fmt.Printf("%-32s%v\n", "cluster-require-full-coverage:", map[bool]string{true: "yes", false: "no"}[fullCoverage])
+	writable, ok := result.Writable()
+	if ok {
+		fmt.Printf("%-32s%s\n", "Cluster writable:", color.GreenString(writable))
+	} else {
+		fmt.Printf("%-32s%s\n", "Cluster writable:", color.RedString(writable))
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package cluster
+
+import (
+	r "redis-cluster-manager/redis"
+	"testing"
+)
+
+func whatifTopology() []*r.ClusterNode {
+	return []*r.ClusterNode{
+		{NodeID: "m1", Addr: "10.0.0.1:6379", Role: "master", Flags: []string{"master"}, Slots: []*r.SlotRange{{Start: 0, End: 5460, SlotCount: 5461}}},
+		{NodeID: "m2", Addr: "10.0.0.2:6379", Role: "master", Flags: []string{"master"}, Slots: []*r.SlotRange{{Start: 5461, End: 10922, SlotCount: 5462}}},
+		{NodeID: "m3", Addr: "10.0.0.3:6379", Role: "master", Flags: []string{"master"}, Slots: []*r.SlotRange{{Start: 10923, End: 16383, SlotCount: 5461}}},
+		{NodeID: "s1a", Addr: "10.0.0.2:6380", Role: "slave", MasterID: "m1", Flags: []string{"slave"}},
+		{NodeID: "s1b", Addr: "10.0.0.3:6380", Role: "slave", MasterID: "m1", Flags: []string{"slave"}},
+		{NodeID: "s2", Addr: "10.0.0.1:6380", Role: "slave", MasterID: "m2", Flags: []string{"slave"}},
+		{NodeID: "s3", Addr: "10.0.0.1:6381", Role: "slave", MasterID: "m3", Flags: []string{"slave"}},
+	}
+}
+
+func TestSimulateDownHost(t *testing.T) {
+	downHost := func(host string) func(*r.ClusterNode) bool {
+		return func(n *r.ClusterNode) bool { return n.Host() == host }
+	}
+	result := simulateDown(whatifTopology(), downHost("10.0.0.1"), map[string]int64{"s1a": 10, "s1b": 20}, true)
+	if len(result.Failovers) != 1 || result.Failovers[0].Promoted.NodeID != "s1b" || result.Failovers[0].Left != 1 {
+		t.Fatalf("unexpected failovers: %+v", result.Failovers)
+	}
+	if result.LostSlots != 0 {
+		t.Fatalf("LostSlots = %d, want 0", result.LostSlots)
+	}
+	// m2 and m3 lose their only slave on 10.0.0.1
+	if len(result.NoSlave) != 2 || result.NoSlave[0] != "10.0.0.2:6379" || result.NoSlave[1] != "10.0.0.3:6379" {
+		t.Fatalf("NoSlave = %v", result.NoSlave)
+	}
+	if _, ok := result.Writable(); !ok {
+		t.Fatal("cluster should remain writable")
+	}
+
+	result = simulateDown(whatifTopology(), downHost("10.0.0.2"), nil, true)
+	if result.LostSlots != 0 || len(result.Failovers) != 1 || result.Failovers[0].Promoted.NodeID != "s2" {
+		t.Fatalf("unexpected result: lost %d, failovers %+v", result.LostSlots, result.Failovers)
+	}
+}
+
+func TestSimulateDownLostSlots(t *testing.T) {
+	down := map[string]bool{"m3": true, "s3": true}
+	isDown := func(n *r.ClusterNode) bool { return down[n.NodeID] }
+	result := simulateDown(whatifTopology(), isDown, nil, false)
+	if result.LostSlots != 5461 || len(result.LostMasters) != 1 {
+		t.Fatalf("LostSlots = %d, LostMasters = %v", result.LostSlots, result.LostMasters)
+	}
+	if writable, ok := result.Writable(); ok || writable[:9] != "PARTIALLY" {
+		t.Fatalf("Writable() = %s", writable)
+	}
+
+	down = map[string]bool{"m1": true, "m2": true}
+	result = simulateDown(whatifTopology(), isDown, nil, true)
+	if !result.MajorityLost || len(result.Failovers) != 0 || result.LostSlots != 10923 {
+		t.Fatalf("majority lost = %v, failovers = %v, lost slots = %d", result.MajorityLost, result.Failovers, result.LostSlots)
+	}
+}
+
+func TestParseDownSpecs(t *testing.T) {
+	hosts, nodeIDs, err := parseDownSpecs([]string{"host=10.0.0.1,10.0.0.2", "node=a,b", "c"})
+	if err != nil {
+		t.Fatalf("parseDownSpecs() error = %v", err)
+	}
+	if len(hosts) != 2 || !hosts["10.0.0.2"] || len(nodeIDs) != 3 || !nodeIDs["c"] {
+		t.Fatalf("hosts = %v, nodeIDs = %v", hosts, nodeIDs)
+	}
+	if _, _, err := parseDownSpecs([]string{"host="}); err == nil {
+		t.Fatal("expected error for empty host")
+	}
+}
+
+func TestCheckDownTargets(t *testing.T) {
+	tests := []struct {
+		name    string
+		hosts   map[string]bool
+		nodeIDs map[string]bool
+		wantErr bool
+	}{
+		{name: "known host and node", hosts: map[string]bool{"10.0.0.1": true}, nodeIDs: map[string]bool{"m2": true}},
+		{name: "unknown host", hosts: map[string]bool{"10.0.0.9": true}, wantErr: true},
+		{name: "unknown node", nodeIDs: map[string]bool{"m9": true}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkDownTargets(whatifTopology(), tt.hosts, tt.nodeIDs); (err != nil) != tt.wantErr {
+				t.Fatalf("checkDownTargets() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
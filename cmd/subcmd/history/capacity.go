@@ -0,0 +1,459 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"log"
+	"math"
+	"redis-cluster-manager/config"
+	"redis-cluster-manager/perf"
+	r "redis-cluster-manager/redis"
+	"redis-cluster-manager/vars"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	capacityHistory   string        // history file of the capacity samples
+	capacityInterval  time.Duration // time between two samples, 0 to sample once
+	capacityNoSample  bool          // forecast from the history only
+	capacityThreshold float64       // percentage of maxmemory treated as the eviction threshold
+	capacityTarget    float64       // utilization to stay under after adding shards
+	capacityMonths    int           // horizon of the recommendation
+)
+
+// month is the length of a month of the forecast horizon
+const month = 30 * 24 * time.Hour
+
+var ForecastCmd = &cobra.Command{
+	Use:   "forecast",
+	Short: "Forecast when masters fill up and how many shards to add",
+	Long: `Sample used_memory, maxmemory and keys of every master into --history, then fit the growth of every shard and
+estimate when it reaches --threshold percent of maxmemory and maxmemory itself. The growth is linear, plus the daily
+or weekly peak once the history covers two days or two weeks, so that the busy hours are forecast and not the average.
+The shards are sorted by urgency, followed by the number of shards to add to stay under --target percent for --months.
+Run it from cron, or with --interval to keep sampling, the forecast gets better with a longer history.`,
+	Args:    cobra.ExactArgs(1),
+	Example: fmt.Sprintf("%s capacity forecast <profile|seed-node> [--history capacity.jsonl] [--threshold 90] [--target 70] [--months 6]", vars.AppName),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vars.HostPort = config.ResolveSeed(args[0])
+		f := perf.StartCpuProfile()
+		defer perf.StopCpuProfile(f)
+		err := forecastCapacity(args[0], vars.HostPort)
+		if err != nil {
+			return err
+		}
+		perf.MemProfile()
+		return nil
+	},
+}
+
+func InitForecast() {
+	ForecastCmd.Flags().StringVar(&capacityHistory, "history", "capacity.jsonl", "history file of the capacity samples")
+	ForecastCmd.Flags().DurationVarP(&capacityInterval, "interval", "i", 0, "keep sampling at this interval and forecast after each sample, 0 to sample once")
+	ForecastCmd.Flags().BoolVar(&capacityNoSample, "no-sample", false, "forecast from the history only, without sampling the cluster")
+	ForecastCmd.Flags().Float64Var(&capacityThreshold, "threshold", 90, "percentage of maxmemory treated as the eviction threshold")
+	ForecastCmd.Flags().Float64Var(&capacityTarget, "target", 70, "utilization in percent to stay under after adding shards")
+	ForecastCmd.Flags().IntVar(&capacityMonths, "months", 6, "horizon in months of the shard recommendation")
+}
+
+// capacitySample is a line of the capacity history
+type capacitySample struct {
+	Time    time.Time        `json:"time"`
+	Cluster string           `json:"cluster"`
+	Masters []masterCapacity `json:"masters,omitempty"`
+	Error   string           `json:"error,omitempty"`
+}
+
+// masterCapacity is a master serving slots, memory is in bytes, not rounded like the GB of Instance.init
+type masterCapacity struct {
+	Addr       string `json:"addr"`
+	NodeID     string `json:"node_id"`
+	Slots      string `json:"slots"`
+	SlotCount  int    `json:"slot_count"`
+	UsedMemory int64  `json:"used_memory"`
+	MaxMemory  int64  `json:"max_memory"` // 0 if unlimited
+	Keys       int64  `json:"keys"`
+}
+
+// gigabyte is the unit of the forecast table, only used for display
+const gigabyte = 1 << 30
+
+func forecastCapacity(name, seeds string) error {
+	if capacityThreshold <= 0 || capacityThreshold > 100 || capacityTarget <= 0 || capacityTarget > 100 {
+		return fmt.Errorf("--threshold and --target must be percentages between 0 and 100")
+	}
+	if capacityMonths < 1 {
+		return fmt.Errorf("--months must be at least 1")
+	}
+	if capacityNoSample {
+		return printForecast(name)
+	}
+	out, err := openRecorder(capacityHistory, rotatePolicy{})
+	if err != nil {
+		return err
+	}
+	defer out.close()
+	for {
+		start := time.Now()
+		sample := collectCapacity(name, seeds, start)
+		if err := out.append(sample.Time, sample); err != nil {
+			return err
+		}
+		if sample.Error != "" {
+			color.Red("Failed to sample %s: %s\n", name, sample.Error)
+		}
+		if err := printForecast(name); err != nil {
+			if capacityInterval == 0 {
+				return err
+			}
+			log.Printf("failed to forecast %s: %v", name, err)
+		}
+		if capacityInterval == 0 {
+			return nil
+		}
+		time.Sleep(capacityInterval - time.Since(start))
+	}
+}
+
+// collectCapacity samples the masters serving slots, errors are kept in the sample
+func collectCapacity(name, seeds string, now time.Time) capacitySample {
+	sample := capacitySample{Time: now.UTC(), Cluster: name}
+	seedNode, _, err := r.NewSeedInstance(seeds)
+	if err != nil {
+		sample.Error = err.Error()
+		return sample
+	}
+	defer seedNode.Close()
+	if !seedNode.ClusterEnabled {
+		sample.Error = fmt.Sprintf("seed node %s is not a cluster node", seedNode.Addr)
+		return sample
+	}
+	clusterNodesInfo, err := r.ParseClusterNodes(seedNode.Client)
+	if err != nil {
+		sample.Error = err.Error()
+		return sample
+	}
+	instances, errs := r.NewClusterInstances(clusterNodesInfo)
+	defer r.CloseInstances(instances)
+	for _, i := range instances {
+		if i.Role != "master" || len(i.Slots) == 0 || i.LoadingError {
+			continue
+		}
+		var slots []string
+		count := 0
+		for _, s := range i.Slots {
+			slots = append(slots, s.String())
+			count += s.SlotCount
+		}
+		sample.Masters = append(sample.Masters, masterCapacity{Addr: i.Addr, NodeID: i.NodeID, Slots: strings.Join(slots, ","),
+			SlotCount: count, UsedMemory: i.UsedMemoryBytes, MaxMemory: i.MaxMemoryBytes, Keys: r.SumKeys(i.Info)})
+	}
+	sort.Slice(sample.Masters, func(i, j int) bool { return r.CompareAddr(sample.Masters[i].Addr, sample.Masters[j].Addr) < 0 })
+	if len(errs) > 0 {
+		sample.Error = fmt.Sprintf("%d nodes can not be connected", len(errs))
+	}
+	return sample
+}
+
+// readCapacity reads the capacity samples of cluster from the history, oldest first
+func readCapacity(path, cluster string) ([]capacitySample, error) {
+	var samples []capacitySample
+	_, err := decodeLines(path, func(line []byte) error {
+		var s capacitySample
+		if err := json.Unmarshal(line, &s); err != nil {
+			return err
+		}
+		if s.Cluster == cluster && len(s.Masters) > 0 {
+			samples = append(samples, s)
+		}
+		return nil
+	})
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].Time.Before(samples[j].Time) })
+	return samples, err
+}
+
+// growthFit is the fitted used memory of a shard: a linear trend plus the peak of the seasonal residuals
+type growthFit struct {
+	Model     string // linear, daily or weekly
+	Origin    time.Time
+	Slope     float64 // bytes per day
+	Intercept float64 // bytes at Origin
+	Peak      float64 // highest mean residual of an hour of the day or week, 0 for linear
+}
+
+// at forecasts the peak used memory at t
+func (f growthFit) at(t time.Time) float64 {
+	return f.Intercept + f.Slope*t.Sub(f.Origin).Hours()/24 + f.Peak
+}
+
+// fitGrowth fits values taken at times. the residuals of the linear trend are averaged by hour of the week once two
+// weeks are covered, or by hour of the day once two days are, and the highest average is added as the peak
+func fitGrowth(times []time.Time, values []float64) growthFit {
+	fit := growthFit{Model: "linear", Origin: times[0]}
+	days := make([]float64, len(times))
+	for n, t := range times {
+		days[n] = t.Sub(fit.Origin).Hours() / 24
+	}
+	fit.Slope, fit.Intercept = fitLine(days, values)
+
+	span := times[len(times)-1].Sub(times[0])
+	var bucket func(t time.Time) int
+	switch {
+	case span >= 14*24*time.Hour:
+		fit.Model, bucket = "weekly", func(t time.Time) int { return int(t.UTC().Weekday())*24 + t.UTC().Hour() }
+	case span >= 2*24*time.Hour:
+		fit.Model, bucket = "daily", func(t time.Time) int { return t.UTC().Hour() }
+	default:
+		return fit
+	}
+	// the trend is fitted again without the seasonal part, busy hours at the end of the history would bend it
+	var seasonal map[int]float64
+	for round := 0; round < 3; round++ {
+		sums, counts := make(map[int]float64), make(map[int]int)
+		for n, t := range times {
+			sums[bucket(t)] += values[n] - (fit.Intercept + fit.Slope*days[n])
+			counts[bucket(t)]++
+		}
+		seasonal = make(map[int]float64)
+		for b, sum := range sums {
+			seasonal[b] = sum / float64(counts[b])
+		}
+		adjusted := make([]float64, len(values))
+		for n, t := range times {
+			adjusted[n] = values[n] - seasonal[bucket(t)]
+		}
+		fit.Slope, fit.Intercept = fitLine(days, adjusted)
+	}
+	fit.Peak = 0
+	for _, v := range seasonal {
+		fit.Peak = math.Max(fit.Peak, v)
+	}
+	return fit
+}
+
+// timeTo returns how long until the fitted memory reaches level, 0 if it's reached, -1 if never
+func (f growthFit) timeTo(level, current float64, now time.Time) time.Duration {
+	forecast := math.Max(f.at(now), current)
+	if forecast >= level {
+		return 0
+	}
+	if f.Slope <= 0 {
+		return -1
+	}
+	return time.Duration((level - forecast) / f.Slope * float64(24*time.Hour))
+}
+
+// shardForecast is the forecast of a shard, by the slot ranges of it's master
+type shardForecast struct {
+	Master       string // master addr of the latest sample
+	Slots        string
+	SlotCount    int
+	Samples      int
+	UsedMemory   float64 // bytes in the latest sample
+	MaxMemory    float64 // bytes, 0 if unlimited
+	Fit          growthFit
+	KeysPerDay   float64
+	ThresholdIn  time.Duration // time to the eviction threshold, 0 if reached, -1 if never or unknown
+	FullIn       time.Duration // time to maxmemory, 0 if reached, -1 if never or unknown
+	AtHorizon    float64       // forecast used memory in bytes at the end of the horizon
+	TrendUnknown bool          // less than 2 samples
+}
+
+// utilization returns the used memory in percent of maxmemory, 0 if unlimited
+func (s shardForecast) utilization() float64 {
+	if s.MaxMemory <= 0 {
+		return 0
+	}
+	return s.UsedMemory / s.MaxMemory * 100
+}
+
+// forecastShards fits every shard of the samples and sorts them by urgency: the soonest to reach the threshold first,
+// then the most utilized
+func forecastShards(samples []capacitySample, threshold float64, horizon time.Duration, now time.Time) []shardForecast {
+	type series struct {
+		times      []time.Time
+		used, keys []float64
+		last       masterCapacity
+	}
+	var (
+		order   []string
+		bySlots = make(map[string]*series)
+	)
+	for _, s := range samples {
+		for _, m := range s.Masters {
+			if bySlots[m.Slots] == nil {
+				bySlots[m.Slots] = &series{}
+				order = append(order, m.Slots)
+			}
+			ss := bySlots[m.Slots]
+			ss.times = append(ss.times, s.Time)
+			ss.used = append(ss.used, float64(m.UsedMemory))
+			ss.keys = append(ss.keys, float64(m.Keys))
+			ss.last = m
+		}
+	}
+	// shards missing in the latest complete sample are not served anymore, e.g. their slots moved
+	var lastComplete time.Time
+	for _, s := range samples {
+		if s.Error == "" {
+			lastComplete = s.Time
+		}
+	}
+	var shards []shardForecast
+	for _, slots := range order {
+		ss := bySlots[slots]
+		if ss.times[len(ss.times)-1].Before(lastComplete) {
+			continue
+		}
+		f := shardForecast{Master: ss.last.Addr, Slots: slots, SlotCount: ss.last.SlotCount, Samples: len(ss.times),
+			UsedMemory: float64(ss.last.UsedMemory), MaxMemory: float64(ss.last.MaxMemory), ThresholdIn: -1, FullIn: -1}
+		f.Fit = fitGrowth(ss.times, ss.used)
+		f.TrendUnknown = len(ss.times) < 2 || ss.times[0].Equal(ss.times[len(ss.times)-1])
+		days := make([]float64, len(ss.times))
+		for n, t := range ss.times {
+			days[n] = t.Sub(ss.times[0]).Hours() / 24
+		}
+		f.KeysPerDay, _ = fitLine(days, ss.keys)
+		f.AtHorizon = math.Max(f.Fit.at(now.Add(horizon)), f.UsedMemory)
+		if f.TrendUnknown {
+			f.AtHorizon = f.UsedMemory
+		}
+		if f.MaxMemory > 0 {
+			if f.TrendUnknown {
+				if f.UsedMemory >= f.MaxMemory*threshold/100 {
+					f.ThresholdIn = 0
+				}
+				if f.UsedMemory >= f.MaxMemory {
+					f.FullIn = 0
+				}
+			} else {
+				f.ThresholdIn = f.Fit.timeTo(f.MaxMemory*threshold/100, f.UsedMemory, now)
+				f.FullIn = f.Fit.timeTo(f.MaxMemory, f.UsedMemory, now)
+			}
+		}
+		shards = append(shards, f)
+	}
+	sort.SliceStable(shards, func(i, j int) bool {
+		a, b := shards[i].ThresholdIn, shards[j].ThresholdIn
+		if (a < 0) != (b < 0) {
+			return a >= 0
+		}
+		if a != b {
+			return a < b
+		}
+		return shards[i].utilization() > shards[j].utilization()
+	})
+	return shards
+}
+
+// shardRecommendation is the number of masters needed to keep the forecast memory under the target utilization
+type shardRecommendation struct {
+	Projected float64 // forecast used memory of all masters in bytes at the end of the horizon
+	PerMaster float64 // maxmemory in bytes of a new master, the median of the current ones
+	Masters   int
+	Needed    int
+	Extra     int
+}
+
+// recommendShards assumes slots are rebalanced after adding shards, so only the total memory counts.
+// PerMaster is 0 if no master has maxmemory set, nothing can be recommended then
+func recommendShards(shards []shardForecast, target float64) shardRecommendation {
+	rec := shardRecommendation{Masters: len(shards)}
+	var limits []float64
+	for _, s := range shards {
+		rec.Projected += s.AtHorizon
+		if s.MaxMemory > 0 {
+			limits = append(limits, s.MaxMemory)
+		}
+	}
+	if len(limits) == 0 {
+		return rec
+	}
+	sort.Float64s(limits)
+	rec.PerMaster = limits[len(limits)/2]
+	if len(limits)%2 == 0 {
+		rec.PerMaster = (limits[len(limits)/2-1] + limits[len(limits)/2]) / 2
+	}
+	rec.Needed = int(math.Ceil(rec.Projected / (rec.PerMaster * target / 100)))
+	rec.Extra = max(rec.Needed-rec.Masters, 0)
+	return rec
+}
+
+// formatETA formats the time until a level is reached
+func formatETA(d time.Duration) string {
+	switch {
+	case d < 0:
+		return "never"
+	case d == 0:
+		return "now"
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	case d > 10*365*24*time.Hour:
+		return ">10y"
+	}
+	return fmt.Sprintf("%dd", int(d.Hours()/24))
+}
+
+func printForecast(name string) error {
+	samples, err := readCapacity(capacityHistory, name)
+	if err != nil {
+		return err
+	}
+	if len(samples) == 0 {
+		return fmt.Errorf("no capacity sample of %s in %s", name, capacityHistory)
+	}
+	now := time.Now()
+	horizon := time.Duration(capacityMonths) * month
+	shards := forecastShards(samples, capacityThreshold, horizon, now)
+	first, last := samples[0].Time, samples[len(samples)-1].Time
+
+	fmt.Println(strings.Repeat("=", 130))
+	fmt.Printf("%-16s:\t%s\n", "Cluster", name)
+	fmt.Printf("%-16s:\t%d samples from %s to %s (%v)\n", "History", len(samples), first.Local().Format("2006-01-02 15:04"),
+		last.Local().Format("2006-01-02 15:04"), last.Sub(first).Round(time.Minute))
+	fmt.Println(strings.Repeat("=", 130))
+	thresholdHeader := fmt.Sprintf("%.0f%% in", capacityThreshold)
+	color.Cyan("%-24s%-8s%-10s%-10s%-8s%-14s%-9s%-10s%-10s%-12s%s\n", "Master", "Slots", "Used(GB)", "Max(GB)", "Util",
+		"Growth/day", "Model", thresholdHeader, "Full in", "Keys/day", fmt.Sprintf("In %d months", capacityMonths))
+	fmt.Printf("%-24s%-8s%-10s%-10s%-8s%-14s%-9s%-10s%-10s%-12s%s\n", "------", "-----", "--------", "-------", "----",
+		"----------", "-----", strings.Repeat("-", len(thresholdHeader)), "-------", "--------", "------------")
+	for _, s := range shards {
+		maxMemory, util, growth, model, keys := "unlimited", "-", "-", "-", "-"
+		if s.MaxMemory > 0 {
+			maxMemory, util = fmt.Sprintf("%.2f", s.MaxMemory/gigabyte), fmt.Sprintf("%.1f%%", s.utilization())
+		}
+		if !s.TrendUnknown {
+			growth, model, keys = formatGrowth(r.FormatBytes(s.Fit.Slope)), s.Fit.Model, formatGrowth(formatCount(s.KeysPerDay))
+		}
+		line := fmt.Sprintf("%-24s%-8d%-10.2f%-10s%-8s%-14s%-9s%-10s%-10s%-12s%.2fGB", s.Master, s.SlotCount, s.UsedMemory/gigabyte,
+			maxMemory, util, growth, model, formatETA(s.ThresholdIn), formatETA(s.FullIn), keys, s.AtHorizon/gigabyte)
+		switch {
+		case s.FullIn >= 0 && s.FullIn < horizon:
+			color.Red("%s", line)
+		case s.ThresholdIn >= 0 && s.ThresholdIn < horizon:
+			color.Yellow("%s", line)
+		default:
+			fmt.Println(line)
+		}
+	}
+	if len(samples) < 2 || last.Sub(first) < 24*time.Hour {
+		color.Yellow("The history covers less than a day, sample again later for a trend.\n")
+	}
+	rec := recommendShards(shards, capacityTarget)
+	if rec.PerMaster == 0 {
+		color.Yellow("No master has maxmemory set, no shard can be recommended.\n")
+		return nil
+	}
+	summary := fmt.Sprintf("In %d months %.2fGB is forecast on %d masters, %d masters of %.2fGB are needed to stay under %.0f%%",
+		capacityMonths, rec.Projected/gigabyte, rec.Masters, rec.Needed, rec.PerMaster/gigabyte, capacityTarget)
+	if rec.Extra > 0 {
+		color.Red("%s: add %d shards.\n", summary, rec.Extra)
+	} else {
+		color.Green("%s: no shard to add.\n", summary)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package history
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestFitGrowth(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var times []time.Time
+	var used []float64
+	for h := 0; h < 24*4; h++ {
+		at := start.Add(time.Duration(h) * time.Hour)
+		v := 10 + 0.5*float64(h)/24
+		// busy hours add 1GB
+		if at.Hour() >= 18 && at.Hour() < 22 {
+			v++
+		}
+		times, used = append(times, at), append(used, v)
+	}
+	fit := fitGrowth(times, used)
+	if fit.Model != "daily" || math.Abs(fit.Slope-0.5) > 0.01 {
+		t.Fatalf("fitGrowth() = %+v, want daily with 0.5GB/day", fit)
+	}
+	// the peak is the busy hours above the trend
+	if fit.Peak < 0.8 || fit.Peak > 0.9 {
+		t.Fatalf("peak = %v, want about 5/6 of 1GB", fit.Peak)
+	}
+	if linear := fitGrowth(times[:24], used[:24]); linear.Model != "linear" || linear.Peak != 0 {
+		t.Fatalf("fitGrowth() of a day = %+v, want linear", linear)
+	}
+}
+
+func TestGrowthFitTimeTo(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	fit := growthFit{Origin: now, Slope: 1, Intercept: 10}
+	if d := fit.timeTo(15, 10, now); d != 5*24*time.Hour {
+		t.Fatalf("timeTo() = %v, want 5 days", d)
+	}
+	if d := fit.timeTo(15, 16, now); d != 0 {
+		t.Fatalf("timeTo() = %v, want 0 when already reached", d)
+	}
+	if d := (growthFit{Origin: now, Slope: -1, Intercept: 10}).timeTo(15, 10, now); d != -1 {
+		t.Fatalf("timeTo() = %v, want never for a shrinking shard", d)
+	}
+}
+
+func TestForecastShards(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var samples []capacitySample
+	for day := 0; day <= 10; day++ {
+		samples = append(samples, capacitySample{Time: start.Add(time.Duration(day) * 24 * time.Hour), Cluster: "a",
+			Masters: []masterCapacity{
+				{Addr: "127.0.0.1:7000", Slots: "0-8191", SlotCount: 8192, UsedMemory: int64((2 + 0.1*float64(day)) * gigabyte),
+					MaxMemory: 4 * gigabyte},
+				{Addr: "127.0.0.1:7001", Slots: "8192-16383", SlotCount: 8192, UsedMemory: int64((3 + 0.05*float64(day)) * gigabyte),
+					MaxMemory: 4 * gigabyte},
+				{Addr: "127.0.0.1:7002", Slots: "16383", SlotCount: 1, UsedMemory: gigabyte, MaxMemory: 0},
+			}})
+	}
+	// slot 16383 moved away, a partial sample does not count
+	samples[10].Masters = samples[10].Masters[:2]
+	samples = append(samples, capacitySample{Time: start.Add(10*24*time.Hour + time.Hour), Cluster: "a", Error: "1 nodes can not be connected",
+		Masters: samples[10].Masters[:1]})
+	now := start.Add(10 * 24 * time.Hour)
+	shards := forecastShards(samples, 90, 30*24*time.Hour, now)
+	if len(shards) != 2 || shards[0].Master != "127.0.0.1:7001" {
+		t.Fatalf("forecastShards() = %+v", shards)
+	}
+	// 7001: 3.5GB growing 0.05GB/day reaches 3.6GB in 2 days, 7000: 3GB growing 0.1GB/day reaches it in 6 days
+	if d := shards[0].ThresholdIn.Hours() / 24; math.Abs(d-2) > 0.01 {
+		t.Fatalf("7001 reaches the threshold in %v days, want 2", d)
+	}
+	if d := shards[1].FullIn.Hours() / 24; math.Abs(d-10) > 0.1 {
+		t.Fatalf("7000 is full in %v days, want 10", d)
+	}
+
+	rec := recommendShards(shards, 70)
+	// 6GB + 5GB forecast in 30 days, 11GB / (4GB * 70%) = 3.9
+	if rec.PerMaster != 4*gigabyte || rec.Needed != 4 || rec.Extra != 2 || math.Abs(rec.Projected/gigabyte-11) > 0.01 {
+		t.Fatalf("recommendShards() = %+v", rec)
+	}
+}
+
+func TestForecastShardsSmallGrowth(t *testing.T) {
+	// 1MB a day on a 100MB instance is flat once rounded to 0.01GB, the bytes are recorded
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var samples []capacitySample
+	for day := 0; day <= 10; day++ {
+		samples = append(samples, capacitySample{Time: start.Add(time.Duration(day) * 24 * time.Hour), Cluster: "a",
+			Masters: []masterCapacity{
+				{Addr: "127.0.0.1:7000", Slots: "0-16383", SlotCount: 16384, UsedMemory: int64(70+day) << 20, MaxMemory: 100 << 20},
+			}})
+	}
+	shards := forecastShards(samples, 90, 30*24*time.Hour, start.Add(10*24*time.Hour))
+	if len(shards) != 1 {
+		t.Fatalf("forecastShards() = %+v", shards)
+	}
+	// 80MB growing 1MB a day reaches 90MB in 10 days
+	if d := shards[0].ThresholdIn.Hours() / 24; math.Abs(d-10) > 0.01 {
+		t.Fatalf("threshold reached in %v days, want 10", d)
+	}
+}
+
+func TestFormatETA(t *testing.T) {
+	cases := map[time.Duration]string{-1: "never", 0: "now", 5 * time.Hour: "5h", 72 * time.Hour: "3d", 11 * 365 * 24 * time.Hour: ">10y"}
+	for d, want := range cases {
+		if got := formatETA(d); got != want {
+			t.Errorf("formatETA(%v) = %s, want %s", d, got, want)
+		}
+	}
+}
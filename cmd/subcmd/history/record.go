@@ -0,0 +1,311 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	"log"
+	"os"
+	"path/filepath"
+	"redis-cluster-manager/config"
+	"redis-cluster-manager/perf"
+	r "redis-cluster-manager/redis"
+	"redis-cluster-manager/vars"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	recordInterval time.Duration // time between two samples
+	recordOut      string        // file the samples are appended to
+	recordCount    int           // number of samples before exiting, 0 for no limit
+	rotation       rotatePolicy
+)
+
+// recordedInfo are the INFO fields kept in a sample, besides the keyspace lines db0, db1...
+var recordedInfo = []string{
+	"uptime_in_seconds", "used_memory", "used_memory_rss", "used_memory_peak", "maxmemory", "mem_fragmentation_ratio",
+	"connected_clients", "blocked_clients", "rejected_connections", "total_commands_processed",
+	"instantaneous_ops_per_sec", "instantaneous_input_kbps", "instantaneous_output_kbps", "total_net_input_bytes",
+	"total_net_output_bytes", "keyspace_hits", "keyspace_misses", "expired_keys", "evicted_keys", "used_cpu_sys",
+	"used_cpu_user", "master_repl_offset", "slave_repl_offset", "master_link_status", "rdb_last_bgsave_status",
+}
+
+var RecordCmd = &cobra.Command{
+	Use:   "record",
+	Short: "Record samples of a cluster to a local file",
+	Long: `Sample the cluster every --interval and append the samples to --out, one JSON line per sample with the topology,
+the key count and a subset of INFO of every node. The file is rotated when it's larger than --rotate-size or older
+than --rotate-every, and only --keep rotated files are kept. Use report to show the growth trends.`,
+	Args:    cobra.ExactArgs(1),
+	Example: fmt.Sprintf("%s record <profile|seed-node> -i 60s --out metrics.jsonl [--rotate-size 100] [--rotate-every 24h] [--keep 7]", vars.AppName),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vars.HostPort = config.ResolveSeed(args[0])
+		f := perf.StartCpuProfile()
+		defer perf.StopCpuProfile(f)
+		err := record(args[0], vars.HostPort)
+		if err != nil {
+			return err
+		}
+		perf.MemProfile()
+		return nil
+	},
+}
+
+func InitRecord() {
+	RecordCmd.Flags().DurationVarP(&recordInterval, "interval", "i", time.Minute, "time between two samples")
+	RecordCmd.Flags().StringVar(&recordOut, "out", "metrics.jsonl", "file the samples are appended to")
+	RecordCmd.Flags().IntVar(&recordCount, "count", 0, "number of samples before exiting, 0 for no limit")
+	RecordCmd.Flags().Int64Var(&rotation.SizeMB, "rotate-size", 100, "rotate the file when it's larger than this many MB, 0 to disable")
+	RecordCmd.Flags().DurationVar(&rotation.Every, "rotate-every", 24*time.Hour, "rotate the file when it's first sample is older than this, 0 to disable")
+	RecordCmd.Flags().IntVar(&rotation.Keep, "keep", 7, "number of rotated files kept, 0 to keep all")
+}
+
+// Sample is a line of the recorded file
+type Sample struct {
+	Time    time.Time    `json:"time"`
+	Cluster string       `json:"cluster"` // profile name or seed argument
+	Seed    string       `json:"seed,omitempty"`
+	Nodes   []NodeSample `json:"nodes,omitempty"`
+	Error   string       `json:"error,omitempty"` // the cluster could not be sampled
+}
+
+// NodeSample is a node of a sample, Info is empty if it's not reachable
+type NodeSample struct {
+	Addr      string            `json:"addr"`
+	NodeID    string            `json:"node_id"`
+	Role      string            `json:"role"`
+	MasterID  string            `json:"master_id,omitempty"`
+	Flags     []string          `json:"flags"`
+	Slots     string            `json:"slots,omitempty"` // slot ranges: 0-5460,5462
+	SlotCount int               `json:"slot_count"`
+	Keys      int64             `json:"keys"`
+	Info      map[string]string `json:"info,omitempty"`
+	Error     string            `json:"error,omitempty"`
+}
+
+func record(name, seeds string) error {
+	out, err := openRecorder(recordOut, rotation)
+	if err != nil {
+		return err
+	}
+	defer out.close()
+	log.Printf("recording %s every %v to %s", name, recordInterval, recordOut)
+	for n := 1; ; n++ {
+		start := time.Now()
+		sample := collectSample(name, seeds, start)
+		if err := out.append(sample.Time, sample); err != nil {
+			return err
+		}
+		if sample.Error != "" {
+			log.Printf("failed to sample %s: %s", name, sample.Error)
+		} else {
+			log.Printf("recorded %d nodes of %s", len(sample.Nodes), name)
+		}
+		if recordCount > 0 && n >= recordCount {
+			return nil
+		}
+		time.Sleep(recordInterval - time.Since(start))
+	}
+}
+
+// collectSample samples every node of the cluster, errors are kept in the sample
+func collectSample(name, seeds string, now time.Time) Sample {
+	sample := Sample{Time: now.UTC(), Cluster: name}
+	seedNode, _, err := r.NewSeedInstance(seeds)
+	if err != nil {
+		sample.Error = err.Error()
+		return sample
+	}
+	defer seedNode.Close()
+	sample.Seed = seedNode.Addr
+	if !seedNode.ClusterEnabled {
+		sample.Error = fmt.Sprintf("seed node %s is not a cluster node", seedNode.Addr)
+		return sample
+	}
+	nodes, err := r.GetClusterNodes(seedNode.Client)
+	if err != nil {
+		sample.Error = err.Error()
+		return sample
+	}
+	instances, errs := r.NewClusterInstances(r.ClusterNodesInfo(nodes))
+	defer r.CloseInstances(instances)
+	byNodeID := make(map[string]*r.Instance)
+	for _, i := range instances {
+		byNodeID[i.NodeID] = i
+	}
+	errByNodeID := make(map[string]string)
+	for nodeInfo, err := range errs {
+		n := strings.Split(nodeInfo, ",")
+		errByNodeID[n[1]] = err.Error()
+	}
+	for _, n := range nodes {
+		var slots []string
+		for _, s := range n.Slots {
+			slots = append(slots, s.String())
+		}
+		node := NodeSample{Addr: n.Addr, NodeID: n.NodeID, Role: n.Role, MasterID: n.MasterID, Flags: n.Flags,
+			Slots: strings.Join(slots, ","), SlotCount: n.GetSlotCount()}
+		if i := byNodeID[n.NodeID]; i == nil {
+			node.Error = errByNodeID[n.NodeID]
+		} else if i.LoadingError {
+			node.Error = "loading"
+		} else {
+			node.Keys, node.Info = r.SumKeys(i.Info), recordedFields(i.Info)
+		}
+		sample.Nodes = append(sample.Nodes, node)
+	}
+	sort.Slice(sample.Nodes, func(i, j int) bool { return r.CompareAddr(sample.Nodes[i].Addr, sample.Nodes[j].Addr) < 0 })
+	return sample
+}
+
+// recordedFields picks recordedInfo and the keyspace lines from info
+func recordedFields(info map[string]string) map[string]string {
+	fields := make(map[string]string)
+	for _, key := range recordedInfo {
+		if v, exists := info[key]; exists {
+			fields[key] = v
+		}
+	}
+	for key, v := range info {
+		if strings.HasPrefix(key, "db") && strings.HasPrefix(v, "keys=") {
+			fields[key] = v
+		}
+	}
+	return fields
+}
+
+// rotatePolicy decides when the recorded file is rotated
+type rotatePolicy struct {
+	SizeMB int64         // rotate when the file is larger, 0 to disable
+	Every  time.Duration // rotate when the first sample of the file is older, 0 to disable
+	Keep   int           // rotated files kept, 0 to keep all
+}
+
+// due reports whether a file of size bytes started at started should be rotated at now
+func (p rotatePolicy) due(size int64, started, now time.Time) bool {
+	if size == 0 {
+		return false
+	}
+	if p.SizeMB > 0 && size >= p.SizeMB<<20 {
+		return true
+	}
+	return p.Every > 0 && !started.IsZero() && now.Sub(started) >= p.Every
+}
+
+// recorder appends samples to a file as JSON lines with a "time" field, rotating it by the policy
+type recorder struct {
+	path    string
+	policy  rotatePolicy
+	file    *os.File
+	size    int64
+	started time.Time // time of the first sample in the file
+}
+
+func openRecorder(path string, policy rotatePolicy) (*recorder, error) {
+	w := &recorder{path: path, policy: policy}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	if started, err := firstTime(path); err == nil {
+		w.started = started
+	}
+	return w, nil
+}
+
+func (w *recorder) open() error {
+	file, err := os.OpenFile(w.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", w.path, err)
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat %s: %v", w.path, err)
+	}
+	w.file, w.size, w.started = file, stat.Size(), time.Time{}
+	return nil
+}
+
+// append writes v taken at as a line
+func (w *recorder) append(at time.Time, v interface{}) error {
+	if w.policy.due(w.size, w.started, at) {
+		if err := w.rotate(at); err != nil {
+			return err
+		}
+	}
+	line, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode sample: %v", err)
+	}
+	n, err := w.file.Write(append(line, '\n'))
+	w.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %v", w.path, err)
+	}
+	if w.started.IsZero() {
+		w.started = at
+	}
+	return nil
+}
+
+// rotate renames the file to metrics-20060102-150405.jsonl, opens a new one and removes the oldest rotated files
+func (w *recorder) rotate(now time.Time) error {
+	w.file.Close()
+	ext := filepath.Ext(w.path)
+	rotated := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(w.path, ext), now.UTC().Format("20060102-150405"), ext)
+	if err := os.Rename(w.path, rotated); err != nil {
+		return fmt.Errorf("failed to rotate %s: %v", w.path, err)
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+	files, err := rotatedFiles(w.path)
+	if err != nil || w.policy.Keep <= 0 {
+		return err
+	}
+	for len(files) > w.policy.Keep {
+		if err := os.Remove(files[0]); err != nil {
+			return fmt.Errorf("failed to remove %s: %v", files[0], err)
+		}
+		files = files[1:]
+	}
+	return nil
+}
+
+func (w *recorder) close() {
+	w.file.Close()
+}
+
+// rotatedFiles returns the rotated files of path, the oldest first
+func rotatedFiles(path string) ([]string, error) {
+	ext := filepath.Ext(path)
+	files, err := filepath.Glob(strings.TrimSuffix(path, ext) + "-[0-9]*-[0-9]*" + ext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rotated files of %s: %v", path, err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// firstTime reads the time of the first line of path, zero if the file is empty
+func firstTime(path string) (time.Time, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer file.Close()
+	line, _ := bufio.NewReader(file).ReadBytes('\n')
+	if len(line) == 0 {
+		return time.Time{}, nil
+	}
+	var first struct {
+		Time time.Time `json:"time"`
+	}
+	if err := json.Unmarshal(line, &first); err != nil {
+		return time.Time{}, err
+	}
+	return first.Time, nil
+}
@@ -0,0 +1,73 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotatePolicyDue(t *testing.T) {
+	now := time.Now()
+	p := rotatePolicy{SizeMB: 1, Every: time.Hour}
+	cases := []struct {
+		size    int64
+		started time.Time
+		want    bool
+	}{
+		{0, now.Add(-2 * time.Hour), false},
+		{1 << 20, now, true},
+		{100, now.Add(-time.Hour), true},
+		{100, now.Add(-time.Minute), false},
+		{100, time.Time{}, false},
+	}
+	for _, c := range cases {
+		if got := p.due(c.size, c.started, now); got != c.want {
+			t.Errorf("due(%d, %v) = %v, want %v", c.size, c.started, got, c.want)
+		}
+	}
+}
+
+func TestRecorderRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.jsonl")
+	w, err := openRecorder(path, rotatePolicy{Every: time.Hour, Keep: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for n := 0; n < 8; n++ {
+		// two samples per file
+		at := start.Add(time.Duration(n) * 30 * time.Minute)
+		if err := w.append(at, Sample{Time: at, Cluster: "a"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.close()
+	files, err := rotatedFiles(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || filepath.Base(files[0]) != "metrics-20260101-020000.jsonl" {
+		t.Fatalf("rotatedFiles() = %v", files)
+	}
+
+	// the rotated files are read before the current one, undecodable lines are skipped
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	f.WriteString("{\"time\": \"cut\n")
+	f.Close()
+	samples, skipped, err := readSamples(path, "a", start.Add(90*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 5 || skipped != 1 || !samples[0].Time.Equal(start.Add(90*time.Minute)) {
+		t.Fatalf("readSamples() = %d samples from %v, %d skipped", len(samples), samples[0].Time, skipped)
+	}
+	reopened, err := openRecorder(path, rotatePolicy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.close()
+	if !reopened.started.Equal(start.Add(3 * time.Hour)) {
+		t.Fatalf("started = %v, want the time of the first sample of the file", reopened.started)
+	}
+}
@@ -0,0 +1,338 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"math"
+	"os"
+	"redis-cluster-manager/perf"
+	r "redis-cluster-manager/redis"
+	"redis-cluster-manager/vars"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	reportIn      string        // recorded file, rotated files are read too
+	reportWindow  time.Duration // only samples of this last period are used, 0 for all
+	reportCluster string        // only samples of this cluster are used, "" for all
+)
+
+// maxLineSize is the max size of a recorded line, a sample of a large cluster is several MB
+const maxLineSize = 64 << 20
+
+var ReportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Show growth trends per shard from recorded samples",
+	Long: `Read the samples written by record (and it's rotated files) and show the growth of every shard over --window:
+used memory and keys of the master, connected clients of all nodes of the shard, with the growth per day fitted over
+all samples, and the average and peak commands per second. Shards are identified by their slot ranges, so that a
+failover does not start a new shard, but moving slots does.`,
+	Args:    cobra.NoArgs,
+	Example: fmt.Sprintf("%s report --in metrics.jsonl [--window 168h] [--cluster prod-cache]", vars.AppName),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		f := perf.StartCpuProfile()
+		defer perf.StopCpuProfile(f)
+		err := printReport()
+		if err != nil {
+			return err
+		}
+		perf.MemProfile()
+		return nil
+	},
+}
+
+func InitReport() {
+	ReportCmd.Flags().StringVar(&reportIn, "in", "metrics.jsonl", "file written by record, it's rotated files are read too")
+	ReportCmd.Flags().DurationVarP(&reportWindow, "window", "w", 7*24*time.Hour, "only use the samples of this last period, 0 for all")
+	ReportCmd.Flags().StringVar(&reportCluster, "cluster", "", "only use the samples of this cluster, all clusters if not set")
+}
+
+// readSamples reads the samples of path and it's rotated files taken since since (zero for all), oldest first.
+// undecodable lines, e.g. a line cut by a crash, are counted and skipped
+func readSamples(path, cluster string, since time.Time) ([]Sample, int, error) {
+	var samples []Sample
+	skipped, err := decodeLines(path, func(line []byte) error {
+		var s Sample
+		if err := json.Unmarshal(line, &s); err != nil {
+			return err
+		}
+		if (cluster == "" || s.Cluster == cluster) && !s.Time.Before(since) {
+			samples = append(samples, s)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].Time.Before(samples[j].Time) })
+	return samples, skipped, nil
+}
+
+// decodeLines calls decode on every line of the rotated files of path then path, lines decode fails on are counted
+func decodeLines(path string, decode func(line []byte) error) (int, error) {
+	files, err := rotatedFiles(path)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := os.Stat(path); err == nil {
+		files = append(files, path)
+	}
+	if len(files) == 0 {
+		return 0, fmt.Errorf("no recorded file %s", path)
+	}
+	skipped := 0
+	for _, name := range files {
+		file, err := os.Open(name)
+		if err != nil {
+			return 0, fmt.Errorf("failed to open %s: %v", name, err)
+		}
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 0, 1<<20), maxLineSize)
+		for scanner.Scan() {
+			if err := decode(scanner.Bytes()); err != nil {
+				skipped++
+			}
+		}
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return 0, fmt.Errorf("failed to read %s: %v", name, err)
+		}
+	}
+	return skipped, nil
+}
+
+// shardPoint is a shard in a sample
+type shardPoint struct {
+	Time     time.Time
+	Master   string
+	Memory   float64          // used_memory of the master
+	Keys     float64          // keys of the master
+	Clients  float64          // connected_clients of all nodes of the shard
+	Commands map[string]int64 // total_commands_processed by node ID
+}
+
+// shardSeries are the points of a shard, by the slot ranges of it's master
+type shardSeries struct {
+	Cluster   string
+	Slots     string
+	SlotCount int
+	Points    []shardPoint
+}
+
+// shardSeriesOf splits the samples into shards, the masters without slots are not shards
+func shardSeriesOf(samples []Sample) []*shardSeries {
+	byKey := make(map[string]*shardSeries)
+	var series []*shardSeries
+	for _, s := range samples {
+		slaves := make(map[string][]NodeSample)
+		for _, n := range s.Nodes {
+			if n.Role == "slave" {
+				slaves[n.MasterID] = append(slaves[n.MasterID], n)
+			}
+		}
+		for _, n := range s.Nodes {
+			if n.Role != "master" || n.SlotCount == 0 || n.Info == nil {
+				continue
+			}
+			point := shardPoint{Time: s.Time, Master: n.Addr, Memory: r.InfoFloat(n.Info, "used_memory"), Keys: float64(n.Keys),
+				Commands: make(map[string]int64)}
+			for _, node := range append([]NodeSample{n}, slaves[n.NodeID]...) {
+				if node.Info == nil {
+					continue
+				}
+				point.Clients += r.InfoFloat(node.Info, "connected_clients")
+				point.Commands[node.NodeID], _ = strconv.ParseInt(node.Info["total_commands_processed"], 10, 64)
+			}
+			key := s.Cluster + "|" + n.Slots
+			if byKey[key] == nil {
+				byKey[key] = &shardSeries{Cluster: s.Cluster, Slots: n.Slots, SlotCount: n.SlotCount}
+				series = append(series, byKey[key])
+			}
+			byKey[key].Points = append(byKey[key].Points, point)
+		}
+	}
+	return series
+}
+
+// shardTrend is the growth of a shard over the window
+type shardTrend struct {
+	Cluster       string
+	Master        string // master addr of the latest sample
+	Slots         string
+	SlotCount     int
+	Samples       int
+	From, To      time.Time
+	Memory        float64 // used_memory of the master in bytes in the latest sample
+	MemoryPerDay  float64
+	Keys          float64
+	KeysPerDay    float64
+	Clients       float64
+	ClientsPerDay float64
+	OpsAvg        float64 // commands per second of all nodes of the shard, restarts excluded
+	OpsMax        float64
+}
+
+func trendOf(s *shardSeries) shardTrend {
+	first, last := s.Points[0], s.Points[len(s.Points)-1]
+	t := shardTrend{Cluster: s.Cluster, Master: last.Master, Slots: s.Slots, SlotCount: s.SlotCount, Samples: len(s.Points),
+		From: first.Time, To: last.Time, Memory: last.Memory, Keys: last.Keys, Clients: last.Clients}
+	var days, memory, keys, clients []float64
+	for _, p := range s.Points {
+		days = append(days, p.Time.Sub(first.Time).Hours()/24)
+		memory = append(memory, p.Memory)
+		keys = append(keys, p.Keys)
+		clients = append(clients, p.Clients)
+	}
+	t.MemoryPerDay, _ = fitLine(days, memory)
+	t.KeysPerDay, _ = fitLine(days, keys)
+	t.ClientsPerDay, _ = fitLine(days, clients)
+
+	var commands, seconds float64
+	for n := 1; n < len(s.Points); n++ {
+		prev, cur := s.Points[n-1], s.Points[n]
+		elapsed := cur.Time.Sub(prev.Time).Seconds()
+		if elapsed <= 0 {
+			continue
+		}
+		var delta float64
+		for id, c := range cur.Commands {
+			// a node restarted or missing in the previous sample is left out of this interval
+			if p, exists := prev.Commands[id]; exists && c >= p {
+				delta += float64(c - p)
+			}
+		}
+		commands += delta
+		seconds += elapsed
+		t.OpsMax = math.Max(t.OpsMax, delta/elapsed)
+	}
+	if seconds > 0 {
+		t.OpsAvg = commands / seconds
+	}
+	return t
+}
+
+// shardTrends computes the trend of every shard, the fastest growing memory first in each cluster
+func shardTrends(samples []Sample) []shardTrend {
+	var trends []shardTrend
+	for _, s := range shardSeriesOf(samples) {
+		trends = append(trends, trendOf(s))
+	}
+	sort.SliceStable(trends, func(i, j int) bool {
+		if trends[i].Cluster != trends[j].Cluster {
+			return trends[i].Cluster < trends[j].Cluster
+		}
+		return trends[i].MemoryPerDay > trends[j].MemoryPerDay
+	})
+	return trends
+}
+
+// fitLine fits y = slope*x + intercept by least squares, slope is 0 if there is less than 2 distinct x
+func fitLine(xs, ys []float64) (slope, intercept float64) {
+	n := float64(len(xs))
+	if n == 0 {
+		return 0, 0
+	}
+	var sumX, sumY, sumXY, sumXX float64
+	for i := range xs {
+		sumX += xs[i]
+		sumY += ys[i]
+		sumXY += xs[i] * ys[i]
+		sumXX += xs[i] * xs[i]
+	}
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0, sumY / n
+	}
+	slope = (n*sumXY - sumX*sumY) / denominator
+	return slope, (sumY - slope*sumX) / n
+}
+
+func printReport() error {
+	var since time.Time
+	if reportWindow > 0 {
+		since = time.Now().Add(-reportWindow)
+	}
+	samples, skipped, err := readSamples(reportIn, reportCluster, since)
+	if err != nil {
+		return err
+	}
+	if skipped > 0 {
+		color.Yellow("Skipped %d lines that can not be decoded\n", skipped)
+	}
+	trends := shardTrends(samples)
+	if len(trends) == 0 {
+		return fmt.Errorf("no sample of a cluster with slots in %s for the window", reportIn)
+	}
+	for n, t := range trends {
+		if n == 0 || trends[n-1].Cluster != t.Cluster {
+			printReportHeader(t.Cluster, samples)
+		}
+		fmt.Printf("%-24s%-8d%-10s%-14s%-12s%-14s%-10.0f%-12s%-10.0f%-10.0f%s\n", t.Master, t.SlotCount,
+			r.FormatBytes(t.Memory), formatGrowth(r.FormatBytes(t.MemoryPerDay)), formatCount(t.Keys), formatGrowth(formatCount(t.KeysPerDay)),
+			t.Clients, formatGrowth(fmt.Sprintf("%.1f", t.ClientsPerDay)), t.OpsAvg, t.OpsMax, slotsSummary(t.Slots))
+	}
+	return nil
+}
+
+func printReportHeader(cluster string, samples []Sample) {
+	var from, to time.Time
+	count, failed := 0, 0
+	for _, s := range samples {
+		if s.Cluster != cluster {
+			continue
+		}
+		if from.IsZero() {
+			from = s.Time
+		}
+		to = s.Time
+		count++
+		if s.Error != "" {
+			failed++
+		}
+	}
+	fmt.Println(strings.Repeat("=", 130))
+	fmt.Printf("%-16s:\t%s\n", "Cluster", cluster)
+	fmt.Printf("%-16s:\t%s - %s (%v), %d samples, %d failed\n", "Window", from.Local().Format("2006-01-02 15:04"),
+		to.Local().Format("2006-01-02 15:04"), to.Sub(from).Round(time.Minute), count, failed)
+	fmt.Println(strings.Repeat("=", 130))
+	color.Cyan("%-24s%-8s%-10s%-14s%-12s%-14s%-10s%-12s%-10s%-10s%s\n", "Master", "Slots", "Memory", "Memory/day", "Keys",
+		"Keys/day", "Clients", "Clients/day", "Ops avg", "Ops max", "Slot ranges")
+	fmt.Printf("%-24s%-8s%-10s%-14s%-12s%-14s%-10s%-12s%-10s%-10s%s\n", "------", "-----", "------", "----------", "----",
+		"--------", "-------", "-----------", "-------", "-------", "-----------")
+}
+
+// formatGrowth adds the sign of a positive growth
+func formatGrowth(s string) string {
+	if strings.HasPrefix(s, "-") || s == "0B" || s == "0" || s == "0.0" {
+		return s
+	}
+	return "+" + s
+}
+
+func formatCount(n float64) string {
+	switch {
+	case math.Abs(n) >= 1e9:
+		return fmt.Sprintf("%.2fG", n/1e9)
+	case math.Abs(n) >= 1e6:
+		return fmt.Sprintf("%.2fM", n/1e6)
+	case math.Abs(n) >= 1e3:
+		return fmt.Sprintf("%.1fK", n/1e3)
+	}
+	return fmt.Sprintf("%.0f", n)
+}
+
+// slotsSummary shortens long slot ranges to the first ones
+func slotsSummary(slots string) string {
+	ranges := strings.Split(slots, ",")
+	if len(ranges) <= 3 {
+		return slots
+	}
+	return strings.Join(ranges[:3], ",") + fmt.Sprintf(",... (%d ranges)", len(ranges))
+}
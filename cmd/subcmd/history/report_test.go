@@ -0,0 +1,74 @@
+package history
+
+import (
+	"math"
+	r "redis-cluster-manager/redis"
+	"testing"
+	"time"
+)
+
+func TestFitLine(t *testing.T) {
+	slope, intercept := fitLine([]float64{0, 1, 2, 3}, []float64{1, 3, 5, 7})
+	if math.Abs(slope-2) > 1e-9 || math.Abs(intercept-1) > 1e-9 {
+		t.Fatalf("fitLine() = %v, %v, want 2, 1", slope, intercept)
+	}
+	if slope, intercept := fitLine([]float64{1, 1}, []float64{2, 4}); slope != 0 || intercept != 3 {
+		t.Fatalf("fitLine() = %v, %v, want 0, 3", slope, intercept)
+	}
+}
+
+func TestShardTrends(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(hours int) time.Time { return start.Add(time.Duration(hours) * time.Hour) }
+	empty := NodeSample{Addr: "127.0.0.1:7002", NodeID: "m2", Role: "master"}
+	samples := []Sample{
+		{Time: at(0), Cluster: "a", Nodes: []NodeSample{
+			{Addr: "127.0.0.1:7000", NodeID: "m1", Role: "master", Slots: "0-16383", SlotCount: 16384, Keys: 10, Info: map[string]string{
+				"used_memory": "1000", "connected_clients": "10", "total_commands_processed": "0"}},
+			{Addr: "127.0.0.1:7001", NodeID: "s1", Role: "slave", MasterID: "m1", Info: map[string]string{
+				"used_memory": "1000", "connected_clients": "10", "total_commands_processed": "0"}},
+			empty,
+		}},
+		{Time: at(12), Cluster: "a", Nodes: []NodeSample{
+			{Addr: "127.0.0.1:7000", NodeID: "m1", Role: "master", Slots: "0-16383", SlotCount: 16384, Keys: 15, Info: map[string]string{
+				"used_memory": "1500", "connected_clients": "10", "total_commands_processed": "43200"}},
+			{Addr: "127.0.0.1:7001", NodeID: "s1", Role: "slave", MasterID: "m1", Info: map[string]string{
+				"used_memory": "1500", "connected_clients": "10", "total_commands_processed": "0"}},
+			empty,
+		}},
+		{Time: at(24), Cluster: "a", Nodes: []NodeSample{
+			{Addr: "127.0.0.1:7000", NodeID: "m1", Role: "master", Slots: "0-16383", SlotCount: 16384, Keys: 20, Info: map[string]string{
+				"used_memory": "2000", "connected_clients": "10", "total_commands_processed": "129600"}},
+			{Addr: "127.0.0.1:7001", NodeID: "s1", Role: "slave", MasterID: "m1", Info: map[string]string{
+				"used_memory": "2000", "connected_clients": "10", "total_commands_processed": "100"}},
+			empty,
+		}},
+		{Time: at(30), Cluster: "a", Error: "none of the seed nodes is usable"},
+		// failed over to s1 and m1 restarted, the shard keeps it's slots and m1 is left out of this interval
+		{Time: at(36), Cluster: "a", Nodes: []NodeSample{
+			{Addr: "127.0.0.1:7000", NodeID: "m1", Role: "slave", MasterID: "s1", Info: map[string]string{
+				"used_memory": "2500", "connected_clients": "10", "total_commands_processed": "10"}},
+			{Addr: "127.0.0.1:7001", NodeID: "s1", Role: "master", Slots: "0-16383", SlotCount: 16384, Keys: 25, Info: map[string]string{
+				"used_memory": "2500", "connected_clients": "10", "total_commands_processed": "43300"}},
+			empty,
+		}},
+	}
+	trends := shardTrends(samples)
+	if len(trends) != 1 {
+		t.Fatalf("shardTrends() = %+v, want one shard", trends)
+	}
+	trend := trends[0]
+	if trend.Master != "127.0.0.1:7001" || trend.Samples != 4 || math.Abs(trend.MemoryPerDay-1000) > 1e-6 ||
+		math.Abs(trend.KeysPerDay-10) > 1e-6 || trend.Memory != 2500 || trend.Clients != 20 {
+		t.Fatalf("shardTrends() = %+v", trend)
+	}
+	if math.Abs(trend.OpsMax-86500.0/43200) > 1e-9 || math.Abs(trend.OpsAvg-172900.0/129600) > 1e-9 {
+		t.Fatalf("ops avg %v, max %v", trend.OpsAvg, trend.OpsMax)
+	}
+}
+
+func TestFormatGrowth(t *testing.T) {
+	if formatGrowth(r.FormatBytes(1536)) != "+1.5KB" || formatGrowth(formatCount(-2500)) != "-2.5K" || formatGrowth(r.FormatBytes(0)) != "0B" {
+		t.Fatalf("formatGrowth() = %s, %s, %s", formatGrowth(r.FormatBytes(1536)), formatGrowth(formatCount(-2500)), formatGrowth(r.FormatBytes(0)))
+	}
+}
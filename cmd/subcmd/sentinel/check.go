@@ -0,0 +1,190 @@
+package sentinel
+
+import (
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"redis-cluster-manager/config"
+	"redis-cluster-manager/perf"
+	r "redis-cluster-manager/redis"
+	"redis-cluster-manager/vars"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// infoRefreshLimit is the max `info-refresh` in ms of a healthy sentinel view, sentinels run INFO on the master every 10s
+const infoRefreshLimit = 30000
+
+// pingReplyLimit is the max `last-ping-reply` and `last-ok-ping-reply` in ms of a healthy view, sentinels ping every second
+const pingReplyLimit = 10000
+
+// checkedFields are the `sentinel master` fields that must be the same on all sentinels
+var checkedFields = []string{"quorum", "down-after-milliseconds", "failover-timeout", "parallel-syncs"}
+
+var CheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check configuration consistency of sentinels",
+	Long: `Compare SENTINEL MASTER settings (quorum, down-after-milliseconds, failover-timeout, parallel-syncs) across all
+sentinels, compare whether the master accepts the auth-pass of every sentinel, check that every sentinel still gets INFO
+replies from the master, and flag sentinels that monitor a stale master or report a different set of known slaves.
+Sentinels do not report their auth-pass: it's ok if the master accepts the pings of the sentinel, rejected if the
+master answers them with errors such as NOAUTH, and unknown if the master does not answer at all.`,
+	Args: cobra.ExactArgs(1),
+	Example: fmt.Sprintf("%s sentinel check <sentinel> -m <master-name>\n"+
+		"%s sentinel check <data-node> -a \"password\"", vars.AppName, vars.AppName),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vars.HostPort = config.ResolveSeed(args[0])
+		f := perf.StartCpuProfile()
+		defer perf.StopCpuProfile(f)
+		if err := printSentinelCheck(vars.HostPort); err != nil {
+			return err
+		}
+		perf.MemProfile()
+		return nil
+	},
+}
+
+// masterInfoFresh reports whether the sentinel got an INFO reply from the master within infoRefreshLimit
+func (v *sentinelView) masterInfoFresh() bool {
+	infoRefresh, err := strconv.Atoi(v.Master["info-refresh"])
+	return err == nil && infoRefresh < infoRefreshLimit
+}
+
+// authPass tells whether the master accepts the auth-pass of the sentinel: ok, rejected or unknown.
+// a master requiring a password answers the pings of a sentinel without the right auth-pass with an error, which
+// refreshes last-ping-reply but not last-ok-ping-reply. it's unknown if the master does not answer at all
+func (v *sentinelView) authPass() string {
+	okReply, errOK := strconv.Atoi(v.Master["last-ok-ping-reply"])
+	reply, err := strconv.Atoi(v.Master["last-ping-reply"])
+	switch {
+	case errOK == nil && okReply < pingReplyLimit:
+		return "ok"
+	case err == nil && reply < pingReplyLimit:
+		return "rejected"
+	}
+	return "unknown"
+}
+
+// replicaSet returns the sorted addrs of slaves known by the sentinel
+func (v *sentinelView) replicaSet() string {
+	var addrs []string
+	for _, replica := range v.Replicas {
+		addrs = append(addrs, r.FieldsAddr(replica))
+	}
+	sort.Strings(addrs)
+	return strings.Join(addrs, ",")
+}
+
+// majorityValue returns the value reported by most views
+func majorityValue(views []*sentinelView, value func(*sentinelView) string) string {
+	counts := make(map[string]int)
+	for _, v := range views {
+		if v.Err == nil {
+			counts[value(v)]++
+		}
+	}
+	result, found := "", false
+	for val, n := range counts {
+		if !found || n > counts[result] || (n == counts[result] && val < result) {
+			result, found = val, true
+		}
+	}
+	return result
+}
+
+// checkViews returns the inconsistencies found in views, isMaster tells whether an addr is a master indeed
+func checkViews(views []*sentinelView, isMaster func(addr string) bool) []string {
+	var issues []string
+	for _, field := range checkedFields {
+		expected := majorityValue(views, func(v *sentinelView) string { return v.Master[field] })
+		for _, v := range views {
+			if v.Err == nil && v.Master[field] != expected {
+				issues = append(issues, fmt.Sprintf("sentinel %s: %s is %s, others %s", v.Addr, field, v.Master[field], expected))
+			}
+		}
+	}
+	expectedAuth := majorityValue(views, (*sentinelView).authPass)
+	masterChecked := make(map[string]bool)
+	for _, v := range views {
+		if v.Err != nil {
+			issues = append(issues, fmt.Sprintf("sentinel %s: %v", v.Addr, v.Err))
+			continue
+		}
+		switch auth := v.authPass(); {
+		case auth == "rejected":
+			issues = append(issues, fmt.Sprintf("sentinel %s: master rejects it's pings, auth-pass is missing or wrong", v.Addr))
+		case auth != expectedAuth:
+			issues = append(issues, fmt.Sprintf("sentinel %s: auth-pass is %s, others %s", v.Addr, auth, expectedAuth))
+		}
+		if !v.masterInfoFresh() {
+			issues = append(issues, fmt.Sprintf("sentinel %s: no INFO reply from master for %sms, check connectivity",
+				v.Addr, v.Master["info-refresh"]))
+		}
+		if _, checked := masterChecked[v.MasterAddr]; !checked {
+			masterChecked[v.MasterAddr] = isMaster(v.MasterAddr)
+		}
+		if !masterChecked[v.MasterAddr] {
+			issues = append(issues, fmt.Sprintf("sentinel %s: monitors stale master %s, which is not a master", v.Addr, v.MasterAddr))
+		}
+	}
+	expectedReplicas := majorityValue(views, (*sentinelView).replicaSet)
+	for _, v := range views {
+		if v.Err == nil && v.replicaSet() != expectedReplicas {
+			issues = append(issues, fmt.Sprintf("sentinel %s: knows slaves [%s], others [%s]", v.Addr, v.replicaSet(), expectedReplicas))
+		}
+	}
+	return issues
+}
+
+func printSentinelCheck(hostPort string) error {
+	name, addrs, err := discoverSentinels(hostPort)
+	if err != nil {
+		return err
+	}
+	views := collectViews(name, addrs)
+	fmt.Println(strings.Repeat("=", 130))
+	fmt.Printf("%-16s:\t%s\n", "Master Name", name)
+	fmt.Println(strings.Repeat("=", 130))
+	color.Cyan("%-24s%-24s%-8s%-24s%-20s%-16s%-10s%-8s%s\n", "Sentinel", "Master", "Quorum", "DownAfterMilliseconds",
+		"FailoverTimeout", "ParallelSyncs", "AuthPass", "Info", "KnownSlaves")
+	fmt.Printf("%-24s%-24s%-8s%-24s%-20s%-16s%-10s%-8s%s\n", "--------", "------", "------", "---------------------",
+		"---------------", "-------------", "--------", "----", "-----------")
+	for _, v := range views {
+		if v.Err != nil {
+			fmt.Printf("%-24s%s\n", v.Addr, color.RedString("%v", v.Err))
+			continue
+		}
+		auth := color.GreenString("%-10s", "ok")
+		switch v.authPass() {
+		case "rejected":
+			auth = color.RedString("%-10s", "rejected")
+		case "unknown":
+			auth = color.YellowString("%-10s", "unknown")
+		}
+		info := color.GreenString("%-8s", "fresh")
+		if !v.masterInfoFresh() {
+			info = color.RedString("%-8s", "stale")
+		}
+		fmt.Printf("%-24s%-24s%-8s%-24s%-20s%-16s%s%s%s\n", v.Addr, v.MasterAddr, v.Master["quorum"],
+			v.Master["down-after-milliseconds"], v.Master["failover-timeout"], v.Master["parallel-syncs"], auth, info,
+			v.replicaSet())
+	}
+	issues := checkViews(views, func(addr string) bool {
+		i, err := r.NewInstance(addr)
+		if err != nil {
+			return false
+		}
+		defer i.Close()
+		return i.Role == "master"
+	})
+	if len(issues) == 0 {
+		color.Green("All %d sentinels are consistent.\n", len(views))
+		return nil
+	}
+	color.Cyan("Issues: %d\n", len(issues))
+	for _, issue := range issues {
+		color.Red("  %s\n", issue)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package sentinel
+
+import "testing"
+
+func TestCheckViews(t *testing.T) {
+	master := func(quorum, infoRefresh, lastOKPing string) map[string]string {
+		return map[string]string{"quorum": quorum, "down-after-milliseconds": "30000", "failover-timeout": "180000",
+			"parallel-syncs": "1", "info-refresh": infoRefresh, "last-ping-reply": "500", "last-ok-ping-reply": lastOKPing}
+	}
+	replicas := []map[string]string{{"ip": "10.0.0.2", "port": "6379"}}
+	views := []*sentinelView{
+		{Addr: "s1", MasterAddr: "10.0.0.1:6379", Master: master("2", "1000", "500"), Replicas: replicas},
+		{Addr: "s2", MasterAddr: "10.0.0.1:6379", Master: master("2", "1000", "500"), Replicas: replicas},
+		{Addr: "s3", MasterAddr: "10.0.0.3:6379", Master: master("3", "90000", "90000")},
+	}
+	issues := checkViews(views, func(addr string) bool { return addr == "10.0.0.1:6379" })
+	// s3: quorum differs, auth-pass rejected, no INFO reply from master, stale master, different slaves
+	if len(issues) != 5 {
+		t.Fatalf("issues = %v, want 5", issues)
+	}
+	if issues := checkViews(views[:2], func(string) bool { return true }); len(issues) != 0 {
+		t.Fatalf("issues = %v, want none", issues)
+	}
+}
+
+func TestAuthPass(t *testing.T) {
+	tests := []struct {
+		name   string
+		ping   string
+		okPing string
+		want   string
+	}{
+		{name: "pings accepted", ping: "300", okPing: "300", want: "ok"},
+		{name: "pings answered with errors", ping: "300", okPing: "120000", want: "rejected"},
+		{name: "no reply at all", ping: "120000", okPing: "120000", want: "unknown"},
+		{name: "fields missing", want: "unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &sentinelView{Master: map[string]string{"last-ping-reply": tt.ping, "last-ok-ping-reply": tt.okPing}}
+			if got := v.authPass(); got != tt.want {
+				t.Fatalf("authPass() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package sentinel
+
+import (
+	"context"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"redis-cluster-manager/cmd/subcmd/cluster"
+	"redis-cluster-manager/config"
+	"redis-cluster-manager/perf"
+	r "redis-cluster-manager/redis"
+	"redis-cluster-manager/vars"
+	"time"
+)
+
+var failoverTimeout time.Duration // max time to wait for sentinels and data nodes to agree on the new master
+
+// switchCheckInterval is the interval between two checks while following a sentinel failover
+const switchCheckInterval = time.Second
+
+var FailoverCmd = &cobra.Command{
+	Use:   "failover",
+	Short: "Trigger a sentinel failover and follow the switch",
+	Long: `Run SENTINEL FAILOVER on a sentinel, then wait until all reachable sentinels report the same new master, the new
+master reports role master and the old master (if reachable) has become it's slave. The new master is reported.`,
+	Args: cobra.ExactArgs(1),
+	Example: fmt.Sprintf("%s sentinel failover <sentinel> -m <master-name> -a \"password\"\n"+
+		"%s sentinel failover <data-node> -a \"password\"", vars.AppName, vars.AppName),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vars.HostPort = config.ResolveSeed(args[0])
+		f := perf.StartCpuProfile()
+		defer perf.StopCpuProfile(f)
+		if err := sentinelFailover(vars.HostPort); err != nil {
+			return err
+		}
+		perf.MemProfile()
+		return nil
+	},
+}
+
+func InitFailover() {
+	FailoverCmd.Flags().DurationVar(&failoverTimeout, "failover-timeout", time.Minute, "max time to wait for the switch to finish")
+}
+
+func sentinelFailover(hostPort string) error {
+	if err := config.CheckWritable("sentinel failover"); err != nil {
+		return err
+	}
+	name, addrs, err := discoverSentinels(hostPort)
+	if err != nil {
+		return err
+	}
+	oldMaster, agreed := majorityMaster(collectViews(name, addrs))
+	if oldMaster == "" {
+		return fmt.Errorf("no sentinel of %s can be queried", name)
+	}
+	if !agreed {
+		return fmt.Errorf("sentinels disagree on master, run `%s sentinel check` first", vars.AppName)
+	}
+	var s *r.Sentinel
+	for _, addr := range addrs {
+		if s, err = r.NewSentinel(addr); err == nil {
+			break
+		}
+	}
+	if s == nil {
+		return err
+	}
+	color.Yellow("Running SENTINEL FAILOVER %s on %s, current master %s ...\n", name, s.Addr, oldMaster)
+	err = s.Client.Failover(context.Background(), name).Err()
+	s.Close()
+	if err != nil {
+		return fmt.Errorf("failed to run sentinel failover on %s: %v", s.Addr, err)
+	}
+	newMaster, err := waitForSwitch(name, addrs, oldMaster)
+	if err != nil {
+		return err
+	}
+	color.Green("Failover finished, new master of %s: %s\n", name, newMaster)
+	master, err := r.NewInstance(newMaster)
+	if err != nil {
+		return err
+	}
+	defer master.Close()
+	return cluster.PrintMasterSlaveStatus(master)
+}
+
+// waitForSwitch waits until sentinels and data nodes agree on a new master other than oldMaster
+func waitForSwitch(name string, addrs []string, oldMaster string) (string, error) {
+	deadline := time.Now().Add(failoverTimeout)
+	status := "sentinels still report the old master"
+	for time.Now().Before(deadline) {
+		time.Sleep(switchCheckInterval)
+		var newMaster string
+		if newMaster, status = sentinelSwitch(collectViews(name, addrs), oldMaster); status != "" {
+			continue
+		}
+		if status = switchedTo(newMaster, oldMaster); status == "" {
+			return newMaster, nil
+		}
+	}
+	return "", fmt.Errorf("failover of %s not finished in %v: %s", name, failoverTimeout, status)
+}
+
+// sentinelSwitch returns the new master all sentinels agree on, or "" and why the switch is not seen yet
+func sentinelSwitch(views []*sentinelView, oldMaster string) (string, string) {
+	newMaster, agreed := majorityMaster(views)
+	if newMaster == oldMaster || newMaster == "" {
+		return "", "sentinels still report the old master"
+	}
+	if !agreed {
+		return "", fmt.Sprintf("sentinels have not agreed on new master %s yet", newMaster)
+	}
+	return newMaster, ""
+}
+
+// switchedTo returns "" if newMaster is a master and reachable oldMaster is it's slave, otherwise the reason
+func switchedTo(newMaster, oldMaster string) string {
+	m, err := r.NewInstance(newMaster)
+	if err != nil {
+		return fmt.Sprintf("new master %s can not be connected: %v", newMaster, err)
+	}
+	defer m.Close()
+	if m.Role != "master" {
+		return fmt.Sprintf("new master %s reports role %s", newMaster, m.Role)
+	}
+	old, err := r.NewInstance(oldMaster)
+	if err != nil {
+		// the old master is down, it will be converted to a slave by sentinels when it's back
+		return ""
+	}
+	defer old.Close()
+	if old.Role != "slave" || old.Master != newMaster {
+		return fmt.Sprintf("old master %s has not become a slave of %s", oldMaster, newMaster)
+	}
+	return ""
+}
@@ -0,0 +1,45 @@
+package sentinel
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSentinelSwitch(t *testing.T) {
+	view := func(addr, master, epoch string) *sentinelView {
+		return &sentinelView{Addr: addr, MasterAddr: master, Master: map[string]string{"config-epoch": epoch}}
+	}
+	tests := []struct {
+		name  string
+		views []*sentinelView
+		want  string
+	}{
+		{
+			name:  "old master still reported",
+			views: []*sentinelView{view("s1", "10.0.0.1:6379", "1"), view("s2", "10.0.0.1:6379", "1")},
+		},
+		{
+			name:  "no sentinel reachable",
+			views: []*sentinelView{{Addr: "s1", Err: errors.New("connection refused")}},
+		},
+		{
+			name:  "sentinels disagree",
+			views: []*sentinelView{view("s1", "10.0.0.2:6379", "2"), view("s2", "10.0.0.1:6379", "1")},
+		},
+		{
+			name: "all agree on the new master",
+			views: []*sentinelView{view("s1", "10.0.0.2:6379", "2"), view("s2", "10.0.0.2:6379", "2"),
+				{Addr: "s3", Err: errors.New("connection refused")}},
+			want: "10.0.0.2:6379",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, status := sentinelSwitch(tt.views, "10.0.0.1:6379")
+			if got != tt.want || (got == "") == (status == "") {
+				t.Fatalf("sentinelSwitch() = %q, %q, want %q", got, status, tt.want)
+			}
+		})
+	}
+}
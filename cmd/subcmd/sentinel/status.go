@@ -0,0 +1,286 @@
+package sentinel
+
+import (
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"net"
+	"redis-cluster-manager/cmd/subcmd/cluster"
+	"redis-cluster-manager/config"
+	"redis-cluster-manager/perf"
+	r "redis-cluster-manager/redis"
+	"redis-cluster-manager/vars"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var StatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show sentinel status",
+	Long: `Query every sentinel monitoring the master with SENTINEL MASTER/REPLICAS/SENTINELS and SENTINEL CKQUORUM, show
+each sentinel's view of the current master and whether the sentinels disagree, then show the master-slave status.
+The seed node can be a sentinel, or a data node whose sentinels are found by it's client list.`,
+	Args: cobra.ExactArgs(1),
+	Example: fmt.Sprintf("%s sentinel status <sentinel> -m <master-name>\n"+
+		"%s sentinel status <data-node> -a \"password\" [--sentinel-port 26379]", vars.AppName, vars.AppName),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		vars.HostPort = config.ResolveSeed(args[0])
+		f := perf.StartCpuProfile()
+		defer perf.StopCpuProfile(f)
+		if err := printSentinelStatus(vars.HostPort); err != nil {
+			return err
+		}
+		perf.MemProfile()
+		return nil
+	},
+}
+
+// sentinelView is what a sentinel believes about the monitored master
+type sentinelView struct {
+	Addr       string
+	Err        error
+	MasterAddr string              // reply of `sentinel get-master-addr-by-name`
+	Master     map[string]string   // reply of `sentinel master`
+	Replicas   []map[string]string // reply of `sentinel replicas`
+	CkQuorum   string              // reply or error of `sentinel ckquorum`
+	QuorumOK   bool
+}
+
+// discoverSentinels returns the master name and addr of all sentinels monitoring it, found by the first usable seed of
+// comma separated hostPort
+func discoverSentinels(hostPort string) (string, []string, error) {
+	seeds := strings.Split(hostPort, ",")
+	var err error
+	for _, seed := range seeds {
+		name, addrs, seedErr := discoverSentinelsFrom(strings.TrimSpace(seed))
+		if seedErr == nil {
+			if len(seeds) > 1 {
+				color.Cyan("Using seed node %s\n", seed)
+			}
+			return name, addrs, nil
+		}
+		err = fmt.Errorf("seed node %s: %v", seed, seedErr)
+		if len(seeds) > 1 {
+			color.Yellow("Skipped %v\n", err)
+		}
+	}
+	return "", nil, err
+}
+
+// discoverSentinelsFrom returns the master name and addr of all sentinels monitoring it.
+// if hostPort is a data node, sentinels are found by it's client list and vars.SentinelPort
+func discoverSentinelsFrom(hostPort string) (string, []string, error) {
+	name := vars.Cluster.MasterName
+	var seeds []string
+	masterAddr := ""
+	if r.IsSentinel(hostPort) {
+		seeds = append(seeds, hostPort)
+	} else {
+		node, err := r.NewInstance(hostPort)
+		if err != nil {
+			return "", nil, err
+		}
+		defer node.Close()
+		ips, err := node.GetSentinels()
+		if err != nil {
+			return "", nil, err
+		}
+		if len(ips) == 0 {
+			return "", nil, fmt.Errorf("no sentinel found in client list of %s", hostPort)
+		}
+		sort.Strings(ips)
+		for _, ip := range ips {
+			seeds = append(seeds, net.JoinHostPort(ip, strconv.Itoa(vars.SentinelPort)))
+		}
+		masterAddr = node.Addr
+		if node.Role == "slave" {
+			masterAddr = node.Master
+		}
+	}
+	return sentinelsFrom(seeds, func(seed string) ([]string, error) {
+		s, err := r.NewSentinel(seed)
+		if err != nil {
+			return nil, err
+		}
+		defer s.Close()
+		return sentinelsOf(s, name, masterAddr)
+	})
+}
+
+// sentinelsFrom asks seeds one by one with query, which returns []string{masterName, seed, other sentinels...}, and
+// returns the master name and the sentinels of the first answer. sentinels found by client list may be missing in
+// `sentinel sentinels` if they are down, so every seed is kept, the ones that did not answer too
+func sentinelsFrom(seeds []string, query func(seed string) ([]string, error)) (string, []string, error) {
+	var lastErr error
+	for _, seed := range seeds {
+		addrs, err := query(seed)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return addrs[0], mergeAddrs(addrs[1:], seeds), nil
+	}
+	return "", nil, lastErr
+}
+
+// sentinelsOf returns []string{masterName, s.Addr, other sentinels...}.
+// if name is not given, it is the only master monitored by s, or the one whose addr is masterAddr
+func sentinelsOf(s *r.Sentinel, name, masterAddr string) ([]string, error) {
+	if name == "" {
+		masters, err := s.Masters()
+		if err != nil {
+			return nil, err
+		}
+		var names []string
+		for _, m := range masters {
+			names = append(names, m["name"])
+			if masterAddr != "" && r.FieldsAddr(m) == masterAddr {
+				name = m["name"]
+			}
+		}
+		if name == "" && len(masters) == 1 {
+			name = masters[0]["name"]
+		}
+		if name == "" {
+			return nil, fmt.Errorf("sentinel %s monitors masters %v, please specify one by -m", s.Addr, names)
+		}
+	}
+	others, err := s.Sentinels(name)
+	if err != nil {
+		return nil, err
+	}
+	result := []string{name, s.Addr}
+	for _, other := range others {
+		result = append(result, r.FieldsAddr(other))
+	}
+	return result, nil
+}
+
+// mergeAddrs returns addrs followed by the extra ones not in it
+func mergeAddrs(addrs, extra []string) []string {
+	seen := make(map[string]bool)
+	for _, addr := range addrs {
+		seen[addr] = true
+	}
+	for _, addr := range extra {
+		if !seen[addr] {
+			seen[addr] = true
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// collectViews queries all sentinels simultaneously, views are sorted by sentinel addr
+func collectViews(name string, addrs []string) []*sentinelView {
+	var (
+		views []*sentinelView
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+	)
+	for _, addr := range addrs {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			view := collectView(name, addr)
+			mu.Lock()
+			views = append(views, view)
+			mu.Unlock()
+		}(addr)
+	}
+	wg.Wait()
+	sort.Slice(views, func(i, j int) bool { return views[i].Addr < views[j].Addr })
+	return views
+}
+
+func collectView(name, addr string) *sentinelView {
+	view := &sentinelView{Addr: addr}
+	s, err := r.NewSentinel(addr)
+	if err != nil {
+		view.Err = err
+		return view
+	}
+	defer s.Close()
+	if view.MasterAddr, view.Err = s.GetMasterAddr(name); view.Err != nil {
+		return view
+	}
+	if view.Master, view.Err = s.Master(name); view.Err != nil {
+		return view
+	}
+	if view.Replicas, view.Err = s.Replicas(name); view.Err != nil {
+		return view
+	}
+	view.CkQuorum, err = s.CkQuorum(name)
+	view.QuorumOK = err == nil
+	if err != nil {
+		view.CkQuorum = err.Error()
+	}
+	return view
+}
+
+// majorityMaster returns the master addr believed by most sentinels, and whether all sentinels agree on master and epoch
+func majorityMaster(views []*sentinelView) (string, bool) {
+	votes := make(map[string]int)
+	epochs := make(map[string]bool)
+	for _, v := range views {
+		if v.Err == nil {
+			votes[v.MasterAddr]++
+			epochs[v.Master["config-epoch"]] = true
+		}
+	}
+	master := ""
+	for addr, n := range votes {
+		if n > votes[master] || (n == votes[master] && addr < master) {
+			master = addr
+		}
+	}
+	return master, len(votes) == 1 && len(epochs) == 1
+}
+
+func printSentinelStatus(hostPort string) error {
+	name, addrs, err := discoverSentinels(hostPort)
+	if err != nil {
+		return err
+	}
+	views := collectViews(name, addrs)
+	fmt.Println(strings.Repeat("=", 130))
+	fmt.Printf("%-16s:\t%s\n", "Master Name", name)
+	fmt.Println(strings.Repeat("=", 130))
+	color.Cyan("%-24s%-24s%-8s%-24s%-8s%-12s%-8s%s\n", "Sentinel", "Master", "Epoch", "Flags", "Slaves",
+		"Sentinels", "Quorum", "CkQuorum")
+	fmt.Printf("%-24s%-24s%-8s%-24s%-8s%-12s%-8s%s\n", "--------", "------", "-----", "-----", "------",
+		"---------", "------", "--------")
+	master, agreed := majorityMaster(views)
+	for _, v := range views {
+		if v.Err != nil {
+			fmt.Printf("%-24s%s\n", v.Addr, color.RedString("%v", v.Err))
+			continue
+		}
+		masterAddr := fmt.Sprintf("%-24s", v.MasterAddr)
+		if v.MasterAddr != master {
+			masterAddr = color.RedString(masterAddr)
+		}
+		ckQuorum := color.GreenString(v.CkQuorum)
+		if !v.QuorumOK {
+			ckQuorum = color.RedString(v.CkQuorum)
+		}
+		fmt.Printf("%-24s%s%-8s%-24s%-8s%-12s%-8s%s\n", v.Addr, masterAddr, v.Master["config-epoch"], v.Master["flags"],
+			v.Master["num-slaves"], v.Master["num-other-sentinels"], v.Master["quorum"], ckQuorum)
+	}
+	if master == "" {
+		return fmt.Errorf("no sentinel of %s can be queried", name)
+	}
+	if agreed {
+		color.Green("All reachable sentinels agree on master %s\n", master)
+	} else {
+		color.Red("Sentinels disagree on master or config epoch, master believed by most sentinels: %s\n", master)
+	}
+	masterNode, err := r.NewInstance(master)
+	if err != nil {
+		return fmt.Errorf("failed to connect to master %s: %v", master, err)
+	}
+	defer masterNode.Close()
+	return cluster.PrintMasterSlaveStatus(masterNode)
+}
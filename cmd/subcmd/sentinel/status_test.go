@@ -0,0 +1,46 @@
+package sentinel
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMajorityMaster(t *testing.T) {
+	views := []*sentinelView{
+		{Addr: "s1", MasterAddr: "10.0.0.1:6379", Master: map[string]string{"config-epoch": "2"}},
+		{Addr: "s2", MasterAddr: "10.0.0.1:6379", Master: map[string]string{"config-epoch": "2"}},
+		{Addr: "s3", Err: errors.New("connection refused")},
+	}
+	if master, agreed := majorityMaster(views); master != "10.0.0.1:6379" || !agreed {
+		t.Fatalf("majorityMaster() = %s, %v", master, agreed)
+	}
+	views[1].MasterAddr = "10.0.0.2:6379"
+	views = append(views, &sentinelView{Addr: "s4", MasterAddr: "10.0.0.2:6379", Master: map[string]string{"config-epoch": "3"}})
+	if master, agreed := majorityMaster(views); master != "10.0.0.2:6379" || agreed {
+		t.Fatalf("majorityMaster() = %s, %v", master, agreed)
+	}
+}
+
+func TestSentinelsFromKeepsDownSeeds(t *testing.T) {
+	seeds := []string{"10.0.0.1:26379", "10.0.0.2:26379", "10.0.0.3:26379"}
+	query := func(seed string) ([]string, error) {
+		if seed == "10.0.0.1:26379" {
+			return nil, errors.New("connection refused")
+		}
+		// the down sentinel is not reported by `sentinel sentinels` either
+		return []string{"mymaster", seed, "10.0.0.3:26379"}, nil
+	}
+	name, addrs, err := sentinelsFrom(seeds, query)
+	if err != nil {
+		t.Fatalf("sentinelsFrom() error = %v", err)
+	}
+	want := []string{"10.0.0.2:26379", "10.0.0.3:26379", "10.0.0.1:26379"}
+	if name != "mymaster" || !reflect.DeepEqual(addrs, want) {
+		t.Fatalf("sentinelsFrom() = %s, %v, want mymaster, %v", name, addrs, want)
+	}
+
+	if _, _, err := sentinelsFrom(seeds[:1], query); err == nil {
+		t.Fatal("sentinelsFrom() with every seed down should fail")
+	}
+}
@@ -0,0 +1,295 @@
+package serve
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	"log"
+	"net/http"
+	"os"
+	"redis-cluster-manager/cmd/subcmd/cluster"
+	"redis-cluster-manager/config"
+	"redis-cluster-manager/vars"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	apiListen         string        // listen addr of the api server
+	apiCacheTTL       time.Duration // time a GET response is served from the cache
+	apiMaxConcurrency int           // max requests working on the same cluster at the same time
+	apiTokenEnv       string        // environment variable holding the bearer token
+	apiWriteTimeout   time.Duration // max time to answer a request
+)
+
+var APICmd = &cobra.Command{
+	Use:   "api",
+	Short: "Serve cluster reports over HTTP/JSON",
+	Long: `Serve the reports of the clusters given by profile names or seed nodes over HTTP, in the same JSON as the
+--json output of the cluster commands. Every request needs the bearer token read from --token-env.
+
+  GET  /clusters                                   served clusters
+  GET  /clusters/{cluster}/status                  cluster status --json
+  GET  /clusters/{cluster}/check                   cluster check --json
+  GET  /clusters/{cluster}/slowlog?count=10        slowlogs of all nodes, the slowest first
+  GET  /clusters/{cluster}/nodes/{node}/info?section=all
+  POST /clusters/{cluster}/exec      {"command": ["config", "get", "maxmemory"], "nodes": "", "role": "master"}
+  POST /clusters/{cluster}/failover  {"node": "<slave addr or node id>"}
+
+{cluster} is the profile name or the seed argument, {node} is a host:port or a node ID. GET responses are cached
+for --cache-ttl. exec and failover change clusters, they are refused unless listed in api-mutations of the profile
+policy, and exec keeps the forbidden commands and read-only policy of the profile.`,
+	Args:    cobra.MinimumNArgs(1),
+	Example: fmt.Sprintf("RCM_API_TOKEN=secret %s serve api --listen :9122 <profile|seed-node> [<profile|seed-node> ...]", vars.AppName),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return serveAPI(args)
+	},
+}
+
+func InitAPI() {
+	APICmd.Flags().StringVar(&apiListen, "listen", ":9122", "listen addr of the api server")
+	APICmd.Flags().DurationVar(&apiCacheTTL, "cache-ttl", time.Second*10, "time a GET response is served from the cache, 0 to disable")
+	APICmd.Flags().IntVar(&apiMaxConcurrency, "max-concurrency", 4, "max requests working on the same cluster at the same time")
+	APICmd.Flags().StringVar(&apiTokenEnv, "token-env", "RCM_API_TOKEN", "environment variable holding the bearer token")
+	APICmd.Flags().DurationVar(&apiWriteTimeout, "write-timeout", time.Minute*2, "max time to answer a request, it must cover a verified failover")
+}
+
+// apiError is an error with the http status it's answered with
+type apiError struct {
+	Status int
+	Err    error
+}
+
+func (e *apiError) Error() string { return e.Err.Error() }
+
+func badRequest(format string, a ...interface{}) error {
+	return &apiError{Status: http.StatusBadRequest, Err: fmt.Errorf(format, a...)}
+}
+
+// cachedResponse is a response body served until Expires
+type cachedResponse struct {
+	Status  int
+	Body    []byte
+	Expires time.Time
+}
+
+// apiCache keeps the GET responses by cluster and request uri
+type apiCache struct {
+	mu      sync.Mutex
+	entries map[string]map[string]cachedResponse
+}
+
+func newAPICache() *apiCache {
+	return &apiCache{entries: make(map[string]map[string]cachedResponse)}
+}
+
+func (c *apiCache) get(cluster, uri string, now time.Time) (cachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	resp, exists := c.entries[cluster][uri]
+	if !exists || !now.Before(resp.Expires) {
+		return cachedResponse{}, false
+	}
+	return resp, true
+}
+
+func (c *apiCache) put(cluster, uri string, resp cachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries[cluster] == nil {
+		c.entries[cluster] = make(map[string]cachedResponse)
+	}
+	c.entries[cluster][uri] = resp
+}
+
+// drop forgets the responses of a cluster, called after it's changed
+func (c *apiCache) drop(cluster string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, cluster)
+}
+
+// authorized reports whether the Authorization header carries the token
+func authorized(header, token string) bool {
+	given, found := strings.CutPrefix(header, "Bearer ")
+	return found && token != "" && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
+
+type apiServer struct {
+	token    string
+	names    []string
+	limits   map[string]chan struct{} // per cluster semaphore of --max-concurrency
+	cache    *apiCache
+	cacheTTL time.Duration
+}
+
+func serveAPI(args []string) error {
+	token := os.Getenv(apiTokenEnv)
+	if token == "" {
+		return fmt.Errorf("no api token, set it in $%s", apiTokenEnv)
+	}
+	if apiMaxConcurrency < 1 {
+		return fmt.Errorf("--max-concurrency must be at least 1")
+	}
+	if err := activateAll(args); err != nil {
+		return err
+	}
+	s := &apiServer{token: token, names: args, limits: make(map[string]chan struct{}), cache: newAPICache(), cacheTTL: apiCacheTTL}
+	for _, arg := range args {
+		s.limits[arg] = make(chan struct{}, apiMaxConcurrency)
+	}
+	log.Printf("serving api of %s on %s", strings.Join(args, ", "), apiListen)
+	return newHTTPServer(apiListen, s.routes(), apiWriteTimeout).ListenAndServe()
+}
+
+func (s *apiServer) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /clusters", func(w http.ResponseWriter, req *http.Request) {
+		if !authorized(req.Header.Get("Authorization"), s.token) {
+			writeError(w, &apiError{Status: http.StatusUnauthorized, Err: fmt.Errorf("missing or invalid bearer token")})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string][]string{"clusters": s.names})
+	})
+	mux.HandleFunc("GET /clusters/{cluster}/status", s.handle(false, func(seeds string, req *http.Request) (interface{}, error) {
+		return cluster.StatusReportOf(seeds)
+	}))
+	mux.HandleFunc("GET /clusters/{cluster}/check", s.handle(false, func(seeds string, req *http.Request) (interface{}, error) {
+		return cluster.CheckReportOf(seeds)
+	}))
+	mux.HandleFunc("GET /clusters/{cluster}/slowlog", s.handle(false, func(seeds string, req *http.Request) (interface{}, error) {
+		count := int64(10)
+		if c := req.URL.Query().Get("count"); c != "" {
+			n, err := strconv.ParseInt(c, 10, 64)
+			if err != nil || n < 1 {
+				return nil, badRequest("count must be a positive number")
+			}
+			count = n
+		}
+		return cluster.SlowlogReportOf(seeds, count)
+	}))
+	mux.HandleFunc("GET /clusters/{cluster}/nodes/{node}/info", s.handle(false, func(seeds string, req *http.Request) (interface{}, error) {
+		section := req.URL.Query().Get("section")
+		if section == "" {
+			section = "all"
+		}
+		return cluster.NodeInfoOf(seeds, req.PathValue("node"), section)
+	}))
+	mux.HandleFunc("POST /clusters/{cluster}/exec", s.handle(true, func(seeds string, req *http.Request) (interface{}, error) {
+		var body struct {
+			Command []string `json:"command"`
+			Nodes   string   `json:"nodes"`
+			Role    string   `json:"role"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			return nil, badRequest("invalid body: %v", err)
+		}
+		if len(body.Command) == 0 {
+			return nil, badRequest("no command given")
+		}
+		if config.IsForbidden(body.Command[0]) {
+			return nil, &apiError{Status: http.StatusForbidden, Err: fmt.Errorf("command `%s` is forbidden to execute", body.Command[0])}
+		}
+		return cluster.ExecReportOf(seeds, body.Command, body.Nodes, body.Role)
+	}))
+	mux.HandleFunc("POST /clusters/{cluster}/failover", s.handle(true, func(seeds string, req *http.Request) (interface{}, error) {
+		var body struct {
+			Node string `json:"node"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			return nil, badRequest("invalid body: %v", err)
+		}
+		if body.Node == "" {
+			return nil, badRequest("no node given")
+		}
+		if config.ReadOnly() {
+			return nil, &apiError{Status: http.StatusForbidden, Err: config.CheckWritable("failover")}
+		}
+		return cluster.FailoverTo(seeds, body.Node)
+	}))
+	return mux
+}
+
+// handle answers a request on {cluster} with the JSON of report, after the auth, the cache and the concurrency limit.
+// mutating handlers are refused unless the policy of the cluster enables them, and drop the cached responses
+func (s *apiServer) handle(mutating bool, report func(seeds string, req *http.Request) (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if !authorized(req.Header.Get("Authorization"), s.token) {
+			writeError(w, &apiError{Status: http.StatusUnauthorized, Err: fmt.Errorf("missing or invalid bearer token")})
+			return
+		}
+		name := req.PathValue("cluster")
+		limit, exists := s.limits[name]
+		if !exists {
+			writeError(w, &apiError{Status: http.StatusNotFound, Err: fmt.Errorf("cluster %s is not served", name)})
+			return
+		}
+		uri := req.URL.RequestURI()
+		if !mutating && s.cacheTTL > 0 {
+			if resp, hit := s.cache.get(name, uri, time.Now()); hit {
+				writeBody(w, resp.Status, resp.Body)
+				return
+			}
+		}
+		select {
+		case limit <- struct{}{}:
+			defer func() { <-limit }()
+		case <-req.Context().Done():
+			return
+		}
+		result, err := func() (interface{}, error) {
+			if err := clusters.acquire(name); err != nil {
+				return nil, err
+			}
+			defer clusters.release()
+			if mutating {
+				endpoint := req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:]
+				if !config.AllowsAPIMutation(endpoint) {
+					return nil, &apiError{Status: http.StatusForbidden,
+						Err: fmt.Errorf("%s is disabled, enable it in api-mutations of the profile policy", endpoint)}
+				}
+				defer s.cache.drop(name)
+			}
+			return report(config.ResolveSeed(name), req)
+		}()
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		body, err := json.Marshal(result)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if !mutating && s.cacheTTL > 0 {
+			s.cache.put(name, uri, cachedResponse{Status: http.StatusOK, Body: body, Expires: time.Now().Add(s.cacheTTL)})
+		}
+		writeBody(w, http.StatusOK, body)
+	}
+}
+
+// writeError answers the status of an apiError, other errors come from the cluster and are answered with 502
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusBadGateway
+	if e, ok := err.(*apiError); ok {
+		status = e.Status
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		status, body = http.StatusInternalServerError, []byte(`{"error":"failed to encode response"}`)
+	}
+	writeBody(w, status, body)
+}
+
+func writeBody(w http.ResponseWriter, status int, body []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(body, '\n'))
+}
@@ -0,0 +1,87 @@
+package serve
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"redis-cluster-manager/config"
+)
+
+func TestAuthorized(t *testing.T) {
+	cases := []struct {
+		header string
+		token  string
+		want   bool
+	}{
+		{"Bearer secret", "secret", true},
+		{"Bearer wrong", "secret", false},
+		{"secret", "secret", false},
+		{"Basic secret", "secret", false},
+		{"Bearer ", "", false},
+	}
+	for _, c := range cases {
+		if got := authorized(c.header, c.token); got != c.want {
+			t.Errorf("authorized(%q, %q) = %v, want %v", c.header, c.token, got, c.want)
+		}
+	}
+}
+
+func TestAPICache(t *testing.T) {
+	c := newAPICache()
+	now := time.Now()
+	c.put("a", "/clusters/a/status", cachedResponse{Status: 200, Body: []byte("{}"), Expires: now.Add(time.Second)})
+	if _, hit := c.get("a", "/clusters/a/status", now); !hit {
+		t.Fatal("the response should be cached")
+	}
+	if _, hit := c.get("a", "/clusters/a/status", now.Add(time.Second)); hit {
+		t.Fatal("the response should be expired")
+	}
+	if _, hit := c.get("b", "/clusters/a/status", now); hit {
+		t.Fatal("the response is of another cluster")
+	}
+	c.drop("a")
+	if _, hit := c.get("a", "/clusters/a/status", now); hit {
+		t.Fatal("the responses of a should be dropped")
+	}
+}
+
+func TestAPIRefusals(t *testing.T) {
+	defer func(activate func(string) error) { Activate = activate }(Activate)
+	Activate = func(arg string) error {
+		config.ActiveName, config.Active = arg, &config.Profile{Seeds: []string{"127.0.0.1:1"}}
+		return nil
+	}
+	defer func() { config.ActiveName, config.Active = "", nil }()
+	s := &apiServer{token: "secret", names: []string{"a"}, limits: map[string]chan struct{}{"a": make(chan struct{}, 1)},
+		cache: newAPICache()}
+	mux := s.routes()
+	cases := []struct {
+		method string
+		path   string
+		token  string
+		body   string
+		want   int
+	}{
+		{"GET", "/clusters", "", "", http.StatusUnauthorized},
+		{"GET", "/clusters", "secret", "", http.StatusOK},
+		{"GET", "/clusters/a/status", "wrong", "", http.StatusUnauthorized},
+		{"GET", "/clusters/b/status", "secret", "", http.StatusNotFound},
+		{"POST", "/clusters/a/exec", "secret", `{"command": ["flushall"]}`, http.StatusForbidden},
+		{"POST", "/clusters/a/failover", "secret", `{"node": "127.0.0.1:2"}`, http.StatusForbidden},
+		{"DELETE", "/clusters/a/status", "secret", "", http.StatusMethodNotAllowed},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.path, strings.NewReader(c.body))
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if w.Code != c.want {
+			t.Errorf("%s %s = %d, want %d: %s", c.method, c.path, w.Code, c.want, w.Body.String())
+		}
+	}
+}
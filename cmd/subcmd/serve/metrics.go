@@ -0,0 +1,318 @@
+package serve
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"io"
+	"log"
+	"net/http"
+	"redis-cluster-manager/config"
+	r "redis-cluster-manager/redis"
+	"redis-cluster-manager/vars"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	metricsListen   string        // listen addr of the metrics server
+	metricsInterval time.Duration // time between two collections of all clusters
+)
+
+// metricHelps are the metric families in exposition order
+var metricHelps = []struct {
+	Name string
+	Help string
+}{
+	{"rcm_scrape_success", "1 if the cluster was collected, 0 if the seed nodes are not usable"},
+	{"rcm_scrape_duration_seconds", "time spent collecting the cluster"},
+	{"rcm_cluster_nodes", "number of nodes known by the seed node"},
+	{"rcm_cluster_masters", "number of masters serving slots"},
+	{"rcm_cluster_slots_covered", "number of slots served by a master"},
+	{"rcm_cluster_slots_fail", "number of slots served by masters flagged fail"},
+	{"rcm_cluster_slots_pfail", "number of slots served by masters flagged fail?"},
+	{"rcm_cluster_open_migrations", "number of slots migrating or importing on any node"},
+	{"rcm_cluster_masters_without_replicas", "number of masters serving slots without a healthy replica"},
+	{"rcm_cluster_config_epoch_collisions", "number of config epochs shared by several masters"},
+	{"rcm_cluster_unreachable_nodes", "number of nodes that can not be connected"},
+	{"rcm_node_up", "1 if the node can be connected"},
+	{"rcm_node_role", "role of the node, 1 for the role label"},
+	{"rcm_node_used_memory_bytes", "used_memory of the node"},
+	{"rcm_node_maxmemory_bytes", "maxmemory of the node, 0 if unlimited"},
+	{"rcm_node_connected_clients", "connected_clients of the node"},
+	{"rcm_node_maxclients", "maxclients of the node"},
+	{"rcm_node_keys", "number of keys in all databases of the node"},
+	{"rcm_node_ops_per_second", "instantaneous_ops_per_sec of the node"},
+	{"rcm_node_replication_lag_bytes", "master_repl_offset of the master minus slave_repl_offset of the replica"},
+}
+
+var MetricsCmd = &cobra.Command{
+	Use:   "metrics",
+	Short: "Serve Prometheus metrics of clusters",
+	Long: `Collect the clusters given by profile names or seed nodes every --interval and serve the result on /metrics
+in the Prometheus text format. Per node gauges: up, role, memory, clients, keys, ops and replication lag. Per cluster
+gauges: covered slots, slots of failed masters, open migrations, masters without replicas, config epoch collisions
+and unreachable nodes. Every metric has a cluster label, which is the profile name or the seed argument.`,
+	Args:    cobra.MinimumNArgs(1),
+	Example: fmt.Sprintf("%s serve metrics --listen :9121 <profile|seed-node> [<profile|seed-node> ...]", vars.AppName),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return serveMetrics(args)
+	},
+}
+
+func InitMetrics() {
+	MetricsCmd.Flags().StringVar(&metricsListen, "listen", ":9121", "listen addr of the metrics server")
+	MetricsCmd.Flags().DurationVarP(&metricsInterval, "interval", "i", time.Second*30, "time between two collections of all clusters")
+}
+
+// sample is a sample of a metric family
+type sample struct {
+	Name   string
+	Labels [][2]string
+	Value  float64
+}
+
+// metricsStore keeps the latest samples of every cluster
+type metricsStore struct {
+	mu      sync.RWMutex
+	samples map[string][]sample // by cluster
+}
+
+func serveMetrics(args []string) error {
+	if err := activateAll(args); err != nil {
+		return err
+	}
+	store := &metricsStore{samples: make(map[string][]sample)}
+	go func() {
+		for {
+			for _, arg := range args {
+				samples := collectCluster(arg)
+				store.mu.Lock()
+				store.samples[arg] = samples
+				store.mu.Unlock()
+			}
+			time.Sleep(metricsInterval)
+		}
+	}()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, req *http.Request) {
+		store.mu.RLock()
+		var samples []sample
+		for _, arg := range args {
+			samples = append(samples, store.samples[arg]...)
+		}
+		store.mu.RUnlock()
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writeMetrics(w, samples)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprintf(w, "%s metrics of %s, see /metrics\n", vars.AppName, strings.Join(args, ", "))
+	})
+	log.Printf("serving metrics of %s on %s/metrics", strings.Join(args, ", "), metricsListen)
+	// samples are served from memory, the cluster is never waited for
+	return newHTTPServer(metricsListen, mux, time.Second*30).ListenAndServe()
+}
+
+// collectCluster collects the samples of the cluster arg, it never fails: rcm_scrape_success is 0 on errors
+func collectCluster(arg string) []sample {
+	start := time.Now()
+	clusterLabel := [2]string{"cluster", arg}
+	samples, err := func() ([]sample, error) {
+		if err := clusters.acquire(arg); err != nil {
+			return nil, err
+		}
+		defer clusters.release()
+		return collectClusterSamples(config.ResolveSeed(arg), clusterLabel)
+	}()
+	success := 1.0
+	if err != nil {
+		log.Printf("failed to collect %s: %v", arg, err)
+		success = 0
+	}
+	return append([]sample{
+		{Name: "rcm_scrape_success", Labels: [][2]string{clusterLabel}, Value: success},
+		{Name: "rcm_scrape_duration_seconds", Labels: [][2]string{clusterLabel}, Value: time.Since(start).Seconds()},
+	}, samples...)
+}
+
+func collectClusterSamples(seeds string, clusterLabel [2]string) ([]sample, error) {
+	seedNode, _, err := r.NewSeedInstance(seeds)
+	if err != nil {
+		return nil, err
+	}
+	defer seedNode.Close()
+	if !seedNode.ClusterEnabled {
+		return nil, fmt.Errorf("seed node %s is not a cluster node", seedNode.Addr)
+	}
+	nodes, err := r.GetClusterNodes(seedNode.Client)
+	if err != nil {
+		return nil, err
+	}
+	instances, errs := r.NewClusterInstances(r.ClusterNodesInfo(nodes))
+	defer r.CloseInstances(instances)
+
+	// open slots are only reported by the migrating/importing node itself
+	var (
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+		openSlots []string
+	)
+	for _, i := range instances {
+		wg.Add(1)
+		go func(i *r.Instance) {
+			defer wg.Done()
+			nodes, err := r.GetClusterNodes(i.Client)
+			if err != nil {
+				return
+			}
+			for _, n := range nodes {
+				if n.HasFlag("myself") {
+					mu.Lock()
+					openSlots = append(openSlots, n.OpenSlots...)
+					mu.Unlock()
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	gauges := newClusterGauges(nodes, openSlots)
+	labels := [][2]string{clusterLabel}
+	samples := []sample{
+		{Name: "rcm_cluster_nodes", Labels: labels, Value: float64(len(nodes))},
+		{Name: "rcm_cluster_masters", Labels: labels, Value: float64(gauges.Masters)},
+		{Name: "rcm_cluster_slots_covered", Labels: labels, Value: float64(gauges.SlotsCovered)},
+		{Name: "rcm_cluster_slots_fail", Labels: labels, Value: float64(gauges.SlotsFail)},
+		{Name: "rcm_cluster_slots_pfail", Labels: labels, Value: float64(gauges.SlotsPFail)},
+		{Name: "rcm_cluster_open_migrations", Labels: labels, Value: float64(gauges.OpenMigrations)},
+		{Name: "rcm_cluster_masters_without_replicas", Labels: labels, Value: float64(gauges.MastersWithoutReplicas)},
+		{Name: "rcm_cluster_config_epoch_collisions", Labels: labels, Value: float64(gauges.EpochCollisions)},
+		{Name: "rcm_cluster_unreachable_nodes", Labels: labels, Value: float64(len(errs))},
+	}
+
+	byNodeID := make(map[string]*r.Instance)
+	for _, i := range instances {
+		byNodeID[i.NodeID] = i
+	}
+	sort.Sort(r.InstancesAscByAddr(instances))
+	for _, i := range instances {
+		labels := [][2]string{clusterLabel, {"addr", i.Addr}, {"node_id", i.NodeID}}
+		add := func(name string, value float64) {
+			samples = append(samples, sample{Name: name, Labels: labels, Value: value})
+		}
+		add("rcm_node_up", 1)
+		if i.LoadingError {
+			continue
+		}
+		samples = append(samples, sample{Name: "rcm_node_role", Labels: append(labels[:3:3], [2]string{"role", i.Role}), Value: 1})
+		add("rcm_node_used_memory_bytes", r.InfoFloat(i.Info, "used_memory"))
+		add("rcm_node_maxmemory_bytes", float64(i.MaxMemoryBytes))
+		add("rcm_node_connected_clients", float64(i.ClientsCount))
+		add("rcm_node_maxclients", float64(i.MaxClients))
+		add("rcm_node_keys", float64(r.SumKeys(i.Info)))
+		add("rcm_node_ops_per_second", r.InfoFloat(i.Info, "instantaneous_ops_per_sec"))
+		if master := byNodeID[i.MasterID]; i.Role == "slave" && master != nil && !master.LoadingError {
+			add("rcm_node_replication_lag_bytes", float64(i.ReplLag(master)))
+		}
+	}
+	var unreachable []string
+	for nodeInfo := range errs {
+		unreachable = append(unreachable, nodeInfo)
+	}
+	sort.Strings(unreachable)
+	for _, nodeInfo := range unreachable {
+		n := strings.Split(nodeInfo, ",")
+		samples = append(samples, sample{Name: "rcm_node_up",
+			Labels: [][2]string{clusterLabel, {"addr", n[0]}, {"node_id", n[1]}}, Value: 0})
+	}
+	return samples, nil
+}
+
+// clusterGauges are the cluster level gauges computed from `cluster nodes` of the seed node
+type clusterGauges struct {
+	Masters                int
+	SlotsCovered           int
+	SlotsFail              int
+	SlotsPFail             int
+	OpenMigrations         int
+	MastersWithoutReplicas int
+	EpochCollisions        int
+}
+
+// newClusterGauges computes the cluster gauges from nodes, openSlots are the open slots reported by every node
+// for itself: "[slot->-nodeID]" or "[slot-<-nodeID]"
+func newClusterGauges(nodes []*r.ClusterNode, openSlots []string) clusterGauges {
+	var g clusterGauges
+	covered := make([]bool, r.ClusterSlots)
+	replicas := make(map[string]int)
+	for _, n := range nodes {
+		if n.Role == "slave" && !n.HasFlag("fail") && !n.HasFlag("fail?") {
+			replicas[n.MasterID]++
+		}
+	}
+	epochs := make(map[int64]int)
+	for _, n := range nodes {
+		if n.Role != "master" || n.GetSlotCount() == 0 {
+			continue
+		}
+		g.Masters++
+		for _, slots := range n.Slots {
+			for slot := slots.Start; slot <= slots.End && slot < r.ClusterSlots; slot++ {
+				if !covered[slot] {
+					covered[slot] = true
+					g.SlotsCovered++
+				}
+			}
+		}
+		if n.HasFlag("fail") {
+			g.SlotsFail += n.GetSlotCount()
+		} else if n.HasFlag("fail?") {
+			g.SlotsPFail += n.GetSlotCount()
+		}
+		if replicas[n.NodeID] == 0 {
+			g.MastersWithoutReplicas++
+		}
+		if n.ConfigEpoch > 0 {
+			epochs[n.ConfigEpoch]++
+		}
+	}
+	for _, count := range epochs {
+		if count > 1 {
+			g.EpochCollisions++
+		}
+	}
+	open := make(map[string]bool)
+	for _, s := range openSlots {
+		slot, _, _ := strings.Cut(strings.TrimPrefix(s, "["), "-")
+		open[slot] = true
+	}
+	g.OpenMigrations = len(open)
+	return g
+}
+
+// writeMetrics writes samples in the Prometheus text format, grouped by family in the order of metricHelps
+func writeMetrics(w io.Writer, samples []sample) {
+	byName := make(map[string][]sample)
+	for _, s := range samples {
+		byName[s.Name] = append(byName[s.Name], s)
+	}
+	for _, m := range metricHelps {
+		if len(byName[m.Name]) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", m.Name, m.Help, m.Name)
+		for _, s := range byName[m.Name] {
+			var labels []string
+			for _, l := range s.Labels {
+				labels = append(labels, fmt.Sprintf("%s=\"%s\"", l[0], escapeLabel(l[1])))
+			}
+			fmt.Fprintf(w, "%s{%s} %s\n", s.Name, strings.Join(labels, ","), strconv.FormatFloat(s.Value, 'g', -1, 64))
+		}
+	}
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
@@ -0,0 +1,53 @@
+package serve
+
+import (
+	"bytes"
+	r "redis-cluster-manager/redis"
+	"testing"
+)
+
+func TestNewClusterGauges(t *testing.T) {
+	nodes := []*r.ClusterNode{
+		{NodeID: "m1", Role: "master", Flags: []string{"master"}, ConfigEpoch: 1,
+			Slots: []*r.SlotRange{{Start: 0, End: 5460, SlotCount: 5461}}},
+		{NodeID: "m2", Role: "master", Flags: []string{"master", "fail?"}, ConfigEpoch: 2,
+			Slots: []*r.SlotRange{{Start: 5461, End: 10922, SlotCount: 5462}}},
+		{NodeID: "m3", Role: "master", Flags: []string{"master", "fail"}, ConfigEpoch: 2,
+			Slots: []*r.SlotRange{{Start: 10923, End: 16000, SlotCount: 5078}}},
+		{NodeID: "m4", Role: "master", Flags: []string{"master"}, ConfigEpoch: 4},
+		{NodeID: "s1", Role: "slave", MasterID: "m1", Flags: []string{"slave"}, ConfigEpoch: 1},
+		{NodeID: "s2", Role: "slave", MasterID: "m2", Flags: []string{"slave", "fail"}, ConfigEpoch: 2},
+	}
+	g := newClusterGauges(nodes, []string{"[100->-m2]", "[100-<-m1]", "[200-<-m1]"})
+	expected := clusterGauges{Masters: 3, SlotsCovered: 16001, SlotsFail: 5078, SlotsPFail: 5462, OpenMigrations: 2,
+		MastersWithoutReplicas: 2, EpochCollisions: 1}
+	if g != expected {
+		t.Fatalf("newClusterGauges() = %+v, want %+v", g, expected)
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	cluster := [2]string{"cluster", `prod"1`}
+	samples := []sample{
+		{Name: "rcm_node_up", Labels: [][2]string{cluster, {"addr", "10.0.0.1:6379"}}, Value: 1},
+		{Name: "rcm_scrape_success", Labels: [][2]string{cluster}, Value: 1},
+		{Name: "rcm_node_up", Labels: [][2]string{cluster, {"addr", "10.0.0.2:6379"}}, Value: 0},
+		{Name: "rcm_scrape_duration_seconds", Labels: [][2]string{cluster}, Value: 0.25},
+	}
+	var b bytes.Buffer
+	writeMetrics(&b, samples)
+	expected := `# HELP rcm_scrape_success 1 if the cluster was collected, 0 if the seed nodes are not usable
+# TYPE rcm_scrape_success gauge
+rcm_scrape_success{cluster="prod\"1"} 1
+# HELP rcm_scrape_duration_seconds time spent collecting the cluster
+# TYPE rcm_scrape_duration_seconds gauge
+rcm_scrape_duration_seconds{cluster="prod\"1"} 0.25
+# HELP rcm_node_up 1 if the node can be connected
+# TYPE rcm_node_up gauge
+rcm_node_up{cluster="prod\"1",addr="10.0.0.1:6379"} 1
+rcm_node_up{cluster="prod\"1",addr="10.0.0.2:6379"} 0
+`
+	if b.String() != expected {
+		t.Fatalf("writeMetrics() =\n%s\nwant\n%s", b.String(), expected)
+	}
+}
@@ -0,0 +1,85 @@
+package serve
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Activate switches the connection settings (credentials, TLS, address translation and policy) to the cluster
+// given by a profile name or seed nodes, it's set by the serve root cmd. the settings are global, so clusters
+// are only accessed while holding clusters, see clusterLock
+var Activate func(arg string) error
+
+// clusters guards the connection settings shared by all served clusters
+var clusters = newClusterLock()
+
+// clusterLock lets goroutines working on the same cluster run together, goroutines of other clusters wait
+// until the active cluster has no user anymore
+type clusterLock struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	active string
+	users  int
+}
+
+func newClusterLock() *clusterLock {
+	l := &clusterLock{}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// acquire waits until arg is the active cluster, activating it if no cluster is in use
+func (l *clusterLock) acquire(arg string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for l.users > 0 && l.active != arg {
+		l.cond.Wait()
+	}
+	if l.users == 0 && l.active != arg {
+		if err := Activate(arg); err != nil {
+			// the settings may be half switched, activate again next time
+			l.active = ""
+			l.cond.Broadcast()
+			return fmt.Errorf("failed to activate %s: %v", arg, err)
+		}
+		l.active = arg
+	}
+	l.users++
+	return nil
+}
+
+func (l *clusterLock) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.users--
+	if l.users == 0 {
+		l.cond.Broadcast()
+	}
+}
+
+// activateAll activates every cluster once, so that bad profiles fail at startup and passwords are prompted for
+// before serving
+func activateAll(args []string) error {
+	for _, arg := range args {
+		if err := clusters.acquire(arg); err != nil {
+			return err
+		}
+		clusters.release()
+	}
+	return nil
+}
+
+// newHTTPServer returns a server of handler on addr, the timeouts keep slow or idle clients from holding connections.
+// writeTimeout bounds the whole handling of a request, including the work on the cluster
+func newHTTPServer(addr string, handler http.Handler, writeTimeout time.Duration) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: time.Second * 10,
+		ReadTimeout:       time.Second * 30,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       time.Minute * 2,
+	}
+}
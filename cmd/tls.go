@@ -0,0 +1,12 @@
+package cmd
+
+import "redis-cluster-manager/vars"
+
+func initTLS() {
+	rootCmd.PersistentFlags().BoolVar(&vars.Cluster.TLS, "tls", false, "connect to data nodes and sentinels with TLS")
+	rootCmd.PersistentFlags().StringVar(&vars.Cluster.TLSCACert, "cacert", "", "CA certificate file to verify servers, system roots if not set")
+	rootCmd.PersistentFlags().StringVar(&vars.Cluster.TLSCert, "cert", "", "client certificate file for mutual TLS")
+	rootCmd.PersistentFlags().StringVar(&vars.Cluster.TLSKey, "key", "", "private key file of the client certificate")
+	rootCmd.PersistentFlags().StringVar(&vars.Cluster.TLSServerName, "sni", "", "server name for SNI and certificate verification, host of the node addr if not set")
+	rootCmd.PersistentFlags().BoolVar(&vars.Cluster.TLSInsecure, "insecure", false, "skip verification of server certificates")
+}
@@ -0,0 +1,11 @@
+package cmd
+
+import (
+	"redis-cluster-manager/cmd/subcmd/cluster"
+)
+
+// the dashboard lives in the cluster package to share it's topology discovery and exec machinery
+func initUI() {
+	cluster.InitUI()
+	rootCmd.AddCommand(cluster.UICmd)
+}
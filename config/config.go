@@ -0,0 +1,166 @@
+package config
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"net"
+	"os"
+	"path/filepath"
+	"redis-cluster-manager/vars"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Config is the content of the config file: named cluster profiles
+type Config struct {
+	Profiles map[string]*Profile `yaml:"profiles"`
+}
+
+// Profile holds the settings of a cluster, command line flags take precedence over them
+type Profile struct {
+	Seeds           []string      `yaml:"seeds"` // seed nodes, several seeds for fallback
+	User            string        `yaml:"user"`
+	PasswordEnv     string        `yaml:"password-env"`  // environment variable holding the password
+	PasswordFile    string        `yaml:"password-file"` // file holding the password
+	AskPassword     bool          `yaml:"ask-password"`
+	CredentialsFile string        `yaml:"credentials-file"`
+	Timeout         time.Duration `yaml:"timeout"`
+	MasterName      string        `yaml:"master-name"`   // master name monitored by sentinels
+	SentinelUser    string        `yaml:"sentinel-user"` // ACL username of sentinels
+	TLS             TLS           `yaml:"tls"`
+	NAT             NAT           `yaml:"nat"`
+	Policy          Policy        `yaml:"policy"`
+}
+
+// TLS is the TLS settings of a profile, see the --tls flags
+type TLS struct {
+	Enabled  bool   `yaml:"enabled"`
+	CACert   string `yaml:"cacert"`
+	Cert     string `yaml:"cert"`
+	Key      string `yaml:"key"`
+	SNI      string `yaml:"sni"`
+	Insecure bool   `yaml:"insecure"`
+}
+
+// NAT is the address translation of a profile, see the --addr-map flags
+type NAT struct {
+	AddrMap     map[string]string `yaml:"addr-map"`     // announced ip:port or ip -> reachable ip:port or ip
+	CIDRMap     map[string]string `yaml:"cidr-map"`     // announced cidr -> reachable cidr
+	UseHostname bool              `yaml:"use-hostname"` // dial the announced hostname
+}
+
+// Pairs returns m as sorted "<key>=<value>" pairs
+func Pairs(m map[string]string) []string {
+	var pairs []string
+	for k, v := range m {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return pairs
+}
+
+// Policy restricts what rcm is allowed to do on a cluster
+type Policy struct {
+	ReadOnly          bool     `yaml:"read-only"`          // refuse failovers, moves, restarts and write commands
+	ForbiddenCommands []string `yaml:"forbidden-commands"` // commands forbidden to exec besides vars.ForbiddenCmds
+	APIMutations      []string `yaml:"api-mutations"`      // mutating endpoints enabled in `serve api`: exec, failover
+}
+
+// the profile resolved from the seed argument, nil if the seed argument is an addr
+var (
+	ActiveName string
+	Active     *Profile
+)
+
+// DefaultPath returns $XDG_CONFIG_HOME/rcm/config.yaml, or ~/.config/rcm/config.yaml
+func DefaultPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, vars.AppName, "config.yaml")
+}
+
+// Load reads and validates the config file at path
+func Load(path string) (*Config, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+	cfg := &Config{}
+	if err := yaml.Unmarshal(content, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+	for name, p := range cfg.Profiles {
+		if p == nil || len(p.Seeds) == 0 {
+			return nil, fmt.Errorf("profile %s in %s has no seeds", name, path)
+		}
+	}
+	return cfg, nil
+}
+
+// ResolveSeed returns the comma separated seeds of the active profile if arg is it's name, otherwise arg itself
+func ResolveSeed(arg string) string {
+	if Active == nil || arg != ActiveName {
+		return arg
+	}
+	return strings.Join(Active.Seeds, ",")
+}
+
+// IsSeedList reports whether arg is a comma separated list of host:port seeds
+func IsSeedList(arg string) bool {
+	for _, seed := range strings.Split(arg, ",") {
+		if _, port, err := net.SplitHostPort(strings.TrimSpace(seed)); err != nil || port == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// ReadOnly reports whether the active profile is read-only
+func ReadOnly() bool {
+	return Active != nil && Active.Policy.ReadOnly
+}
+
+// CheckWritable returns an error if the active profile is read-only, action is what is going to be done
+func CheckWritable(action string) error {
+	if ReadOnly() {
+		return fmt.Errorf("%s is refused by the read-only policy of profile %s", action, ActiveName)
+	}
+	return nil
+}
+
+// AllowsAPIMutation reports whether the active profile enables the mutating endpoint of `serve api`,
+// they are disabled without a profile
+func AllowsAPIMutation(endpoint string) bool {
+	if Active == nil {
+		return false
+	}
+	for _, e := range Active.Policy.APIMutations {
+		if strings.EqualFold(e, endpoint) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsForbidden reports whether the command is forbidden to exec by vars.ForbiddenCmds or the active profile
+func IsForbidden(command string) bool {
+	command = strings.ToUpper(command)
+	if _, exists := vars.ForbiddenCmds[command]; exists {
+		return true
+	}
+	if Active != nil {
+		for _, c := range Active.Policy.ForbiddenCommands {
+			if strings.ToUpper(c) == command {
+				return true
+			}
+		}
+	}
+	return false
+}
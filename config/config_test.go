@@ -0,0 +1,102 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := `profiles:
+  prod-cache:
+    seeds: ["10.0.0.1:6379", "10.0.0.2:6379"]
+    user: ops
+    password-env: PROD_CACHE_PASS
+    timeout: 5s
+    sentinel-user: sentinel-ops
+    tls:
+      enabled: true
+      cacert: /etc/rcm/ca.crt
+    policy:
+      read-only: true
+      forbidden-commands: [keys, config]
+`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	p := cfg.Profiles["prod-cache"]
+	if p == nil || len(p.Seeds) != 2 || p.User != "ops" || p.PasswordEnv != "PROD_CACHE_PASS" ||
+		p.Timeout != 5*time.Second || p.SentinelUser != "sentinel-ops" || !p.TLS.Enabled || p.TLS.CACert != "/etc/rcm/ca.crt" || !p.Policy.ReadOnly {
+		t.Fatalf("unexpected profile: %+v", p)
+	}
+
+	if err := os.WriteFile(path, []byte("profiles:\n  empty:\n    user: ops\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Fatal("Load() should fail on a profile without seeds")
+	}
+}
+
+func TestActiveProfile(t *testing.T) {
+	defer func() { ActiveName, Active = "", nil }()
+	if ResolveSeed("prod-cache") != "prod-cache" || CheckWritable("failover") != nil || IsForbidden("KEYS") {
+		t.Fatal("no profile is active, nothing should be changed")
+	}
+	if !IsForbidden("flushall") {
+		t.Fatal("flushall is always forbidden")
+	}
+	ActiveName, Active = "prod-cache", &Profile{
+		Seeds:  []string{"10.0.0.1:6379", "10.0.0.2:6379"},
+		Policy: Policy{ReadOnly: true, ForbiddenCommands: []string{"keys"}},
+	}
+	if seed := ResolveSeed("prod-cache"); seed != "10.0.0.1:6379,10.0.0.2:6379" {
+		t.Fatalf("ResolveSeed(prod-cache) = %s", seed)
+	}
+	if seed := ResolveSeed("10.0.0.3:6379"); seed != "10.0.0.3:6379" {
+		t.Fatalf("ResolveSeed(10.0.0.3:6379) = %s", seed)
+	}
+	if CheckWritable("failover") == nil {
+		t.Fatal("CheckWritable() should fail on a read-only profile")
+	}
+	if !IsForbidden("KEYS") {
+		t.Fatal("KEYS is forbidden by the profile")
+	}
+	if AllowsAPIMutation("exec") {
+		t.Fatal("api mutations are disabled unless listed")
+	}
+	Active.Policy.APIMutations = []string{"Failover"}
+	if !AllowsAPIMutation("failover") || AllowsAPIMutation("exec") {
+		t.Fatal("only failover is enabled")
+	}
+}
+
+func TestIsSeedList(t *testing.T) {
+	tests := []struct {
+		arg  string
+		want bool
+	}{
+		{arg: "10.0.0.1:6379", want: true},
+		{arg: "10.0.0.1:6379, 10.0.0.2:6379", want: true},
+		{arg: "redis-1.example.com:6379", want: true},
+		{arg: "[::1]:6379", want: true},
+		{arg: "prod-cache", want: false},
+		{arg: "10.0.0.1", want: false},
+		{arg: "10.0.0.1:6379,prod-cache", want: false},
+		{arg: "10.0.0.1:", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			if got := IsSeedList(tt.arg); got != tt.want {
+				t.Fatalf("IsSeedList(%q) = %v, want %v", tt.arg, got, tt.want)
+			}
+		})
+	}
+}
@@ -7,6 +7,8 @@ require (
 	github.com/mitchellh/mapstructure v1.5.0
 	github.com/redis/go-redis/v9 v9.11.0
 	github.com/spf13/cobra v1.9.1
+	golang.org/x/term v0.24.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
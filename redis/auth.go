@@ -0,0 +1,55 @@
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"redis-cluster-manager/vars"
+	"strings"
+)
+
+// noUsername in a credentials file means to AUTH with password only, for redis before 6.0 without ACL
+const noUsername = "-"
+
+// LoadCredentials reads "<addr|ip> <username> <password>" lines from path, # for comments
+func LoadCredentials(path string) (map[string]vars.Credential, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open credentials file: %v", err)
+	}
+	defer f.Close()
+	credentials := make(map[string]vars.Credential)
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			// the password is not printed
+			return nil, fmt.Errorf("invalid credentials file line %d: expect \"<addr|ip> <username> <password>\"", lineNo)
+		}
+		username := fields[1]
+		if username == noUsername {
+			username = ""
+		}
+		credentials[fields[0]] = vars.Credential{Username: username, Password: fields[2]}
+	}
+	return credentials, scanner.Err()
+}
+
+// credentialOf returns the credential of hostPort in vars.Cluster.Credentials matched by addr first and then by host,
+// or the global --user/--password if not found
+func credentialOf(hostPort string) vars.Credential {
+	if c, ok := vars.Cluster.Credentials[hostPort]; ok {
+		return c
+	}
+	if host, _, err := net.SplitHostPort(hostPort); err == nil {
+		if c, ok := vars.Cluster.Credentials[host]; ok {
+			return c
+		}
+	}
+	return vars.Credential{Username: vars.Cluster.Username, Password: vars.Cluster.Password}
+}
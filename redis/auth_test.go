@@ -0,0 +1,52 @@
+package redis
+
+import (
+	"os"
+	"path/filepath"
+	"redis-cluster-manager/vars"
+	"testing"
+)
+
+func TestLoadCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials")
+	content := "# addr or ip, username, password\n1.1.1.1:6379 admin p1\n\n1.1.1.2 - p2\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	credentials, err := LoadCredentials(path)
+	if err != nil {
+		t.Fatalf("LoadCredentials() error = %v", err)
+	}
+	if c := credentials["1.1.1.1:6379"]; c.Username != "admin" || c.Password != "p1" {
+		t.Fatalf("credential of 1.1.1.1:6379 = %+v", c)
+	}
+	if c := credentials["1.1.1.2"]; c.Username != "" || c.Password != "p2" {
+		t.Fatalf("credential of 1.1.1.2 = %+v", c)
+	}
+
+	if err := os.WriteFile(path, []byte("1.1.1.1:6379 p1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadCredentials(path); err == nil {
+		t.Fatal("LoadCredentials() should fail on a line without username")
+	}
+}
+
+func TestCredentialOf(t *testing.T) {
+	vars.Cluster.Username, vars.Cluster.Password = "ops", "global"
+	vars.Cluster.Credentials = map[string]vars.Credential{
+		"1.1.1.1:6379": {Username: "admin", Password: "p1"},
+		"1.1.1.1":      {Password: "p2"},
+	}
+	defer func() { vars.Cluster.Username, vars.Cluster.Password, vars.Cluster.Credentials = "", "", nil }()
+	tests := map[string]vars.Credential{
+		"1.1.1.1:6379": {Username: "admin", Password: "p1"},
+		"1.1.1.1:6380": {Password: "p2"},
+		"1.1.1.2:6379": {Username: "ops", Password: "global"},
+	}
+	for addr, expected := range tests {
+		if c := credentialOf(addr); c != expected {
+			t.Errorf("credentialOf(%s) = %+v, expected %+v", addr, c, expected)
+		}
+	}
+}
@@ -8,14 +8,17 @@ import (
 )
 
 func newRedisClient(hostPort string) (*redis.Client, error) {
+	credential := credentialOf(hostPort)
 	opt := redis.Options{
-		Addr:         hostPort,
-		Password:     vars.Password,
+		Addr:         DialAddr(hostPort),
+		Username:     credential.Username,
+		Password:     credential.Password,
 		PoolSize:     3,
 		MinIdleConns: 3,
-		DialTimeout:  vars.Timeout,
-		ReadTimeout:  vars.Timeout,
-		WriteTimeout: vars.Timeout,
+		DialTimeout:  vars.Cluster.Timeout,
+		ReadTimeout:  vars.Cluster.Timeout,
+		WriteTimeout: vars.Cluster.Timeout,
+		TLSConfig:    tlsConfig,
 	}
 	client := redis.NewClient(&opt)
 	pingResult, err := client.Ping(context.Background()).Result()
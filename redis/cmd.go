@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"github.com/redis/go-redis/v9"
+	"math"
+	"strconv"
 	"strings"
 )
 
@@ -26,37 +28,40 @@ func ParseInfo(client *redis.Client, section string) (map[string]string, error)
 }
 
 // ParseClusterNodes parses the Redis `cluster nodes` command output and returns a slice of
-// slice(nodeID, addr, slots, role, masterID)
+// slice(nodeID, addr, slots, role, masterID), see GetClusterNodes and ClusterNodesInfo
 func ParseClusterNodes(client *redis.Client) ([][]string, error) {
-	var nodes [][]string
-	cmdOutput, err := client.ClusterNodes(context.Background()).Result()
+	nodes, err := GetClusterNodes(client)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get cluster nodes: %v", err)
+		return nil, err
 	}
-	lines := strings.Split(cmdOutput, "\n")
-	for _, line := range lines {
-		if len(strings.TrimSpace(line)) == 0 {
-			continue
-		}
-		parts := strings.Split(line, " ")
-		if len(parts) < 8 {
-			return nil, fmt.Errorf("invalid cluster nodes line: %s", line)
+	return ClusterNodesInfo(nodes), nil
+}
+
+// ClusterNodesInfo converts nodes parsed by GetClusterNodes to the ParseClusterNodes output:
+// slots are "0-5460 5462", masterID is "-" for masters, open slots are left out
+func ClusterNodesInfo(nodes []*ClusterNode) [][]string {
+	var clusterNodesInfo [][]string
+	for _, n := range nodes {
+		masterID := n.MasterID
+		if masterID == "" {
+			masterID = "-"
 		}
-		nodeID := parts[0]
-		addr := strings.Split(parts[1], "@")[0]
-		flags := strings.Split(parts[2], ",")
-		role := ""
-		for _, flag := range flags {
-			if flag == "master" || flag == "slave" {
-				role = flag
-				break
-			}
+		clusterNodesInfo = append(clusterNodesInfo, []string{n.NodeID, n.Addr, formatNodeSlots(n.Slots), n.Role, masterID})
+	}
+	return clusterNodesInfo
+}
+
+// formatNodeSlots formats slot ranges like `cluster nodes` does: "0-5460 5462"
+func formatNodeSlots(slotRanges []*SlotRange) string {
+	var slots []string
+	for _, slotRange := range slotRanges {
+		if slotRange.Start == slotRange.End {
+			slots = append(slots, strconv.Itoa(slotRange.Start))
+		} else {
+			slots = append(slots, fmt.Sprintf("%d-%d", slotRange.Start, slotRange.End))
 		}
-		masterID := parts[3]
-		slots := strings.Join(parts[8:], " ")
-		nodes = append(nodes, []string{nodeID, addr, slots, role, masterID})
 	}
-	return nodes, nil
+	return strings.Join(slots, " ")
 }
 
 // ParseClientList parses the Redis `client list` command output and returns []map[string]string
@@ -107,3 +112,67 @@ func ParseClusterInfo(client *redis.Client) (map[string]string, error) {
 	}
 	return result, nil
 }
+
+// SumKeys sums the keys of all databases in info: "db0" => "keys=1,expires=0,avg_ttl=0"
+func SumKeys(info map[string]string) int64 {
+	var count int64
+	for key, value := range info {
+		if !strings.HasPrefix(key, "db") {
+			continue
+		}
+		if _, err := strconv.Atoi(key[2:]); err != nil {
+			continue
+		}
+		for _, field := range strings.Split(value, ",") {
+			if k, v, found := strings.Cut(field, "="); found && k == "keys" {
+				n, _ := strconv.ParseInt(v, 10, 64)
+				count += n
+			}
+		}
+	}
+	return count
+}
+
+// InfoFloat returns the numeric value of key in info, 0 if it's missing or not a number
+func InfoFloat(info map[string]string, key string) float64 {
+	v, _ := strconv.ParseFloat(info[key], 64)
+	return v
+}
+
+// FormatBytes formats n bytes with a binary unit: 512B, 1.5KB, 2.0GB
+func FormatBytes(n float64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	unit := 0
+	for math.Abs(n) >= 1024 && unit < len(units)-1 {
+		n /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%.0f%s", n, units[0])
+	}
+	return fmt.Sprintf("%.1f%s", n, units[unit])
+}
+
+// CommandFlags returns the flags of `command info` for args[0], or for it's subcommand args[0]|args[1] on redis 7+
+func CommandFlags(client *redis.Client, args []string) ([]string, error) {
+	names := []string{args[0]}
+	if len(args) > 1 {
+		names = append([]string{args[0] + "|" + args[1]}, names...)
+	}
+	for _, name := range names {
+		cmd := redis.NewCommandsInfoCmd(context.Background(), "command", "info", strings.ToLower(name))
+		_ = client.Process(context.Background(), cmd)
+		infos, err := cmd.Result()
+		if err == redis.Nil {
+			// unknown command or subcommand
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get command info of %s: %v", name, err)
+		}
+		for _, info := range infos {
+			return info.Flags, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown command %s", args[0])
+}
@@ -7,7 +7,7 @@ import (
 )
 
 func TestCmd(t *testing.T) {
-	vars.Password = "redis"
+	vars.Cluster.Password = "redis"
 	client, err := newRedisClient("127.0.0.1:6379")
 	if err != nil {
 		fmt.Println(err)
@@ -20,3 +20,15 @@ func TestCmd(t *testing.T) {
 	}
 	fmt.Println(clusterInfo["cluster_state"])
 }
+
+func TestSumKeys(t *testing.T) {
+	info := map[string]string{
+		"db0":       "keys=10,expires=1,avg_ttl=0",
+		"db3":       "keys=5,expires=0,avg_ttl=0",
+		"dbsize":    "keys=100",
+		"used_keys": "7",
+	}
+	if count := SumKeys(info); count != 15 {
+		t.Fatalf("SumKeys() = %d, want 15", count)
+	}
+}
@@ -4,8 +4,8 @@ import (
 	"fmt"
 	"github.com/mitchellh/mapstructure"
 	"github.com/redis/go-redis/v9"
+	"net"
 	"strconv"
-	"strings"
 )
 
 // Connection: redis: `client list` command parser
@@ -33,15 +33,15 @@ func NewConnections(client *redis.Client) ([]*Connection, error) {
 	return connections, nil
 }
 
+// GetHostPort splits Addr of ip:port, [ipv6]:port or hostname:port
 func (c *Connection) GetHostPort() (string, int, error) {
-	hostPort := strings.Split(c.Addr, ":")
-	if len(hostPort) != 2 {
+	host, portStr, err := net.SplitHostPort(c.Addr)
+	if err != nil {
 		return "", 0, fmt.Errorf("invalid addr format: %s", c.Addr)
 	}
-	host := hostPort[0]
-	port, err := strconv.Atoi(hostPort[1])
+	port, err := strconv.Atoi(portStr)
 	if err != nil {
-		return "", 0, fmt.Errorf("invalid port format: %s", hostPort[1])
+		return "", 0, fmt.Errorf("invalid port format: %s", portStr)
 	}
 	return host, port, nil
 }
@@ -7,7 +7,7 @@ import (
 )
 
 func TestNewConnection(t *testing.T) {
-	vars.Password = "redis"
+	vars.Cluster.Password = "redis"
 	client, err := newRedisClient("127.0.0.1:6379")
 	if err != nil {
 		t.Skipf("skip live Redis test: %v", err)
@@ -20,3 +20,20 @@ func TestNewConnection(t *testing.T) {
 		fmt.Println(conn.Id, conn.Addr, conn.Flags, conn.Cmd)
 	}
 }
+
+func TestGetHostPort(t *testing.T) {
+	tests := map[string]string{
+		"10.0.0.1:52311":          "10.0.0.1",
+		"[2001:db8::1]:52311":     "2001:db8::1",
+		"redis-0.svc.local:52311": "redis-0.svc.local",
+	}
+	for addr, expected := range tests {
+		host, port, err := (&Connection{Addr: addr}).GetHostPort()
+		if err != nil || host != expected || port != 52311 {
+			t.Errorf("GetHostPort(%s) = %s, %d, %v", addr, host, port, err)
+		}
+	}
+	if _, _, err := (&Connection{Addr: "2001:db8::1:52311"}).GetHostPort(); err == nil {
+		t.Error("GetHostPort() should fail on an unbracketed ipv6 addr")
+	}
+}
@@ -7,3 +7,9 @@ const loadingErrorMessage = "LOADING Redis is loading the dataset in memory"
 func IsLoadingError(err error) bool {
 	return err != nil && strings.Contains(err.Error(), loadingErrorMessage)
 }
+
+// isUnknownCommand reports whether err is returned for a command or subcommand not supported by the server
+func isUnknownCommand(err error) bool {
+	return err != nil && (strings.HasPrefix(err.Error(), "ERR unknown command") ||
+		strings.HasPrefix(err.Error(), "ERR unknown subcommand"))
+}
@@ -0,0 +1,67 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// roleCheckInterval is the interval between two role checks while waiting for a role change
+const roleCheckInterval = 200 * time.Millisecond
+
+// Failover runs `cluster failover` on slave i and waits until it has been promoted to master
+func (i *Instance) Failover(timeout time.Duration) error {
+	if i.Role != "slave" {
+		return fmt.Errorf("failover must be run on a slave, %s is a %s", i.Addr, i.Role)
+	}
+	if err := i.Client.ClusterFailover(context.Background()).Err(); err != nil {
+		return fmt.Errorf("failed to run cluster failover on %s: %v", i.Addr, err)
+	}
+	if err := i.WaitForRole("master", timeout); err != nil {
+		return err
+	}
+	i.Master, i.MasterID = "", ""
+	i.SlaveInit = false
+	return nil
+}
+
+// WaitForRole polls `info replication` until the role of i becomes role or timeout reached.
+// MasterID of a cluster node becoming a slave is read from it's own `cluster nodes` line, the master addr of
+// `info replication` may differ from the addr announced in `cluster nodes`, e.g. with hostnames or tls-port
+func (i *Instance) WaitForRole(role string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		replInfo, err := ParseInfo(i.Client, "replication")
+		if err == nil && replInfo["role"] == role {
+			i.Role = role
+			if role != "slave" {
+				return nil
+			}
+			i.Master = net.JoinHostPort(replInfo["master_host"], replInfo["master_port"])
+			if !i.ClusterEnabled {
+				return nil
+			}
+			i.MasterID, err = i.MyMasterID()
+			return err
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s did not become %s in %v", i.Addr, role, timeout)
+		}
+		time.Sleep(roleCheckInterval)
+	}
+}
+
+// MyMasterID returns the master node ID of cluster node i from the myself line of `cluster nodes`, "" if i is a master
+func (i *Instance) MyMasterID() (string, error) {
+	nodes, err := GetClusterNodes(i.Client)
+	if err != nil {
+		return "", err
+	}
+	for _, n := range nodes {
+		if n.HasFlag("myself") {
+			return n.MasterID, nil
+		}
+	}
+	return "", fmt.Errorf("myself not found in cluster nodes of %s", i.Addr)
+}
@@ -4,27 +4,42 @@ import (
 	"fmt"
 	"github.com/redis/go-redis/v9"
 	"math"
+	"net"
 	"net/netip"
 	"strconv"
 	"strings"
 )
 
 type Instance struct {
-	Addr           string
-	Client         *redis.Client
-	NodeID         string       // node ID if this is a cluster instance
-	Role           string       // master or slave
-	SlaveInit      bool         // master_sync_in_progress of a slave
-	Master         string       // master addr if this is a slave, will be "" if this is a master
-	MaxMemory      float64      // maxmemory in GB
-	UsedMemory     float64      // used memory in GB
-	MaxClients     int          // maximum number of clients allowed to connect to this instance
-	ClientsCount   int          // number of clients connected to this instance
-	ClusterEnabled bool         // true if this instance is part of a Redis Cluster
-	LoadingError   bool         // true if Redis returned LOADING while fetching instance info
-	Slots          []*SlotRange // list of SlotRange assigned to this instance
-	KeysCount      string       // number of keys in this instance
-	Version        string       // redis version
+	Addr            string // announced addr, as reported by `cluster nodes` and `info replication`
+	DialAddr        string // addr actually dialed, differs from Addr if translated, see DialAddr
+	Client          *redis.Client
+	NodeID          string            // node ID if this is a cluster instance
+	Role            string            // master or slave
+	SlaveInit       bool              // master_sync_in_progress of a slave
+	Master          string            // master addr if this is a slave, will be "" if this is a master
+	MasterID        string            // master node ID if this is a cluster slave, from `cluster nodes`
+	MaxMemory       float64           // maxmemory in GB
+	UsedMemory      float64           // used memory in GB
+	MaxMemoryBytes  int64             // maxmemory in bytes, 0 if not limited
+	UsedMemoryBytes int64             // used_memory in bytes
+	MaxClients      int               // maximum number of clients allowed to connect to this instance
+	ClientsCount    int               // number of clients connected to this instance
+	ClusterEnabled  bool              // true if this instance is part of a Redis Cluster
+	LoadingError    bool              // true if Redis returned LOADING while fetching instance info
+	Slots           []*SlotRange      // list of SlotRange assigned to this instance
+	KeysCount       string            // number of keys in this instance
+	Version         string            // redis version
+	Info            map[string]string // output of `info all` fetched by init
+
+	// replication info
+	MasterLinkStatus string  // master_link_status of a slave: up or down
+	MasterLastIO     int     // master_last_io_seconds_ago of a slave, -1 if unknown
+	MasterReplOffset int64   // master_repl_offset
+	SlaveReplOffset  int64   // slave_repl_offset of a slave
+	SyncProgress     float64 // percentage of the rdb received during full sync, -1 if unknown
+	ReplBacklogSize  int64   // repl_backlog_size in bytes
+	InputKbps        float64 // instantaneous_input_kbps, used as the write rate
 }
 
 func NewInstance(hostPort string) (*Instance, error) {
@@ -33,8 +48,9 @@ func NewInstance(hostPort string) (*Instance, error) {
 		return nil, err
 	}
 	instance := &Instance{
-		Addr:   hostPort,
-		Client: client,
+		Addr:     hostPort,
+		DialAddr: DialAddr(hostPort),
+		Client:   client,
 	}
 	if err := instance.init(); err != nil {
 		return nil, fmt.Errorf("failed to init instance %s: %v", hostPort, err)
@@ -52,18 +68,20 @@ func (i *Instance) init() error {
 		}
 		return err
 	}
+	i.Info = infoMap
 	i.Role = infoMap["role"]
 	if i.Role == "slave" {
-		i.Master = infoMap["master_host"] + ":" + infoMap["master_port"]
+		i.Master = net.JoinHostPort(infoMap["master_host"], infoMap["master_port"])
 		if infoMap["master_sync_in_progress"] == "1" {
 			i.SlaveInit = true
 		}
 	}
+	i.initReplication(infoMap)
 
-	maxMemoryBytes, _ := strconv.ParseFloat(ParseConfigGet(i.Client, "maxmemory"), 64)
-	usedMemoryBytes, _ := strconv.ParseFloat(infoMap["used_memory"], 64)
-	i.MaxMemory = math.Round(maxMemoryBytes/1024/1024/1024*100) / 100
-	i.UsedMemory = math.Round(usedMemoryBytes/1024/1024/1024*100) / 100
+	i.MaxMemoryBytes, _ = strconv.ParseInt(ParseConfigGet(i.Client, "maxmemory"), 10, 64)
+	i.UsedMemoryBytes, _ = strconv.ParseInt(infoMap["used_memory"], 10, 64)
+	i.MaxMemory = math.Round(float64(i.MaxMemoryBytes)/1024/1024/1024*100) / 100
+	i.UsedMemory = math.Round(float64(i.UsedMemoryBytes)/1024/1024/1024*100) / 100
 
 	i.ClientsCount, _ = strconv.Atoi(infoMap["connected_clients"])
 	i.MaxClients, _ = strconv.Atoi(ParseConfigGet(i.Client, "maxclients"))
@@ -85,39 +103,74 @@ func (i *Instance) init() error {
 	return nil
 }
 
+// Refresh fetches the info of the instance again with it's open client, e.g. to watch it periodically
+func (i *Instance) Refresh() error {
+	i.reset()
+	return i.init()
+}
+
+// reset clears everything fetched by init, so that a node answering LOADING keeps no value of the previous fetch.
+// the connection and the cluster info of UpdateNodeClusterInfo are kept
+func (i *Instance) reset() {
+	*i = Instance{
+		Addr:         i.Addr,
+		DialAddr:     i.DialAddr,
+		Client:       i.Client,
+		NodeID:       i.NodeID,
+		MasterID:     i.MasterID,
+		Slots:        i.Slots,
+		MasterLastIO: -1,
+		SyncProgress: -1,
+	}
+}
+
+// initReplication fills the replication info from infoMap
+func (i *Instance) initReplication(infoMap map[string]string) {
+	i.MasterLinkStatus = infoMap["master_link_status"]
+	i.MasterLastIO = -1
+	if lastIO, err := strconv.Atoi(infoMap["master_last_io_seconds_ago"]); err == nil {
+		i.MasterLastIO = lastIO
+	}
+	i.MasterReplOffset, _ = strconv.ParseInt(infoMap["master_repl_offset"], 10, 64)
+	i.SlaveReplOffset, _ = strconv.ParseInt(infoMap["slave_repl_offset"], 10, 64)
+	i.ReplBacklogSize, _ = strconv.ParseInt(infoMap["repl_backlog_size"], 10, 64)
+	i.InputKbps, _ = strconv.ParseFloat(infoMap["instantaneous_input_kbps"], 64)
+	i.SyncProgress = -1
+	// master_sync_total_bytes is -1 if the size of the rdb is unknown, e.g. diskless sync
+	totalBytes, _ := strconv.ParseFloat(infoMap["master_sync_total_bytes"], 64)
+	readBytes, _ := strconv.ParseFloat(infoMap["master_sync_read_bytes"], 64)
+	if i.SlaveInit && totalBytes > 0 {
+		i.SyncProgress = math.Round(readBytes/totalBytes*1000) / 10
+	}
+}
+
+// ReplLag returns the replication lag in bytes of slave i to master
+func (i *Instance) ReplLag(master *Instance) int64 {
+	// offsets are not fetched at the same time, the slave may look a bit ahead of it's master
+	return max(master.MasterReplOffset-i.SlaveReplOffset, 0)
+}
+
+// BacklogCoverage returns how many seconds of writes the replication backlog holds, -1 if there is no write
+func (i *Instance) BacklogCoverage() float64 {
+	if i.InputKbps <= 0 {
+		return -1
+	}
+	return float64(i.ReplBacklogSize) / (i.InputKbps * 1024)
+}
+
 // GetMasterSlaveMembers return members of a master-slave mechanism: []string{"master:port", "slave1:port", "slave2:port", ...}
+// slaves of cascading replication are included, see GetReplicationTree
 func (i *Instance) GetMasterSlaveMembers() ([]string, error) {
-	if i.Role == "slave" {
-		master, err := NewInstance(i.Master)
-		if err != nil {
-			return nil, fmt.Errorf("failed to connect to master %s: %v", i.Master, err)
-		}
-		defer master.Close()
-		if master.Role != "master" {
-			return nil, fmt.Errorf("cascading replication cannot displayed, try use current master as seednode")
-		}
-		// you need to be a master to get all members
-		return master.GetMasterSlaveMembers()
-	}
-	// append master addr to members. then all it's slaves
-	members := []string{i.Addr}
-	replInfo, err := ParseInfo(i.Client, "replication")
+	tree, err := i.GetReplicationTree()
 	if err != nil {
 		return nil, err
 	}
-	for k, v := range replInfo {
-		if strings.HasPrefix(k, "slave") {
-			slaveInfo := strings.Split(v, ",")
-			slaveIpInfo, slavePortInfo := slaveInfo[0], slaveInfo[1]
-			slaveIp := strings.Split(slaveIpInfo, "=")[1]
-			slavePort := strings.Split(slavePortInfo, "=")[1]
-			members = append(members, fmt.Sprintf("%s:%s", slaveIp, slavePort))
-		}
-	}
-	return members, nil
+	defer tree.Close()
+	return tree.Members(), nil
 }
 
 // GetSentinels get all the sentinel IP of a master-slave cluster: []string{"sentinel1", "sentinel2", ...}
+// ports in client list are the outgoing ports of sentinels, so only IPs are returned. use Sentinel.Sentinels for addrs
 func (i *Instance) GetSentinels() ([]string, error) {
 	if i.ClusterEnabled {
 		return nil, fmt.Errorf("you can't get sentinels for a sharding cluster")
@@ -143,7 +196,7 @@ func (i *Instance) GetSentinels() ([]string, error) {
 	return result, nil
 }
 
-// UpdateNodeClusterInfo updates NodeID, Role, Master, and Slots from ParseClusterNodes output.
+// UpdateNodeClusterInfo updates NodeID, Role, Master, MasterID and Slots from ParseClusterNodes output.
 func (i *Instance) UpdateNodeClusterInfo(clusterNodesInfo [][]string) {
 	nodeAddrs := make(map[string]string)
 	for _, nodeInfo := range clusterNodesInfo {
@@ -161,6 +214,9 @@ func (i *Instance) UpdateNodeClusterInfo(clusterNodesInfo [][]string) {
 			if i.Role == "slave" && (i.LoadingError || i.Master == "") {
 				i.Master = nodeAddrs[nodeInfo[4]]
 			}
+			if i.Role == "slave" && nodeInfo[4] != "-" {
+				i.MasterID = nodeInfo[4]
+			}
 			if i.Role == "master" {
 				i.Slots = newSlotRanges(slotsStr)
 			}
@@ -189,19 +245,80 @@ func (i *Instance) StringSlots() string {
 	return strings.TrimRight(slotStr, " ")
 }
 
+// Host returns the host part of Addr
+func (i *Instance) Host() string {
+	host, _, err := net.SplitHostPort(i.Addr)
+	if err != nil {
+		return i.Addr
+	}
+	return host
+}
+
+// DisplayAddr returns Addr, followed by the dialed addr if it's translated: "10.244.1.5:6379 via 192.168.1.5:6379"
+func (i *Instance) DisplayAddr() string {
+	if i.DialAddr == "" || i.DialAddr == i.Addr {
+		return i.Addr
+	}
+	return i.Addr + " via " + i.DialAddr
+}
+
 func (i *Instance) Close() {
 	i.Client.Close()
 }
 
-// Sorts Instances by Addr
+// Sorts Instances by Addr, see CompareAddr
 type InstancesAscByAddr []*Instance
 
 func (e InstancesAscByAddr) Len() int { return len(e) }
 
-func (e InstancesAscByAddr) Less(i, j int) bool {
-	addrPortI, _ := netip.ParseAddrPort(e[i].Addr)
-	addrPortJ, _ := netip.ParseAddrPort(e[j].Addr)
-	return addrPortI.Compare(addrPortJ) == -1
-}
+func (e InstancesAscByAddr) Less(i, j int) bool { return CompareAddr(e[i].Addr, e[j].Addr) < 0 }
 
 func (e InstancesAscByAddr) Swap(i, j int) { e[i], e[j] = e[j], e[i] }
+
+// CompareAddr compares two addrs of ip:port, [ipv6]:port or hostname:port, it returns -1, 0 or 1.
+// ipv4 addrs come first, then ipv6 addrs, both in numeric order, then hostnames. ports are compared numerically
+func CompareAddr(a, b string) int {
+	hostA, portA, errA := net.SplitHostPort(a)
+	hostB, portB, errB := net.SplitHostPort(b)
+	if errA != nil || errB != nil {
+		return strings.Compare(a, b)
+	}
+	ipA, errA := netip.ParseAddr(hostA)
+	ipB, errB := netip.ParseAddr(hostB)
+	switch {
+	case errA == nil && errB == nil:
+		if c := ipA.Compare(ipB); c != 0 {
+			return c
+		}
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	default:
+		if c := strings.Compare(strings.ToLower(hostA), strings.ToLower(hostB)); c != 0 {
+			return c
+		}
+	}
+	pA, _ := strconv.Atoi(portA)
+	pB, _ := strconv.Atoi(portB)
+	if pA != pB {
+		if pA < pB {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// NormalizeAddr returns addr in the form used by Instance.Addr: lower case host, ipv6 in brackets, no zero-padding.
+// addr is returned as is if it's not a host:port
+func NormalizeAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	if ip, err := netip.ParseAddr(host); err == nil {
+		host = ip.String()
+	}
+	return net.JoinHostPort(strings.ToLower(host), port)
+}
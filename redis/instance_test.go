@@ -1,6 +1,10 @@
 package redis
 
-import "testing"
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
 
 func TestUpdateNodeClusterInfoFillsLoadingInstanceFromClusterNodes(t *testing.T) {
 	clusterNodesInfo := [][]string{
@@ -30,7 +34,86 @@ func TestUpdateNodeClusterInfoFillsLoadingInstanceFromClusterNodes(t *testing.T)
 	if slave.Role != "slave" {
 		t.Fatalf("slave Role = %q, want %q", slave.Role, "slave")
 	}
-	if slave.Master != "127.0.0.1:6379" {
-		t.Fatalf("slave Master = %q, want %q", slave.Master, "127.0.0.1:6379")
+	if slave.Master != "127.0.0.1:6379" || slave.MasterID != "master-id" {
+		t.Fatalf("slave Master = %q(%q), want %q(%q)", slave.Master, slave.MasterID, "127.0.0.1:6379", "master-id")
+	}
+}
+
+func TestInitReplication(t *testing.T) {
+	master := &Instance{}
+	master.initReplication(map[string]string{
+		"master_repl_offset":       "10000",
+		"repl_backlog_size":        "1048576",
+		"instantaneous_input_kbps": "16.00",
+	})
+	if got := master.BacklogCoverage(); got != 64 {
+		t.Fatalf("BacklogCoverage() = %v, want 64", got)
+	}
+
+	slave := &Instance{SlaveInit: true}
+	slave.initReplication(map[string]string{
+		"master_link_status":         "down",
+		"master_last_io_seconds_ago": "-1",
+		"slave_repl_offset":          "9000",
+		"master_sync_total_bytes":    "2000",
+		"master_sync_read_bytes":     "500",
+	})
+	if slave.MasterLinkStatus != "down" || slave.MasterLastIO != -1 || slave.SyncProgress != 25 {
+		t.Fatalf("unexpected replication info: %+v", slave)
+	}
+	if got := slave.ReplLag(master); got != 1000 {
+		t.Fatalf("ReplLag() = %d, want 1000", got)
+	}
+	if got := (&Instance{}).BacklogCoverage(); got != -1 {
+		t.Fatalf("BacklogCoverage() without writes = %v, want -1", got)
+	}
+}
+
+func TestCompareAddr(t *testing.T) {
+	addrs := []string{"redis-b:6379", "[2001:db8::1]:6379", "10.0.0.10:6379", "Redis-A:6380", "10.0.0.9:6380",
+		"10.0.0.9:10000", "redis-a:6379"}
+	instances := make(InstancesAscByAddr, 0, len(addrs))
+	for _, addr := range addrs {
+		instances = append(instances, &Instance{Addr: addr})
+	}
+	sort.Sort(instances)
+	expected := []string{"10.0.0.9:6380", "10.0.0.9:10000", "10.0.0.10:6379", "[2001:db8::1]:6379", "redis-a:6379",
+		"Redis-A:6380", "redis-b:6379"}
+	for n, i := range instances {
+		if i.Addr != expected[n] {
+			t.Fatalf("sorted[%d] = %s, want %s", n, i.Addr, expected[n])
+		}
+	}
+}
+
+func TestNormalizeAddr(t *testing.T) {
+	tests := map[string]string{
+		"10.0.0.1:6379":              "10.0.0.1:6379",
+		"[2001:DB8:0::1]:6379":       "[2001:db8::1]:6379",
+		"Redis-0.SVC:6379":           "redis-0.svc:6379",
+		"07c37dfeb235213a872192d908": "07c37dfeb235213a872192d908",
+	}
+	for addr, expected := range tests {
+		if normalized := NormalizeAddr(addr); normalized != expected {
+			t.Errorf("NormalizeAddr(%s) = %s, want %s", addr, normalized, expected)
+		}
+	}
+}
+
+func TestResetKeepsNoFetchedValue(t *testing.T) {
+	slots := []*SlotRange{{Start: 0, End: 5460, SlotCount: 5461}}
+	i := &Instance{
+		Addr: "10.0.0.1:6379", DialAddr: "192.168.0.1:6379", NodeID: "m1", MasterID: "m2", Slots: slots,
+		Role: "slave", Master: "10.0.0.2:6379", SlaveInit: true, UsedMemory: 1.5, MaxMemory: 4, KeysCount: "100",
+		Version: "7.2.4", Info: map[string]string{"used_memory": "1610612736"}, MasterLinkStatus: "up",
+		MasterLastIO: 1, MasterReplOffset: 100, SlaveReplOffset: 90, SyncProgress: 50, ClusterEnabled: true,
+	}
+	i.reset()
+	want := Instance{
+		Addr: "10.0.0.1:6379", DialAddr: "192.168.0.1:6379", NodeID: "m1", MasterID: "m2", Slots: slots,
+		MasterLastIO: -1, SyncProgress: -1,
+	}
+	if !reflect.DeepEqual(*i, want) {
+		t.Fatalf("reset() = %+v, want %+v", *i, want)
 	}
 }
@@ -0,0 +1,122 @@
+package redis
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"redis-cluster-manager/vars"
+	"strings"
+	"sync"
+)
+
+// cidrRewrite rewrites announced ips in From to the ips of To with the same host bits
+type cidrRewrite struct {
+	From netip.Prefix
+	To   netip.Prefix
+}
+
+// address translation built from vars by InitNAT
+var (
+	addrMap      map[string]string // announced ip:port or ip -> reachable ip:port or ip
+	cidrRewrites []cidrRewrite
+	hostnames    sync.Map // announced addr -> hostname of the active cluster, see setHostnames
+)
+
+// InitNAT builds the address translation from vars.Cluster.AddrMap, vars.Cluster.CIDRMap and vars.Cluster.UseHostname
+func InitNAT() error {
+	addrMap = make(map[string]string)
+	cidrRewrites = nil
+	// the hostnames are learnt from the topology of the cluster being activated
+	hostnames.Clear()
+	for _, m := range vars.Cluster.AddrMap {
+		from, to, found := strings.Cut(m, "=")
+		if !found || from == "" || to == "" {
+			return fmt.Errorf("invalid addr map %s, expect <announced>=<reachable>", m)
+		}
+		addrMap[from] = to
+	}
+	for _, m := range vars.Cluster.CIDRMap {
+		from, to, found := strings.Cut(m, "=")
+		if !found {
+			return fmt.Errorf("invalid cidr map %s, expect <announced-cidr>=<reachable-cidr>", m)
+		}
+		fromPrefix, err := netip.ParsePrefix(from)
+		if err != nil {
+			return fmt.Errorf("invalid cidr map %s: %v", m, err)
+		}
+		toPrefix, err := netip.ParsePrefix(to)
+		if err != nil {
+			return fmt.Errorf("invalid cidr map %s: %v", m, err)
+		}
+		if fromPrefix.Bits() != toPrefix.Bits() || fromPrefix.Addr().BitLen() != toPrefix.Addr().BitLen() {
+			return fmt.Errorf("invalid cidr map %s, both sides must have the same prefix length", m)
+		}
+		cidrRewrites = append(cidrRewrites, cidrRewrite{From: fromPrefix.Masked(), To: toPrefix.Masked()})
+	}
+	return nil
+}
+
+// NATEnabled reports whether any address translation is configured
+func NATEnabled() bool {
+	return len(addrMap) > 0 || len(cidrRewrites) > 0 || vars.Cluster.UseHostname
+}
+
+// DialAddr translates an announced addr to the addr to dial. the first matching rule of the addr map (by ip:port,
+// then by ip), the announced hostname and the cidr map is used. addr is returned as is if no rule matches
+func DialAddr(addr string) string {
+	if to, exists := addrMap[addr]; exists {
+		return to
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	if to, exists := addrMap[host]; exists {
+		return net.JoinHostPort(to, port)
+	}
+	if vars.Cluster.UseHostname {
+		if hostname, exists := hostnames.Load(addr); exists {
+			return net.JoinHostPort(hostname.(string), port)
+		}
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return addr
+	}
+	for _, rw := range cidrRewrites {
+		if rw.From.Contains(ip) {
+			return net.JoinHostPort(rewriteIP(ip, rw).String(), port)
+		}
+	}
+	return addr
+}
+
+// rewriteIP replaces the network bits of ip by the ones of rw.To
+func rewriteIP(ip netip.Addr, rw cidrRewrite) netip.Addr {
+	from, to := ip.AsSlice(), rw.To.Addr().AsSlice()
+	bits := rw.To.Bits()
+	for n := range from {
+		switch {
+		case bits >= 8:
+			from[n] = to[n]
+			bits -= 8
+		case bits > 0:
+			mask := byte(0xff << (8 - bits))
+			from[n] = to[n]&mask | from[n]&^mask
+			bits = 0
+		}
+	}
+	result, _ := netip.AddrFromSlice(from)
+	return result
+}
+
+// setHostnames records the hostnames announced by nodes of the active cluster, they are dialed instead of the ips
+// with vars.Cluster.UseHostname. it's called by GetClusterNodes and GetClusterShards only, parsing a topology has no effect
+// on dialing, and InitNAT forgets the hostnames of the previously active cluster
+func setHostnames(addrHostnames map[string]string) {
+	for addr, hostname := range addrHostnames {
+		if hostname != "" {
+			hostnames.Store(addr, hostname)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package redis
+
+import (
+	"redis-cluster-manager/vars"
+	"testing"
+)
+
+func TestDialAddr(t *testing.T) {
+	defer func() {
+		vars.Cluster.AddrMap, vars.Cluster.CIDRMap, vars.Cluster.UseHostname = nil, nil, false
+		_ = InitNAT()
+	}()
+	vars.Cluster.AddrMap = []string{"10.244.1.5:6379=1.2.3.4:16379", "10.244.1.6=1.2.3.6"}
+	vars.Cluster.CIDRMap = []string{"10.244.0.0/16=192.168.0.0/16", "172.16.0.0/20=10.1.16.0/20"}
+	vars.Cluster.UseHostname = true
+	if err := InitNAT(); err != nil {
+		t.Fatalf("InitNAT() error = %v", err)
+	}
+	setHostnames(map[string]string{"10.244.2.1:6379": "redis-2.redis.svc"})
+	tests := map[string]string{
+		"10.244.1.5:6379":  "1.2.3.4:16379",
+		"10.244.1.5:6380":  "192.168.1.5:6380",
+		"10.244.1.6:6380":  "1.2.3.6:6380",
+		"10.244.2.1:6379":  "redis-2.redis.svc:6379",
+		"172.16.15.7:6379": "10.1.31.7:6379",
+		"172.16.16.7:6379": "172.16.16.7:6379",
+		"10.0.0.1:6379":    "10.0.0.1:6379",
+	}
+	for addr, expected := range tests {
+		if dialed := DialAddr(addr); dialed != expected {
+			t.Errorf("DialAddr(%s) = %s, want %s", addr, dialed, expected)
+		}
+	}
+
+	// parsing a topology records no hostname, activating another cluster forgets the hostnames
+	if _, err := parseClusterNodes("07c37dfeb235213a872192d90877d0cd55635b91 10.244.3.1:6379@16379,redis-3.redis.svc master - 0 0 1 connected\n"); err != nil {
+		t.Fatalf("parseClusterNodes() error = %v", err)
+	}
+	if dialed := DialAddr("10.244.3.1:6379"); dialed != "192.168.3.1:6379" {
+		t.Errorf("DialAddr(10.244.3.1:6379) = %s after parsing, want 192.168.3.1:6379", dialed)
+	}
+	if err := InitNAT(); err != nil {
+		t.Fatalf("InitNAT() error = %v", err)
+	}
+	if dialed := DialAddr("10.244.2.1:6379"); dialed != "192.168.2.1:6379" {
+		t.Errorf("DialAddr(10.244.2.1:6379) = %s after InitNAT, want 192.168.2.1:6379", dialed)
+	}
+
+	vars.Cluster.CIDRMap = []string{"10.244.0.0/16=192.168.0.0/24"}
+	if err := InitNAT(); err == nil {
+		t.Fatal("InitNAT() should fail if prefix lengths differ")
+	}
+	vars.Cluster.CIDRMap, vars.Cluster.AddrMap = nil, []string{"10.244.1.5:6379"}
+	if err := InitNAT(); err == nil {
+		t.Fatal("InitNAT() should fail on an addr map without =")
+	}
+}
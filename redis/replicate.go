@@ -0,0 +1,43 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// syncCheckInterval is the interval between two checks while waiting for a slave to finish its sync
+const syncCheckInterval = time.Second
+
+// Replicate runs `cluster replicate` on slave i to make it a slave of master, then waits until it's full sync finished
+func (i *Instance) Replicate(masterID, masterAddr string, timeout time.Duration) error {
+	if err := i.Client.ClusterReplicate(context.Background(), masterID).Err(); err != nil {
+		return fmt.Errorf("failed to run cluster replicate on %s: %v", i.Addr, err)
+	}
+	return i.WaitForSync(masterID, masterAddr, timeout)
+}
+
+// WaitForSync polls `info replication` until i is a slave of masterID, the link is up and
+// master_sync_in_progress is 0, or timeout reached. the master is matched by the node ID of it's own `cluster nodes`
+// line, since the master addr of `info replication` may differ from masterAddr, e.g. with hostnames or tls-port
+func (i *Instance) WaitForSync(masterID, masterAddr string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		replInfo, err := ParseInfo(i.Client, "replication")
+		if err == nil && replInfo["role"] == "slave" && replInfo["master_link_status"] == "up" &&
+			replInfo["master_sync_in_progress"] == "0" {
+			if myMasterID, err := i.MyMasterID(); err == nil && myMasterID == masterID {
+				i.Role = "slave"
+				i.Master = net.JoinHostPort(replInfo["master_host"], replInfo["master_port"])
+				i.MasterID = masterID
+				i.SlaveInit = false
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s did not finish sync with %s in %v", i.Addr, masterAddr, timeout)
+		}
+		time.Sleep(syncCheckInterval)
+	}
+}
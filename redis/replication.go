@@ -0,0 +1,207 @@
+package redis
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ReplicationNode is a node of a replication tree, slaves of a slave are it's children for cascading replication
+type ReplicationNode struct {
+	Addr     string
+	Instance *Instance // nil if the node can not be connected or closes a cycle, see Err
+	Err      error
+	Cycle    bool             // the node is already in the tree, it's slaves are not discovered again
+	Depth    int              // 0 for the root master
+	Link     *ReplicationLink // link to it's master, nil for the root master
+	Slaves   []*ReplicationNode
+}
+
+// ReplicationLink is the replication edge between a slave and it's master
+type ReplicationLink struct {
+	Status string // master_link_status reported by the slave, "" if the slave can not be connected
+	Lag    int64  // bytes, master_repl_offset of the master - offset of the slave reported by the master
+	LastIO int    // master_last_io_seconds_ago reported by the slave, -1 if unknown
+}
+
+// GetReplicationTree finds the root master of i by following master_host/master_port, then discovers all slaves
+// recursively by `info replication`. a replication cycle is returned as error if it is found from i to the root,
+// or marked as Cycle on the node which closes it
+func (i *Instance) GetReplicationTree() (*ReplicationNode, error) {
+	rootAddr, err := findRoot(i.Addr, i.Role, i.Master, func(addr string) (string, string, error) {
+		m, err := NewInstance(addr)
+		if err != nil {
+			return "", "", err
+		}
+		defer m.Close()
+		return m.Role, m.Master, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	root, err := NewInstance(rootAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to master %s: %v", rootAddr, err)
+	}
+	tree := &ReplicationNode{Addr: rootAddr, Instance: root}
+	visited := map[string]bool{rootAddr: true}
+	level := []*ReplicationNode{tree}
+	for len(level) > 0 {
+		var next []*ReplicationNode
+		for _, n := range level {
+			n.discoverSlaves(visited)
+			for _, s := range n.Slaves {
+				if s.Instance != nil {
+					next = append(next, s)
+				}
+			}
+		}
+		level = next
+	}
+	return tree, nil
+}
+
+// findRoot follows the masters of addr by master(addr) returning it's role and master addr, and returns the root master
+func findRoot(addr, role, masterAddr string, master func(addr string) (string, string, error)) (string, error) {
+	chain := []string{addr}
+	rootAddr := addr
+	for role == "slave" {
+		for _, a := range chain {
+			if a == masterAddr {
+				return "", fmt.Errorf("replication cycle detected: %s -> %s", strings.Join(chain, " -> "), masterAddr)
+			}
+		}
+		nextRole, nextMaster, err := master(masterAddr)
+		if err != nil {
+			return "", fmt.Errorf("failed to connect to master %s of %s: %v", masterAddr, rootAddr, err)
+		}
+		chain = append(chain, masterAddr)
+		rootAddr = masterAddr
+		role, masterAddr = nextRole, nextMaster
+	}
+	return rootAddr, nil
+}
+
+// addSlaves sets the slaves listed in replInfo of n as it's children, sorted by addr. a slave already in visited
+// closes a replication cycle, it's marked as Cycle and it's slaves are not discovered again
+func (n *ReplicationNode) addSlaves(replInfo map[string]string, visited map[string]bool) {
+	masterOffset, _ := strconv.ParseInt(replInfo["master_repl_offset"], 10, 64)
+	for k, v := range replInfo {
+		if !strings.HasPrefix(k, "slave") {
+			continue
+		}
+		if _, err := strconv.Atoi(strings.TrimPrefix(k, "slave")); err != nil {
+			// slave_read_only, slave_repl_offset, ...
+			continue
+		}
+		fields := parseSlaveInfo(v)
+		offset, _ := strconv.ParseInt(fields["offset"], 10, 64)
+		slave := &ReplicationNode{
+			Addr:  net.JoinHostPort(fields["ip"], fields["port"]),
+			Depth: n.Depth + 1,
+			Link:  &ReplicationLink{Lag: masterOffset - offset, LastIO: -1},
+		}
+		if visited[slave.Addr] {
+			slave.Cycle = true
+			slave.Err = fmt.Errorf("replication cycle detected, %s is already in the tree", slave.Addr)
+		}
+		visited[slave.Addr] = true
+		n.Slaves = append(n.Slaves, slave)
+	}
+	sort.Slice(n.Slaves, func(i, j int) bool { return CompareAddr(n.Slaves[i].Addr, n.Slaves[j].Addr) < 0 })
+}
+
+// discoverSlaves connects to all slaves of n simultaneously and sets them as children of n
+func (n *ReplicationNode) discoverSlaves(visited map[string]bool) {
+	replInfo, err := ParseInfo(n.Instance.Client, "replication")
+	if err != nil {
+		n.Err = err
+		return
+	}
+	n.addSlaves(replInfo, visited)
+	var wg sync.WaitGroup
+	for _, slave := range n.Slaves {
+		if slave.Cycle {
+			continue
+		}
+		wg.Add(1)
+		go func(s *ReplicationNode) {
+			defer wg.Done()
+			s.Instance, s.Err = NewInstance(s.Addr)
+			if s.Err != nil {
+				return
+			}
+			slaveReplInfo, err := ParseInfo(s.Instance.Client, "replication")
+			if err != nil {
+				return
+			}
+			s.Link.Status = slaveReplInfo["master_link_status"]
+			if lastIO, err := strconv.Atoi(slaveReplInfo["master_last_io_seconds_ago"]); err == nil {
+				s.Link.LastIO = lastIO
+			}
+		}(slave)
+	}
+	wg.Wait()
+}
+
+// parseSlaveInfo parses a slaveN value of `info replication`: "ip=x.x.x.x,port=6379,state=online,offset=1,lag=0"
+func parseSlaveInfo(v string) map[string]string {
+	fields := make(map[string]string)
+	for _, field := range strings.Split(v, ",") {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) == 2 {
+			fields[parts[0]] = parts[1]
+		}
+	}
+	return fields
+}
+
+// Walk calls fn for n and all it's descendants in depth-first order
+func (n *ReplicationNode) Walk(fn func(*ReplicationNode)) {
+	fn(n)
+	for _, s := range n.Slaves {
+		s.Walk(fn)
+	}
+}
+
+// Members returns addrs of all nodes in the tree including the unreachable ones, the root master first
+func (n *ReplicationNode) Members() []string {
+	var members []string
+	seen := make(map[string]bool)
+	n.Walk(func(node *ReplicationNode) {
+		if !seen[node.Addr] {
+			seen[node.Addr] = true
+			members = append(members, node.Addr)
+		}
+	})
+	return members
+}
+
+// Instances returns the connected instances of the tree, the root master first, and the errors of the nodes which
+// can not be connected by addr. nodes closing a cycle are left out, they're already in the tree
+func (n *ReplicationNode) Instances() ([]*Instance, map[string]error) {
+	var instances []*Instance
+	errs := make(map[string]error)
+	n.Walk(func(node *ReplicationNode) {
+		switch {
+		case node.Cycle:
+		case node.Instance != nil:
+			instances = append(instances, node.Instance)
+		case node.Err != nil:
+			errs[node.Addr] = node.Err
+		}
+	})
+	return instances, errs
+}
+
+// Close closes all instances in the tree
+func (n *ReplicationNode) Close() {
+	n.Walk(func(node *ReplicationNode) {
+		if node.Instance != nil {
+			node.Instance.Close()
+		}
+	})
+}
@@ -0,0 +1,157 @@
+package redis
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseSlaveInfo(t *testing.T) {
+	tests := []struct {
+		name string
+		v    string
+		want map[string]string
+	}{
+		{
+			name: "all fields",
+			v:    "ip=10.0.0.2,port=6379,state=online,offset=100,lag=0",
+			want: map[string]string{"ip": "10.0.0.2", "port": "6379", "state": "online", "offset": "100", "lag": "0"},
+		},
+		{
+			name: "ipv6 and malformed field",
+			v:    "ip=2001:db8::1,port=6380,broken",
+			want: map[string]string{"ip": "2001:db8::1", "port": "6380"},
+		},
+		{
+			name: "empty",
+			v:    "",
+			want: map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseSlaveInfo(tt.v); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("parseSlaveInfo() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMembers(t *testing.T) {
+	tests := []struct {
+		name string
+		tree *ReplicationNode
+		want []string
+	}{
+		{
+			name: "master only",
+			tree: &ReplicationNode{Addr: "10.0.0.1:6379"},
+			want: []string{"10.0.0.1:6379"},
+		},
+		{
+			name: "cascading slaves depth first",
+			tree: &ReplicationNode{Addr: "10.0.0.1:6379", Slaves: []*ReplicationNode{
+				{Addr: "10.0.0.2:6379", Slaves: []*ReplicationNode{{Addr: "10.0.0.4:6379"}}},
+				{Addr: "10.0.0.3:6379", Err: errors.New("connection refused")},
+			}},
+			want: []string{"10.0.0.1:6379", "10.0.0.2:6379", "10.0.0.4:6379", "10.0.0.3:6379"},
+		},
+		{
+			name: "cycle listed once",
+			tree: &ReplicationNode{Addr: "10.0.0.1:6379", Slaves: []*ReplicationNode{
+				{Addr: "10.0.0.2:6379", Slaves: []*ReplicationNode{{Addr: "10.0.0.1:6379", Cycle: true}}},
+			}},
+			want: []string{"10.0.0.1:6379", "10.0.0.2:6379"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.tree.Members(); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Members() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInstances(t *testing.T) {
+	master, slave := &Instance{Addr: "10.0.0.1:6379"}, &Instance{Addr: "10.0.0.2:6379"}
+	tree := &ReplicationNode{Addr: master.Addr, Instance: master, Slaves: []*ReplicationNode{
+		{Addr: slave.Addr, Instance: slave, Slaves: []*ReplicationNode{
+			{Addr: master.Addr, Cycle: true, Err: errors.New("replication cycle detected")},
+		}},
+		{Addr: "10.0.0.3:6379", Err: errors.New("connection refused")},
+	}}
+	instances, errs := tree.Instances()
+	if !reflect.DeepEqual(instances, []*Instance{master, slave}) {
+		t.Fatalf("Instances() = %v, want the master and the slave", instances)
+	}
+	if len(errs) != 1 || errs["10.0.0.3:6379"] == nil {
+		t.Fatalf("Instances() errs = %v, want 10.0.0.3:6379", errs)
+	}
+}
+
+func TestAddSlavesMarksCycle(t *testing.T) {
+	visited := map[string]bool{"10.0.0.1:6379": true}
+	root := &ReplicationNode{Addr: "10.0.0.1:6379"}
+	root.addSlaves(map[string]string{
+		"master_repl_offset": "1000",
+		"slave0":             "ip=10.0.0.3,port=6379,state=online,offset=900,lag=0",
+		"slave1":             "ip=10.0.0.2,port=6379,state=online,offset=1000,lag=0",
+		"slave_read_only":    "1",
+	}, visited)
+	if len(root.Slaves) != 2 || root.Slaves[0].Addr != "10.0.0.2:6379" || root.Slaves[1].Link.Lag != 100 {
+		t.Fatalf("unexpected slaves: %+v %+v", root.Slaves[0], root.Slaves[1])
+	}
+
+	// 10.0.0.2 replicates from 10.0.0.3 too, and 10.0.0.3 from the root
+	slave := root.Slaves[1]
+	slave.addSlaves(map[string]string{
+		"slave0": "ip=10.0.0.1,port=6379,state=online,offset=0,lag=0",
+		"slave1": "ip=10.0.0.5,port=6379,state=online,offset=0,lag=0",
+	}, visited)
+	if !slave.Slaves[0].Cycle || slave.Slaves[0].Err == nil || slave.Slaves[1].Cycle || slave.Slaves[1].Depth != 2 {
+		t.Fatalf("unexpected slaves: %+v %+v", slave.Slaves[0], slave.Slaves[1])
+	}
+}
+
+func TestFindRoot(t *testing.T) {
+	// masters of every addr: role, master addr
+	topology := map[string][2]string{
+		"a": {"master", ""},
+		"b": {"slave", "a"},
+		"c": {"slave", "b"},
+		"x": {"slave", "y"},
+		"y": {"slave", "x"},
+	}
+	master := func(addr string) (string, string, error) {
+		n, exists := topology[addr]
+		if !exists {
+			return "", "", errors.New("connection refused")
+		}
+		return n[0], n[1], nil
+	}
+	tests := []struct {
+		name    string
+		addr    string
+		want    string
+		wantErr bool
+	}{
+		{name: "master", addr: "a", want: "a"},
+		{name: "cascading slave", addr: "c", want: "a"},
+		{name: "cycle", addr: "x", wantErr: true},
+		{name: "unreachable master", addr: "z", wantErr: true},
+	}
+	topology["z"] = [2]string{"slave", "unknown"}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := topology[tt.addr]
+			got, err := findRoot(tt.addr, n[0], n[1], master)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Fatalf("findRoot() = %q, %v, want %q, wantErr %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package redis
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NewSeedInstance connects to the seeds of comma separated hostPorts in order and returns the first usable one.
+// a seed that can not be connected, is LOADING or fails `cluster nodes` is skipped, it's error is returned in skipped
+func NewSeedInstance(hostPorts string) (*Instance, []error, error) {
+	return newSeedInstance(hostPorts, NewInstance)
+}
+
+// newSeedInstance is NewSeedInstance connecting to the seeds by connect
+func newSeedInstance(hostPorts string, connect func(hostPort string) (*Instance, error)) (*Instance, []error, error) {
+	var skipped []error
+	for _, hostPort := range strings.Split(hostPorts, ",") {
+		hostPort = strings.TrimSpace(hostPort)
+		if hostPort == "" {
+			continue
+		}
+		i, err := connect(hostPort)
+		if err != nil {
+			skipped = append(skipped, fmt.Errorf("seed node %s: %v", hostPort, err))
+			continue
+		}
+		if err := i.checkSeed(); err != nil {
+			i.Close()
+			skipped = append(skipped, fmt.Errorf("seed node %s: %v", hostPort, err))
+			continue
+		}
+		return i, skipped, nil
+	}
+	if len(skipped) == 0 {
+		return nil, nil, fmt.Errorf("no seed node given")
+	}
+	return nil, skipped, fmt.Errorf("none of the seed nodes %s is usable", hostPorts)
+}
+
+// checkSeed returns an error if i can not be used to discover it's cluster
+func (i *Instance) checkSeed() error {
+	if i.LoadingError {
+		return fmt.Errorf("loading the dataset in memory")
+	}
+	if i.ClusterEnabled {
+		if _, err := ParseClusterNodes(i.Client); err != nil {
+			return err
+		}
+	}
+	return nil
+}
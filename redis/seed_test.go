@@ -0,0 +1,60 @@
+package redis
+
+import (
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"testing"
+)
+
+func TestNewSeedInstance(t *testing.T) {
+	connect := func(hostPort string) (*Instance, error) {
+		switch hostPort {
+		case "10.0.0.1:6379":
+			return nil, errors.New("connection refused")
+		case "10.0.0.2:6379":
+			return &Instance{Addr: hostPort, Client: redis.NewClient(&redis.Options{Addr: hostPort}), LoadingError: true}, nil
+		}
+		return &Instance{Addr: hostPort}, nil
+	}
+	tests := []struct {
+		name        string
+		hostPorts   string
+		want        string
+		wantSkipped int
+		wantErr     bool
+	}{
+		{
+			name:      "first seed usable",
+			hostPorts: "10.0.0.3:6379,10.0.0.1:6379",
+			want:      "10.0.0.3:6379",
+		},
+		{
+			name:        "down and loading seeds skipped",
+			hostPorts:   "10.0.0.1:6379, ,10.0.0.2:6379, 10.0.0.3:6379",
+			want:        "10.0.0.3:6379",
+			wantSkipped: 2,
+		},
+		{
+			name:        "all seeds down",
+			hostPorts:   "10.0.0.1:6379,10.0.0.2:6379",
+			wantSkipped: 2,
+			wantErr:     true,
+		},
+		{
+			name:    "no seed",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i, skipped, err := newSeedInstance(tt.hostPorts, connect)
+			if (err != nil) != tt.wantErr || len(skipped) != tt.wantSkipped {
+				t.Fatalf("newSeedInstance() skipped = %v, error = %v, want %d skipped, wantErr %v", skipped, err, tt.wantSkipped, tt.wantErr)
+			}
+			if err == nil && i.Addr != tt.want {
+				t.Fatalf("newSeedInstance() = %s, want %s", i.Addr, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"net"
+	"redis-cluster-manager/vars"
+)
+
+// Sentinel is a redis sentinel process
+type Sentinel struct {
+	Addr   string
+	Client *redis.SentinelClient
+}
+
+func NewSentinel(hostPort string) (*Sentinel, error) {
+	client := redis.NewSentinelClient(&redis.Options{
+		Addr:         DialAddr(hostPort),
+		Username:     vars.Cluster.SentinelUsername,
+		Password:     vars.Cluster.SentinelPassword,
+		PoolSize:     3,
+		DialTimeout:  vars.Cluster.Timeout,
+		ReadTimeout:  vars.Cluster.Timeout,
+		WriteTimeout: vars.Cluster.Timeout,
+		TLSConfig:    tlsConfig,
+	})
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("create sentinel client failed with error: %v", err)
+	}
+	return &Sentinel{Addr: hostPort, Client: client}, nil
+}
+
+// IsSentinel reports whether hostPort is a sentinel, by checking redis_mode of `info server`
+func IsSentinel(hostPort string) bool {
+	client := redis.NewClient(&redis.Options{
+		Addr:         DialAddr(hostPort),
+		Username:     vars.Cluster.SentinelUsername,
+		Password:     vars.Cluster.SentinelPassword,
+		PoolSize:     1,
+		DialTimeout:  vars.Cluster.Timeout,
+		ReadTimeout:  vars.Cluster.Timeout,
+		WriteTimeout: vars.Cluster.Timeout,
+		TLSConfig:    tlsConfig,
+	})
+	defer client.Close()
+	serverInfo, err := ParseInfo(client, "server")
+	return err == nil && serverInfo["redis_mode"] == "sentinel"
+}
+
+// Masters returns `sentinel masters` output: a map of all fields for each monitored master
+func (s *Sentinel) Masters() ([]map[string]string, error) {
+	result, err := s.Client.Masters(context.Background()).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run sentinel masters on %s: %v", s.Addr, err)
+	}
+	var masters []map[string]string
+	for _, item := range result {
+		masters = append(masters, toStringMap(item))
+	}
+	return masters, nil
+}
+
+// Master returns `sentinel master <name>` output
+func (s *Sentinel) Master(name string) (map[string]string, error) {
+	result, err := s.Client.Master(context.Background(), name).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run sentinel master on %s: %v", s.Addr, err)
+	}
+	return result, nil
+}
+
+// Replicas returns `sentinel replicas <name>` output
+func (s *Sentinel) Replicas(name string) ([]map[string]string, error) {
+	result, err := s.Client.Replicas(context.Background(), name).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run sentinel replicas on %s: %v", s.Addr, err)
+	}
+	return result, nil
+}
+
+// Sentinels returns `sentinel sentinels <name>` output, which doesn't contain the sentinel itself
+func (s *Sentinel) Sentinels(name string) ([]map[string]string, error) {
+	result, err := s.Client.Sentinels(context.Background(), name).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run sentinel sentinels on %s: %v", s.Addr, err)
+	}
+	return result, nil
+}
+
+// CkQuorum returns the reply of `sentinel ckquorum <name>`, err is not nil if the quorum can not be reached
+func (s *Sentinel) CkQuorum(name string) (string, error) {
+	return s.Client.CkQuorum(context.Background(), name).Result()
+}
+
+// GetMasterAddr returns the master addr of name that this sentinel believes
+func (s *Sentinel) GetMasterAddr(name string) (string, error) {
+	result, err := s.Client.GetMasterAddrByName(context.Background(), name).Result()
+	if err != nil {
+		return "", fmt.Errorf("failed to get master addr of %s on %s: %v", name, s.Addr, err)
+	}
+	if len(result) != 2 {
+		return "", fmt.Errorf("invalid master addr of %s on %s: %v", name, s.Addr, result)
+	}
+	return net.JoinHostPort(result[0], result[1]), nil
+}
+
+func (s *Sentinel) Close() {
+	s.Client.Close()
+}
+
+// FieldsAddr returns "ip:port" from the ip and port fields of sentinel replies
+func FieldsAddr(fields map[string]string) string {
+	return net.JoinHostPort(fields["ip"], fields["port"])
+}
+
+// toStringMap converts a sentinel reply of RESP2 flat array or RESP3 map to map[string]string
+func toStringMap(item interface{}) map[string]string {
+	m := make(map[string]string)
+	switch v := item.(type) {
+	case []interface{}:
+		for i := 0; i+1 < len(v); i += 2 {
+			m[fmt.Sprint(v[i])] = fmt.Sprint(v[i+1])
+		}
+	case map[interface{}]interface{}:
+		for key, value := range v {
+			m[fmt.Sprint(key)] = fmt.Sprint(value)
+		}
+	case map[string]interface{}:
+		for key, value := range v {
+			m[key] = fmt.Sprint(value)
+		}
+	}
+	return m
+}
@@ -0,0 +1,14 @@
+package redis
+
+import "testing"
+
+func TestToStringMap(t *testing.T) {
+	resp2 := []interface{}{"name", "mymaster", "port", int64(6379)}
+	resp3 := map[interface{}]interface{}{"name": "mymaster", "port": int64(6379)}
+	for _, item := range []interface{}{resp2, resp3} {
+		m := toStringMap(item)
+		if m["name"] != "mymaster" || m["port"] != "6379" {
+			t.Fatalf("toStringMap(%v) = %v", item, m)
+		}
+	}
+}
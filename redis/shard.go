@@ -0,0 +1,198 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"net"
+	"redis-cluster-manager/vars"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Shard is a master and it's slaves serving the same slots
+type Shard struct {
+	Slots []*SlotRange
+	Nodes []*ShardNode // the master first, then slaves sorted by addr
+}
+
+// ShardNode is a node of a shard reported by `cluster shards`
+type ShardNode struct {
+	ID                string
+	Addr              string // ip:port to connect to, tls-port is used with --tls
+	Endpoint          string // preferred endpoint of the node
+	Hostname          string // announced hostname, "" if not announced
+	Role              string // master or slave
+	ReplicationOffset int64  // -1 if unknown
+	Health            string // online, loading or fail
+}
+
+// GetClusterShards returns the shards of the cluster by `cluster shards`, or by `cluster nodes` before redis 7.0. the
+// announced hostnames are recorded for dialing, see setHostnames
+func GetClusterShards(client *redis.Client) ([]*Shard, error) {
+	result, err := client.ClusterShards(context.Background()).Result()
+	if err != nil {
+		if !isUnknownCommand(err) {
+			return nil, fmt.Errorf("failed to get cluster shards: %v", err)
+		}
+		nodes, err := GetClusterNodes(client)
+		if err != nil {
+			return nil, err
+		}
+		return shardsFromClusterNodes(nodes), nil
+	}
+	var shards []*Shard
+	addrHostnames := make(map[string]string)
+	for _, s := range result {
+		shard := &Shard{}
+		for _, slots := range s.Slots {
+			shard.Slots = append(shard.Slots, &SlotRange{
+				Start:     int(slots.Start),
+				End:       int(slots.End),
+				SlotCount: int(slots.End - slots.Start + 1),
+			})
+		}
+		for _, n := range s.Nodes {
+			node := newShardNode(n)
+			addrHostnames[node.Addr] = node.Hostname
+			shard.Nodes = append(shard.Nodes, node)
+		}
+		shard.sortNodes()
+		shards = append(shards, shard)
+	}
+	sortShards(shards)
+	setHostnames(addrHostnames)
+	return shards, nil
+}
+
+func newShardNode(n redis.Node) *ShardNode {
+	port := n.Port
+	if (vars.Cluster.TLS && n.TLSPort > 0) || port == 0 {
+		port = n.TLSPort
+	}
+	node := &ShardNode{
+		ID:                n.ID,
+		Addr:              net.JoinHostPort(n.IP, strconv.FormatInt(port, 10)),
+		Endpoint:          n.Endpoint,
+		Hostname:          n.Hostname,
+		Role:              n.Role,
+		ReplicationOffset: n.ReplicationOffset,
+		Health:            n.Health,
+	}
+	if node.Role == "replica" {
+		node.Role = "slave"
+	}
+	return node
+}
+
+// shardsFromClusterNodes groups nodes into shards by their masters, health and offsets are not known by `cluster nodes`
+func shardsFromClusterNodes(nodes []*ClusterNode) []*Shard {
+	byMaster := make(map[string]*Shard)
+	var shards []*Shard
+	shardOf := func(masterID string) *Shard {
+		shard, exists := byMaster[masterID]
+		if !exists {
+			shard = &Shard{}
+			byMaster[masterID] = shard
+			shards = append(shards, shard)
+		}
+		return shard
+	}
+	for _, n := range nodes {
+		if n.HasFlag("noaddr") && n.Role == "" {
+			continue
+		}
+		shardNode := &ShardNode{
+			ID:                n.NodeID,
+			Addr:              n.Addr,
+			Endpoint:          n.Host(),
+			Hostname:          n.Hostname,
+			Role:              n.Role,
+			ReplicationOffset: -1,
+			Health:            "online",
+		}
+		if n.HasFlag("fail") {
+			shardNode.Health = "fail"
+		}
+		if n.Role == "master" {
+			shard := shardOf(n.NodeID)
+			shard.Slots = n.Slots
+			shard.Nodes = append(shard.Nodes, shardNode)
+		} else {
+			shard := shardOf(n.MasterID)
+			shard.Nodes = append(shard.Nodes, shardNode)
+		}
+	}
+	for _, shard := range shards {
+		shard.sortNodes()
+	}
+	sortShards(shards)
+	return shards
+}
+
+// ShardsNodesInfo converts shards to the ParseClusterNodes output, so that the instances of a topology fetched by
+// GetClusterShards are created without fetching `cluster nodes` again. slaves of a shard without master get "-"
+func ShardsNodesInfo(shards []*Shard) [][]string {
+	var clusterNodesInfo [][]string
+	for _, shard := range shards {
+		masterID := "-"
+		if master := shard.Master(); master != nil {
+			masterID = master.ID
+		}
+		for _, n := range shard.Nodes {
+			if n.Role == "master" {
+				clusterNodesInfo = append(clusterNodesInfo, []string{n.ID, n.Addr, formatNodeSlots(shard.Slots), n.Role, "-"})
+			} else {
+				clusterNodesInfo = append(clusterNodesInfo, []string{n.ID, n.Addr, "", n.Role, masterID})
+			}
+		}
+	}
+	return clusterNodesInfo
+}
+
+// sortNodes puts the master first, then slaves sorted by addr
+func (s *Shard) sortNodes() {
+	sort.SliceStable(s.Nodes, func(i, j int) bool {
+		if (s.Nodes[i].Role == "master") != (s.Nodes[j].Role == "master") {
+			return s.Nodes[i].Role == "master"
+		}
+		return CompareAddr(s.Nodes[i].Addr, s.Nodes[j].Addr) < 0
+	})
+}
+
+// sortShards sorts shards by the addr of their first nodes
+func sortShards(shards []*Shard) {
+	sort.SliceStable(shards, func(i, j int) bool {
+		if len(shards[i].Nodes) == 0 || len(shards[j].Nodes) == 0 {
+			return len(shards[i].Nodes) > len(shards[j].Nodes)
+		}
+		return CompareAddr(shards[i].Nodes[0].Addr, shards[j].Nodes[0].Addr) < 0
+	})
+}
+
+// Master returns the master of the shard, nil if the shard has no master, e.g. it's master is forgotten
+func (s *Shard) Master() *ShardNode {
+	if len(s.Nodes) > 0 && s.Nodes[0].Role == "master" {
+		return s.Nodes[0]
+	}
+	return nil
+}
+
+// GetSlotCount returns the number of slots served by the shard
+func (s *Shard) GetSlotCount() int {
+	count := 0
+	for _, slots := range s.Slots {
+		count += slots.SlotCount
+	}
+	return count
+}
+
+// StringSlots returns the slot ranges of the shard: "[0-5460] [10923-10923]"
+func (s *Shard) StringSlots() string {
+	var ranges []string
+	for _, slots := range s.Slots {
+		ranges = append(ranges, slots.String())
+	}
+	return strings.Join(ranges, " ")
+}
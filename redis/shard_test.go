@@ -0,0 +1,75 @@
+package redis
+
+import (
+	"github.com/redis/go-redis/v9"
+	"redis-cluster-manager/vars"
+	"reflect"
+	"testing"
+)
+
+func TestShardsFromClusterNodes(t *testing.T) {
+	output := `07c37dfeb235213a872192d90877d0cd55635b91 127.0.0.1:30004@31004 slave e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca 0 1426238317239 4 connected
+67ed2db8d677e59ec4a4cefb06858cf2a1a89fa1 127.0.0.1:30002@31002 master,fail - 0 1426238316232 2 connected 5461-10922
+e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca 127.0.0.1:30001@31001 myself,master - 0 0 1 connected 0-5460
+292f8b365bb7edb5e285caf0b7e6ddc7265d2f4f 127.0.0.1:30003@31003 slave e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca 0 1426238318243 3 connected
+6ec23923021cf3ffec47632106199cb7f496ce01 127.0.0.1:30005@31005 slave 824fe116063bc5fcf9f4ffd895bc17aee7731ac3 0 1426238316232 5 connected
+`
+	nodes, err := parseClusterNodes(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shards := shardsFromClusterNodes(nodes)
+	if len(shards) != 3 {
+		t.Fatalf("len(shards) = %d, want 3", len(shards))
+	}
+	first := shards[0]
+	if first.Master() == nil || first.Master().Addr != "127.0.0.1:30001" || first.GetSlotCount() != 5461 ||
+		len(first.Nodes) != 3 || first.Nodes[1].Addr != "127.0.0.1:30003" || first.Nodes[2].Addr != "127.0.0.1:30004" {
+		t.Fatalf("unexpected first shard: %+v", first.Nodes)
+	}
+	if failed := shards[1].Master(); failed == nil || failed.Health != "fail" || failed.ReplicationOffset != -1 {
+		t.Fatalf("unexpected failed master: %+v", failed)
+	}
+	// the master of 127.0.0.1:30005 is not known
+	if orphaned := shards[2]; orphaned.Master() != nil || len(orphaned.Nodes) != 1 || orphaned.GetSlotCount() != 0 {
+		t.Fatalf("unexpected orphaned shard: %+v", orphaned.Nodes)
+	}
+}
+
+func TestNewShardNode(t *testing.T) {
+	defer func() { vars.Cluster.TLS = false }()
+	n := redis.Node{ID: "a", IP: "2001:db8::1", Port: 6379, TLSPort: 6380, Role: "replica", Health: "online"}
+	if node := newShardNode(n); node.Addr != "[2001:db8::1]:6379" || node.Role != "slave" {
+		t.Fatalf("newShardNode() = %+v", node)
+	}
+	vars.Cluster.TLS = true
+	if node := newShardNode(n); node.Addr != "[2001:db8::1]:6380" {
+		t.Fatalf("newShardNode() with tls = %+v", node)
+	}
+	// tls only node
+	vars.Cluster.TLS = false
+	n.Port = 0
+	if node := newShardNode(n); node.Addr != "[2001:db8::1]:6380" {
+		t.Fatalf("newShardNode() of a tls only node = %+v", node)
+	}
+}
+
+func TestShardsNodesInfo(t *testing.T) {
+	output := `07c37dfeb235213a872192d90877d0cd55635b91 127.0.0.1:30004@31004 slave e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca 0 1426238317239 4 connected
+e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca 127.0.0.1:30001@31001 myself,master - 0 0 1 connected 0-5460 10923
+6ec23923021cf3ffec47632106199cb7f496ce01 127.0.0.1:30005@31005 slave 824fe116063bc5fcf9f4ffd895bc17aee7731ac3 0 1426238316232 5 connected
+`
+	nodes, err := parseClusterNodes(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca", "127.0.0.1:30001", "0-5460 10923", "master", "-"},
+		{"07c37dfeb235213a872192d90877d0cd55635b91", "127.0.0.1:30004", "", "slave", "e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca"},
+		// the master of 127.0.0.1:30005 is not known
+		{"6ec23923021cf3ffec47632106199cb7f496ce01", "127.0.0.1:30005", "", "slave", "-"},
+	}
+	if got := ShardsNodesInfo(shardsFromClusterNodes(nodes)); !reflect.DeepEqual(got, want) {
+		t.Fatalf("ShardsNodesInfo() = %v, want %v", got, want)
+	}
+}
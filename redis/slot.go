@@ -6,6 +6,9 @@ import (
 	"strings"
 )
 
+// ClusterSlots is the number of hash slots of a cluster
+const ClusterSlots = 16384
+
 type SlotRange struct {
 	Start     int // start of the slot range
 	End       int // end of the slot range
@@ -0,0 +1,50 @@
+package redis
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"redis-cluster-manager/vars"
+)
+
+// tlsConfig is used by all clients of data nodes and sentinels, nil for plaintext connections
+var tlsConfig *tls.Config
+
+// InitTLS builds the TLS config of all clients from vars, it must be called before any client is created
+func InitTLS() error {
+	if !vars.Cluster.TLS {
+		if vars.Cluster.TLSCACert != "" || vars.Cluster.TLSCert != "" || vars.Cluster.TLSKey != "" || vars.Cluster.TLSServerName != "" || vars.Cluster.TLSInsecure {
+			return fmt.Errorf("--cacert, --cert, --key, --sni and --insecure require --tls")
+		}
+		tlsConfig = nil
+		return nil
+	}
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         vars.Cluster.TLSServerName,
+		InsecureSkipVerify: vars.Cluster.TLSInsecure,
+	}
+	if vars.Cluster.TLSCACert != "" {
+		pem, err := os.ReadFile(vars.Cluster.TLSCACert)
+		if err != nil {
+			return fmt.Errorf("failed to read CA certificate: %v", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificate found in CA certificate file %s", vars.Cluster.TLSCACert)
+		}
+	}
+	if (vars.Cluster.TLSCert == "") != (vars.Cluster.TLSKey == "") {
+		return fmt.Errorf("--cert and --key must be given together")
+	}
+	if vars.Cluster.TLSCert != "" {
+		cert, err := tls.LoadX509KeyPair(vars.Cluster.TLSCert, vars.Cluster.TLSKey)
+		if err != nil {
+			return fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	tlsConfig = config
+	return nil
+}
@@ -0,0 +1,131 @@
+package redis
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"redis-cluster-manager/vars"
+	"testing"
+	"time"
+)
+
+// testCert is a certificate signed by parent, or a self-signed CA if parent is nil
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func newTestCert(t *testing.T, name string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signerCert, signerKey := template, key
+	if parent == nil {
+		template.IsCA, template.BasicConstraintsValid = true, true
+	} else {
+		signerCert, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signerCert, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+// write writes the certificate and key as pem files to dir, and returns their paths
+func (c *testCert) write(t *testing.T, dir, name string) (string, string) {
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPath, keyPath := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certPath, keyPath
+}
+
+// handshake runs a TLS handshake between tlsConfig and a server requiring client certificates signed by ca
+func handshake(ca, server *testCert) error {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	serverConfig := &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{server.der}, PrivateKey: server.key}},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+	go tls.Server(serverConn, serverConfig).Handshake()
+	return tls.Client(clientConn, tlsConfig).Handshake()
+}
+
+func TestInitTLS(t *testing.T) {
+	defer func() {
+		vars.Cluster.TLS, vars.Cluster.TLSCACert, vars.Cluster.TLSCert, vars.Cluster.TLSKey, vars.Cluster.TLSServerName, vars.Cluster.TLSInsecure = false, "", "", "", "", false
+		tlsConfig = nil
+	}()
+	dir := t.TempDir()
+	ca := newTestCert(t, "test-ca", nil)
+	server := newTestCert(t, "redis.test", ca)
+	client := newTestCert(t, "rcm", ca)
+	caPath, _ := ca.write(t, dir, "ca")
+	certPath, keyPath := client.write(t, dir, "client")
+
+	vars.Cluster.TLSCACert = caPath
+	if err := InitTLS(); err == nil {
+		t.Fatal("InitTLS() should fail if --cacert is given without --tls")
+	}
+	vars.Cluster.TLS, vars.Cluster.TLSServerName, vars.Cluster.TLSCert = true, "redis.test", certPath
+	if err := InitTLS(); err == nil {
+		t.Fatal("InitTLS() should fail if --cert is given without --key")
+	}
+	vars.Cluster.TLSKey = keyPath
+	if err := InitTLS(); err != nil {
+		t.Fatalf("InitTLS() error = %v", err)
+	}
+	if err := handshake(ca, server); err != nil {
+		t.Fatalf("handshake with server signed by ca error = %v", err)
+	}
+	vars.Cluster.TLSServerName = "other.test"
+	if err := InitTLS(); err != nil {
+		t.Fatalf("InitTLS() error = %v", err)
+	}
+	if err := handshake(ca, server); err == nil {
+		t.Fatal("handshake should fail if the server name does not match")
+	}
+	vars.Cluster.TLSInsecure = true
+	if err := InitTLS(); err != nil {
+		t.Fatalf("InitTLS() error = %v", err)
+	}
+	if err := handshake(ca, server); err != nil {
+		t.Fatalf("insecure handshake error = %v", err)
+	}
+}
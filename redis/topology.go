@@ -0,0 +1,181 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"net"
+	"redis-cluster-manager/vars"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// NewClusterInstances creates instances for all nodes of ParseClusterNodes output simultaneously.
+// nodes that can not be connected are returned as errors keyed by "addr,nodeID"
+func NewClusterInstances(clusterNodesInfo [][]string) ([]*Instance, map[string]error) {
+	var (
+		instances []*Instance
+		errs      = make(map[string]error)
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+	)
+	for _, nodeInfo := range clusterNodesInfo {
+		wg.Add(1)
+		go func(addr, nodeID string) {
+			defer wg.Done()
+			i, err := NewInstance(addr)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs[fmt.Sprintf("%s,%s", addr, nodeID)] = err
+				return
+			}
+			i.UpdateNodeClusterInfo(clusterNodesInfo)
+			instances = append(instances, i)
+		}(nodeInfo[1], nodeInfo[0])
+	}
+	wg.Wait()
+	return instances, errs
+}
+
+// CloseInstances closes all the given instances
+func CloseInstances(instances []*Instance) {
+	for _, i := range instances {
+		i.Close()
+	}
+}
+
+// ClusterNode is a node parsed from one line of `cluster nodes` output
+type ClusterNode struct {
+	NodeID      string
+	Addr        string   // ip:port, the cluster bus port is removed
+	Hostname    string   // announced hostname, only reported by redis 7+
+	Flags       []string // myself, master, slave, fail?, fail, handshake, noaddr, nofailover, noflags
+	Role        string   // master or slave
+	MasterID    string   // master node ID if this is a slave, will be "" if this is a master
+	PingSent    int64    // unix time in ms when the last ping was sent, 0 if no pending ping
+	PongRecv    int64    // unix time in ms when the last pong was received
+	ConfigEpoch int64
+	LinkState   string       // connected or disconnected
+	Slots       []*SlotRange // list of SlotRange served by this node
+	OpenSlots   []string     // migrating/importing slots: "[slot->-nodeID]" or "[slot-<-nodeID]"
+}
+
+// GetClusterNodes runs `cluster nodes` on client and parses every line to a ClusterNode, the announced hostnames are
+// recorded for dialing, see setHostnames
+func GetClusterNodes(client *redis.Client) ([]*ClusterNode, error) {
+	cmdOutput, err := client.ClusterNodes(context.Background()).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cluster nodes: %v", err)
+	}
+	nodes, err := parseClusterNodes(cmdOutput)
+	if err != nil {
+		return nil, err
+	}
+	addrHostnames := make(map[string]string)
+	for _, n := range nodes {
+		addrHostnames[n.Addr] = n.Hostname
+	}
+	setHostnames(addrHostnames)
+	return nodes, nil
+}
+
+func parseClusterNodes(cmdOutput string) ([]*ClusterNode, error) {
+	var nodes []*ClusterNode
+	for _, line := range strings.Split(cmdOutput, "\n") {
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+		parts := strings.Split(strings.TrimSpace(line), " ")
+		if len(parts) < 8 {
+			return nil, fmt.Errorf("invalid cluster nodes line: %s", line)
+		}
+		node := &ClusterNode{
+			NodeID:    parts[0],
+			Flags:     strings.Split(parts[2], ","),
+			LinkState: parts[7],
+		}
+		node.Addr, node.Hostname = parseNodeAddr(parts[1])
+		for _, flag := range node.Flags {
+			if flag == "master" || flag == "slave" {
+				node.Role = flag
+				break
+			}
+		}
+		if parts[3] != "-" {
+			node.MasterID = parts[3]
+		}
+		node.PingSent, _ = strconv.ParseInt(parts[4], 10, 64)
+		node.PongRecv, _ = strconv.ParseInt(parts[5], 10, 64)
+		node.ConfigEpoch, _ = strconv.ParseInt(parts[6], 10, 64)
+		var slots []string
+		for _, slot := range parts[8:] {
+			if strings.HasPrefix(slot, "[") {
+				node.OpenSlots = append(node.OpenSlots, slot)
+			} else if len(slot) > 0 {
+				slots = append(slots, slot)
+			}
+		}
+		node.Slots = newSlotRanges(strings.Join(slots, " "))
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+// parseNodeAddr parses the addr field of `cluster nodes`: ip:port@cport[,hostname[,aux=value]*], and returns the addr
+// to connect to and the announced hostname. redis 7.2+ reports the other client port as aux field tls-port or tcp-port
+// if both plaintext and TLS ports are enabled, the port matching --tls is used
+func parseNodeAddr(field string) (string, string) {
+	parts := strings.Split(field, ",")
+	addr := strings.Split(parts[0], "@")[0]
+	// ipv6 addrs are not bracketed in `cluster nodes`: 2001:db8::1:6379
+	if n := strings.LastIndex(addr, ":"); n >= 0 && strings.Count(addr, ":") > 1 && !strings.HasPrefix(addr, "[") {
+		addr = net.JoinHostPort(addr[:n], addr[n+1:])
+	}
+	hostname := ""
+	if len(parts) > 1 {
+		hostname = parts[1]
+	}
+	port := ""
+	for _, aux := range parts[min(len(parts), 2):] {
+		kv := strings.SplitN(aux, "=", 2)
+		if len(kv) == 2 && ((kv[0] == "tls-port" && vars.Cluster.TLS) || (kv[0] == "tcp-port" && !vars.Cluster.TLS)) {
+			port = kv[1]
+		}
+	}
+	if port != "" && port != "0" {
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			addr = net.JoinHostPort(host, port)
+		}
+	}
+	return addr, hostname
+}
+
+// HasFlag reports whether flag is one of the node flags
+func (n *ClusterNode) HasFlag(flag string) bool {
+	for _, f := range n.Flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// Host returns the host part of Addr
+func (n *ClusterNode) Host() string {
+	host, _, err := net.SplitHostPort(n.Addr)
+	if err != nil {
+		return n.Addr
+	}
+	return host
+}
+
+// GetSlotCount returns the number of slots served by this node
+func (n *ClusterNode) GetSlotCount() int {
+	slotCount := 0
+	for _, slotRange := range n.Slots {
+		slotCount += slotRange.SlotCount
+	}
+	return slotCount
+}
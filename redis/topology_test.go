@@ -0,0 +1,85 @@
+package redis
+
+import (
+	"redis-cluster-manager/vars"
+	"reflect"
+	"testing"
+)
+
+func TestParseClusterNodes(t *testing.T) {
+	output := `07c37dfeb235213a872192d90877d0cd55635b91 127.0.0.1:30004@31004,host-4 slave e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca 0 1426238317239 4 connected
+67ed2db8d677e59ec4a4cefb06858cf2a1a89fa1 127.0.0.1:30002@31002 master - 0 1426238316232 2 connected 5461-10922 [5461->-e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca]
+e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca 127.0.0.1:30001@31001 myself,master - 0 0 1 connected 0-5460 10923
+6ec23923021cf3ffec47632106199cb7f496ce01 :0@0 master,fail,noaddr - 1426238316232 1426238315000 5 disconnected
+`
+	nodes, err := parseClusterNodes(output)
+	if err != nil {
+		t.Fatalf("parseClusterNodes() error = %v", err)
+	}
+	if len(nodes) != 4 {
+		t.Fatalf("len(nodes) = %d, want 4", len(nodes))
+	}
+	slave := nodes[0]
+	if slave.Role != "slave" || slave.MasterID != "e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca" ||
+		slave.Addr != "127.0.0.1:30004" || slave.Hostname != "host-4" || slave.ConfigEpoch != 4 {
+		t.Fatalf("unexpected slave node: %+v", slave)
+	}
+	migrating := nodes[1]
+	if migrating.GetSlotCount() != 5462 || len(migrating.OpenSlots) != 1 {
+		t.Fatalf("slots = %d, open slots = %v", migrating.GetSlotCount(), migrating.OpenSlots)
+	}
+	if myself := nodes[2]; !myself.HasFlag("myself") || myself.MasterID != "" || myself.GetSlotCount() != 5462 {
+		t.Fatalf("unexpected myself node: %+v", myself)
+	}
+	if ghost := nodes[3]; !ghost.HasFlag("fail") || !ghost.HasFlag("noaddr") || ghost.LinkState != "disconnected" {
+		t.Fatalf("unexpected failed node: %+v", ghost)
+	}
+}
+
+func TestClusterNodesInfo(t *testing.T) {
+	output := `67ed2db8d677e59ec4a4cefb06858cf2a1a89fa1 127.0.0.1:30002@31002 master - 0 1426238316232 2 connected 5461-10922 [5461->-e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca]
+e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca 127.0.0.1:30001@31001 myself,master - 0 0 1 connected 0-5460 10923
+07c37dfeb235213a872192d90877d0cd55635b91 127.0.0.1:30004@31004 slave e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca 0 1426238317239 4 connected
+`
+	nodes, err := parseClusterNodes(output)
+	if err != nil {
+		t.Fatalf("parseClusterNodes() error = %v", err)
+	}
+	want := [][]string{
+		{"67ed2db8d677e59ec4a4cefb06858cf2a1a89fa1", "127.0.0.1:30002", "5461-10922", "master", "-"},
+		{"e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca", "127.0.0.1:30001", "0-5460 10923", "master", "-"},
+		{"07c37dfeb235213a872192d90877d0cd55635b91", "127.0.0.1:30004", "", "slave", "e7d1eecce10fd6bb5eb35b9f99a514335d9ba9ca"},
+	}
+	if got := ClusterNodesInfo(nodes); !reflect.DeepEqual(got, want) {
+		t.Fatalf("ClusterNodesInfo() = %v, want %v", got, want)
+	}
+}
+
+func TestParseNodeAddr(t *testing.T) {
+	defer func() { vars.Cluster.TLS = false }()
+	tests := []struct {
+		field    string
+		tls      bool
+		addr     string
+		hostname string
+	}{
+		{"127.0.0.1:6379@16379", false, "127.0.0.1:6379", ""},
+		{"127.0.0.1:6379@16379,host-1", true, "127.0.0.1:6379", "host-1"},
+		// plaintext port reported, tls port as aux field
+		{"127.0.0.1:6379@16379,,shard-id=abc,tls-port=6380", false, "127.0.0.1:6379", ""},
+		{"127.0.0.1:6379@16379,,shard-id=abc,tls-port=6380", true, "127.0.0.1:6380", ""},
+		// tls-cluster yes: tls port reported, plaintext port as aux field
+		{"127.0.0.1:6380@16379,host-1,tcp-port=6379", false, "127.0.0.1:6379", "host-1"},
+		{"127.0.0.1:6380@16379,host-1,tcp-port=6379", true, "127.0.0.1:6380", "host-1"},
+		{"127.0.0.1:6379@16379,,tls-port=0", true, "127.0.0.1:6379", ""},
+		{"2001:db8::1:6379@16379,host-1", false, "[2001:db8::1]:6379", "host-1"},
+		{"2001:db8::1:6379@16379,,tls-port=6380", true, "[2001:db8::1]:6380", ""},
+	}
+	for _, tt := range tests {
+		vars.Cluster.TLS = tt.tls
+		addr, hostname := parseNodeAddr(tt.field)
+		if addr != tt.addr || hostname != tt.hostname {
+			t.Errorf("parseNodeAddr(%s) with tls=%v = %s, %s, want %s, %s", tt.field, tt.tls, addr, hostname, tt.addr, tt.hostname)
+		}
+	}
+}
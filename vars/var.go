@@ -18,8 +18,51 @@ var (
 	HostPort    string
 	ClusterName string
 	ClusterID   string
-	Password    string        // password for redis default user 'default'
-	Timeout     time.Duration // timeout duration for redis
+)
+
+// Credential is the username and password to AUTH with
+type Credential struct {
+	Username string
+	Password string
+}
+
+// ClusterSettings are the connection settings of a cluster, given by flags or a profile
+type ClusterSettings struct {
+	Username string        // ACL username, "" for the default user 'default'
+	Password string        // password of Username
+	Timeout  time.Duration // timeout duration for redis
+
+	// password sources other than -a, which leaks into shell history and `ps`
+	PasswordEnv     string                // name of the environment variable holding the password
+	PasswordFile    string                // file holding the password
+	AskPassword     bool                  // prompt for the password
+	CredentialsFile string                // file of per-node credentials
+	Credentials     map[string]Credential // per-node credentials keyed by addr or ip, other nodes use Username/Password
+
+	// TLS settings for data nodes and sentinels
+	TLS           bool   // connect with TLS
+	TLSCACert     string // CA certificate file to verify servers, system roots if not set
+	TLSCert       string // client certificate file for mutual TLS
+	TLSKey        string // private key file of TLSCert
+	TLSServerName string // SNI and the name to verify server certificates, the host of the addr if not set
+	TLSInsecure   bool   // skip verification of server certificates
+
+	// address translation for NAT'd or containerized clusters whose nodes announce unreachable addrs
+	AddrMap     []string // "<announced>=<reachable>" of ip:port or ip
+	CIDRMap     []string // "<announced-cidr>=<reachable-cidr>", host bits of the ip are kept
+	UseHostname bool     // dial the hostname announced by cluster-announce-hostname instead of the ip
+
+	MasterName       string // master name monitored by sentinels
+	SentinelUsername string // ACL username of sentinels, "" for the default user 'default'
+	SentinelPassword string // password of sentinels, sentinels are usually configured without password
+}
+
+// Cluster holds the settings of the cluster being managed, `serve` switches it between the served clusters
+var Cluster ClusterSettings
+
+// redis sentinel info
+var (
+	SentinelPort int // port of sentinels found by `client list` of a data node
 )
 
 //goland:noinspection ALL